@@ -0,0 +1,147 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	libconfig "github.com/kubernetes-csi/csi-lib-utils/config"
+	"github.com/kubernetes-csi/csi-lib-utils/standardflags"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/capabilities"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/check"
+	handler "github.com/kubernetes-csi/external-health-monitor/pkg/csi-handler"
+	healthmetrics "github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// runCheck checks the health of all volumes of the driver once and prints them. It exits with
+// exitProblems if any volume is abnormal or could not be checked.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	csiAddress := fs.String("csi-address", "/run/csi/socket", "Address of the CSI driver socket.")
+	kubeconfig := fs.String("kubeconfig", "", "Absolute path to the kubeconfig file. Required only when running out of cluster.")
+	timeout := fs.Duration("timeout", 15*time.Second, "Timeout of the ListVolumes pagination or of each ControllerGetVolume call.")
+	connectTimeout := fs.Duration("connect-timeout", time.Minute, "Timeout of connecting to the CSI driver and waiting until it is ready.")
+	method := fs.String("method", "", "Method volumes are checked with, ListVolumes or ControllerGetVolume. Empty uses ListVolumes if the driver supports it, like the monitor.")
+	output := fs.String("output", outputTable, "Output format, table or json.")
+	notFoundGracePeriod := fs.Duration("volume-not-found-grace-period", 5*time.Minute, "Minimum age of a PV before its volume is reported as not found on the storage backend.")
+	reasonsConfig := fs.String("abnormal-reasons-config", "", "Path of a YAML file with rules which map the messages of abnormal volume conditions reported by the CSI driver to reasons.")
+	klog.InitFlags(fs)
+	_ = fs.Parse(args)
+	defer klog.Flush()
+	logger := klog.Background()
+	ctx := klog.NewContext(context.Background(), logger)
+
+	if *output != outputTable && *output != outputJSON {
+		logger.Error(nil, "Option --output must be either table or json", "output", *output)
+		return exitError
+	}
+
+	config, err := libconfig.BuildConfig(*kubeconfig, standardflags.SidecarConfiguration{KubeAPIQPS: 5, KubeAPIBurst: 10})
+	if err != nil {
+		logger.Error(err, "Failed to build a Kubernetes config")
+		return exitError
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		logger.Error(err, "Failed to create a Clientset")
+		return exitError
+	}
+
+	csiConn, driverName, err := connectDriver(ctx, *csiAddress, *connectTimeout, *timeout)
+	if err != nil {
+		logger.Error(err, "Failed to connect to the CSI driver")
+		return exitError
+	}
+	defer csiConn.Close()
+
+	if *method == "" {
+		discoverer := capabilities.NewDiscoverer(csiConn, csiTimeout, wait.Backoff{Duration: time.Second, Factor: 2, Steps: 3})
+		caps, err := detectCapabilities(ctx, discoverer)
+		if err != nil {
+			logger.Error(err, "Failed to detect the capabilities of the CSI driver")
+			return exitError
+		}
+		*method = checkMethod(caps)
+		if *method == "" {
+			logger.Error(nil, "CSI driver does not support Controller ListVolumes and GetVolume service or does not implement VolumeCondition")
+			return exitError
+		}
+	}
+
+	var classifier handler.Classifier
+	if *reasonsConfig != "" {
+		classifier, err = handler.LoadClassifier(*reasonsConfig, driverName)
+		if err != nil {
+			logger.Error(err, "Failed to load abnormal reasons")
+			return exitError
+		}
+	}
+
+	report, err := check.Run(ctx, clientset, csiConn, check.Options{
+		DriverName:          driverName,
+		Method:              *method,
+		Timeout:             *timeout,
+		NotFoundGracePeriod: *notFoundGracePeriod,
+		Classifier:          classifier,
+	})
+	if err != nil {
+		logger.Error(err, "Failed to check the volumes", "method", *method)
+		return exitError
+	}
+
+	if *output == outputJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the report: %v\n", err)
+		return exitError
+	}
+
+	if !report.Healthy() {
+		return exitProblems
+	}
+	return exitOK
+}
+
+// checkMethod returns the method the monitor would check volumes with, or an empty string if the
+// driver cannot be monitored
+func checkMethod(caps handler.Capabilities) string {
+	switch {
+	case caps.CanListVolumeConditions():
+		return healthmetrics.MethodListVolumes
+	case caps.CanGetVolumeConditions():
+		return healthmetrics.MethodControllerGetVolume
+	default:
+		return ""
+	}
+}
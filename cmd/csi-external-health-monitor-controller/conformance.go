@@ -0,0 +1,103 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/capabilities"
+	handler "github.com/kubernetes-csi/external-health-monitor/pkg/csi-handler"
+)
+
+// runConformance checks that the volume condition implementation of the driver behaves as the
+// monitor expects and prints the result of each check. It exits with exitProblems if any check fails.
+func runConformance(args []string) int {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	csiAddress := fs.String("csi-address", "/run/csi/socket", "Address of the CSI driver socket.")
+	timeout := fs.Duration("timeout", 15*time.Second, "Timeout of each CSI call.")
+	connectTimeout := fs.Duration("connect-timeout", time.Minute, "Timeout of connecting to the CSI driver and waiting until it is ready.")
+	pageSize := fs.Int("page-size", 2, "max_entries of the paginated ListVolumes calls, a small value exercises the pagination with few volumes.")
+	maxVolumes := fs.Int("max-volumes", 100, "Maximum number of volumes fetched with ControllerGetVolume, 0 fetches all volumes.")
+	volumeIDs := fs.String("volume-ids", "", "Comma separated list of volume IDs fetched with ControllerGetVolume in addition to the listed volumes, required to check drivers without ListVolumes.")
+	output := fs.String("output", outputTable, "Output format, table or json.")
+	klog.InitFlags(fs)
+	_ = fs.Parse(args)
+	defer klog.Flush()
+	logger := klog.Background()
+	ctx := klog.NewContext(context.Background(), logger)
+
+	if *output != outputTable && *output != outputJSON {
+		logger.Error(nil, "Option --output must be either table or json", "output", *output)
+		return exitError
+	}
+	if *pageSize <= 0 {
+		logger.Error(nil, "Option --page-size must be positive", "pageSize", *pageSize)
+		return exitError
+	}
+
+	csiConn, driverName, err := connectDriver(ctx, *csiAddress, *connectTimeout, *timeout)
+	if err != nil {
+		logger.Error(err, "Failed to connect to the CSI driver")
+		return exitError
+	}
+	defer csiConn.Close()
+
+	discoverer := capabilities.NewDiscoverer(csiConn, csiTimeout, wait.Backoff{Duration: time.Second, Factor: 2, Steps: 3})
+	caps, err := detectCapabilities(ctx, discoverer)
+	if err != nil {
+		logger.Error(err, "Failed to detect the capabilities of the CSI driver")
+		return exitError
+	}
+
+	var ids []string
+	for _, id := range strings.Split(*volumeIDs, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	report := handler.NewConformanceChecker(csiConn, handler.ConformanceOptions{
+		Capabilities: caps,
+		Timeout:      *timeout,
+		PageSize:     int32(*pageSize),
+		MaxVolumes:   *maxVolumes,
+		VolumeIDs:    ids,
+	}).Run(ctx, driverName)
+
+	if *output == outputJSON {
+		err = report.WriteJSON(os.Stdout)
+	} else {
+		err = report.WriteTable(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the report: %v\n", err)
+		return exitError
+	}
+
+	if !report.Passed() {
+		return exitProblems
+	}
+	return exitOK
+}
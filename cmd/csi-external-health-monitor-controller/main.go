@@ -22,12 +22,18 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/server"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -48,19 +54,39 @@ import (
 	"github.com/kubernetes-csi/csi-lib-utils/standardflags"
 	"google.golang.org/grpc"
 
+	"github.com/kubernetes-csi/external-health-monitor/pkg/capabilities"
 	monitorcontroller "github.com/kubernetes-csi/external-health-monitor/pkg/controller"
+	handler "github.com/kubernetes-csi/external-health-monitor/pkg/csi-handler"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/features"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/httpserver"
+	healthmetrics "github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/volumehealth"
 )
 
 const (
 
 	// Default timeout of short CSI calls like GetPluginInfo
 	csiTimeout = time.Second
+
+	// modeController checks volumes with the controller service of the CSI driver
+	modeController = "controller"
+	// modeNode checks the volumes published on the local node with the node service of the CSI driver
+	modeNode = "node"
 )
 
 // Command line flags
 var (
-	monitorInterval = flag.Duration("monitor-interval", 1*time.Minute, "Interval for controller to check volumes health condition.")
+	mode           = flag.String("mode", modeController, "Mode of the health monitor: controller checks volumes with the controller service of the CSI driver, node runs next to the node plugin on every node and checks the volumes published on it with NodeGetVolumeStats.")
+	kubeletRootDir = flag.String("kubelet-root-dir", "/var/lib/kubelet", "Root directory of kubelet, used in node mode to compute the paths of published volumes.")
+
+	abnormalReasonsConfig = flag.String("abnormal-reasons-config", "", "Path of a YAML file with rules which map the messages of abnormal volume conditions reported by the CSI driver to reasons and severities. Empty uses the VolumeConditionAbnormal reason for all of them.")
+	usageThresholdsConfig = flag.String("usage-thresholds-config", "", "Path of a YAML file with the bytes and inodes usage thresholds of VolumeNearlyFull events by StorageClass, used in node mode. Empty disables the events.")
+
+	monitorInterval          = flag.Duration("monitor-interval", 1*time.Minute, "Interval for controller to check volumes health condition.")
+	unhealthyMonitorInterval = flag.Duration("unhealthy-monitor-interval", 0, "Interval for controller to check the health condition of abnormal volumes when ControllerGetVolume is used. 0 means the same as monitor-interval.")
+	retryIntervalStart       = flag.Duration("retry-interval-start", time.Second, "Initial retry interval of a failed ControllerGetVolume check. It doubles with each failure, up to retry-interval-max.")
+	retryIntervalMax         = flag.Duration("retry-interval-max", 5*time.Minute, "Maximum retry interval of a failed ControllerGetVolume check.")
 
 	resync                   = flag.Duration("resync", 10*time.Minute, "Resync interval of the controller.")
 	timeout                  = flag.Duration("timeout", 15*time.Second, "Timeout for waiting for attaching or detaching the volume.")
@@ -68,7 +94,37 @@ var (
 	volumeListAndAddInterval = flag.Duration("volume-list-add-interval", 5*time.Minute, "Time interval for listing volumes and add them to queue")
 	nodeListAndAddInterval   = flag.Duration("node-list-add-interval", 5*time.Minute, "Time interval for listing nodess and add them to queue")
 	workerThreads            = flag.Uint("worker-threads", 10, "Number of pv monitor worker threads")
+	nodeWorkerThreads        = flag.Uint("node-worker-threads", 10, "Number of node watcher worker threads")
 	enableNodeWatcher        = flag.Bool("enable-node-watcher", false, "Indicates whether the node watcher is enabled or not.")
+
+	nodeFailureGracePeriod        = flag.Duration("node-failure-grace-period", monitorcontroller.DefaultNodeNotReadyTimeDuration, "Time a node must keep failing before the node watcher considers it broken.")
+	nodeFailureUnreachableTaint   = flag.Bool("node-failure-unreachable-taint", false, "Consider nodes with the node.kubernetes.io/unreachable taint as failing.")
+	nodeFailureOutOfServiceTaint  = flag.Bool("node-failure-out-of-service-taint", false, "Consider nodes with the node.kubernetes.io/out-of-service taint as broken, without waiting for node-failure-grace-period.")
+	nodeFailureLeaseDuration      = flag.Duration("node-failure-lease-duration", 0, "Consider nodes whose Lease in the kube-node-lease namespace was not renewed for this duration as failing. 0 disables the check.")
+	nodeFailurePressureConditions = flag.String("node-failure-pressure-conditions", "", "Comma separated list of node conditions, e.g. DiskPressure,PIDPressure, which make a node failing while they are True.")
+
+	volumeNotFoundGracePeriod = flag.Duration("volume-not-found-grace-period", 5*time.Minute, "Minimum age of a PV before its volume is reported as not found on the storage backend.")
+	volumeNotFoundThreshold   = flag.Int("volume-not-found-threshold", 3, "Number of consecutive checks a bound volume must be missing on the storage backend before it is reported as not found. 0 disables the detection.")
+
+	driverHealthInterval         = flag.Duration("driver-health-interval", 10*time.Second, "Interval for probing the CSI driver. Abnormal volume conditions are not reported while the driver is unhealthy. 0 disables the driver health monitoring.")
+	driverHealthFailureThreshold = flag.Int("driver-health-failure-threshold", 3, "Number of consecutive failed probes after which the CSI driver is considered unhealthy.")
+	exitOnConnectionLoss         = flag.Bool("exit-on-connection-loss", true, "Exit when the connection to the CSI driver is lost. If false, the monitor reconnects and the driver is considered unhealthy until it passes a probe again.")
+
+	enableAttachmentDriftCheck = flag.Bool("enable-attachment-drift-check", false, "Compare the nodes a volume is published to by the CSI driver with its VolumeAttachments and report the differences. Requires the PUBLISH_UNPUBLISH_VOLUME controller capability, and LIST_VOLUMES_PUBLISHED_NODES when ListVolumes is used.")
+
+	httpTLSCertFile       = flag.String("http-tls-cert-file", "", "Certificate file for serving the http-endpoint with TLS. The certificate is reloaded when the file changes. Requires http-tls-private-key-file.")
+	httpTLSPrivateKeyFile = flag.String("http-tls-private-key-file", "", "Private key file of http-tls-cert-file.")
+	httpEnableAuth        = flag.Bool("http-enable-auth", false, "Require a bearer token for all paths of the http-endpoint except /healthz. The token is verified with a TokenReview and the user must be allowed to get the path, which is checked with a SubjectAccessReview.")
+
+	enableDebugEndpoints = flag.Bool("enable-debug-endpoints", false, "Serve the live state of the controller, i.e. the last health of each volume, the node watcher state and the PV queue, as JSON at /debug/ on the http-endpoint.")
+
+	enableVolumeHealthResource = flag.Bool("enable-volume-health-resource", false, "Maintain a VolumeHealth object with the current health and the recent health transitions of each monitored PVC. Requires the VolumeHealth CRD.")
+	volumeHealthHistoryLimit   = flag.Int("volume-health-history-limit", 10, "Maximum number of health transitions kept in the status of a VolumeHealth object.")
+
+	capabilitiesTimeout       = flag.Duration("capabilities-timeout", time.Second, "Timeout of discovering the plugin and controller capabilities of the CSI driver.")
+	capabilitiesRetries       = flag.Int("capabilities-retries", 5, "Number of attempts of discovering the capabilities of the CSI driver before giving up until the next discovery. The interval between attempts starts at capabilities-retry-interval and doubles with each failure.")
+	capabilitiesRetryInterval = flag.Duration("capabilities-retry-interval", time.Second, "Initial interval between attempts of discovering the capabilities of the CSI driver.")
+	capabilitiesInterval      = flag.Duration("capabilities-interval", 5*time.Minute, "Interval for detecting the capabilities of the CSI driver again, so that the controller follows driver upgrades. They are also detected again after the connection to the driver is lost. 0 disables the periodic detection.")
 )
 
 var (
@@ -76,6 +132,12 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(subcommand(os.Args[2:]))
+		}
+	}
+
 	fg := featuregate.NewFeatureGate()
 	logsapi.AddFeatureGates(fg)
 	c := logsapi.NewLoggingConfiguration()
@@ -112,6 +174,11 @@ func main() {
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
+	if *mode != modeController && *mode != modeNode {
+		logger.Error(nil, "Option --mode must be either controller or node", "mode", *mode)
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
 	if *workerThreads == 0 {
 		logger.Error(nil, "Option --worker-threads must be greater than zero")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
@@ -127,9 +194,27 @@ func main() {
 
 	metricsManager := metrics.NewCSIMetricsManager("" /* driverName */)
 
+	if *driverHealthFailureThreshold <= 0 {
+		logger.Error(nil, "Option --driver-health-failure-threshold must be greater than zero")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+
+	// The driver health monitor is created after the driver name is known, the connection loss
+	// handler only uses it once it exists
+	var driverHealth atomic.Pointer[handler.DriverHealthMonitor]
+	var capabilitiesMonitorPtr atomic.Pointer[handler.CapabilitiesMonitor]
+	onConnectionLoss := connection.ExitOnConnectionLoss()
+	if !*exitOnConnectionLoss {
+		onConnectionLoss = func(ctx context.Context) bool {
+			driverHealth.Load().ConnectionLost(ctx)
+			capabilitiesMonitorPtr.Load().Invalidate()
+			return true
+		}
+	}
+
 	// Connect to CSI.
 	ctx := context.Background()
-	csiConn, err := connection.Connect(ctx, standardflags.Configuration.CSIAddress, metricsManager, connection.OnConnectionLoss(connection.ExitOnConnectionLoss()))
+	csiConn, err := connection.Connect(ctx, standardflags.Configuration.CSIAddress, metricsManager, connection.OnConnectionLoss(onConnectionLoss))
 	if err != nil {
 		logger.Error(err, "Failed to connect to the CSI driver")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
@@ -153,13 +238,30 @@ func main() {
 	logger.V(2).Info("CSI driver name", "driver", storageDriver)
 	metricsManager.SetDriverName(storageDriver)
 
-	// Prepare HTTP endpoint for metrics + leader election healthz
+	// Health metrics are served together with the CSI operation metrics
+	metricsRecorder := healthmetrics.NewRecorder(storageDriver)
+	metricsRecorder.Register(metricsManager.GetRegistry())
+
+	// Prepare HTTP endpoint for metrics + leader election and driver healthz
 	mux := http.NewServeMux()
 	if addr != "" {
 		metricsManager.RegisterToServer(mux, standardflags.Configuration.MetricsPath)
+		httpServer, err := httpserver.New(addr, mux, httpserver.Options{
+			CertFile:   *httpTLSCertFile,
+			KeyFile:    *httpTLSPrivateKeyFile,
+			EnableAuth: *httpEnableAuth,
+			Client:     clientset,
+		})
+		if err != nil {
+			logger.Error(err, "Failed to create HTTP server")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+		if *httpEnableAuth && *httpTLSCertFile == "" {
+			logger.Info("Authentication of the HTTP endpoint is enabled without TLS, bearer tokens are sent in plaintext")
+		}
 		go func() {
-			logger.Info("ServeMux listening", "address", addr)
-			err := http.ListenAndServe(addr, mux)
+			logger.Info("ServeMux listening", "address", addr, "tls", *httpTLSCertFile != "", "auth", *httpEnableAuth)
+			err := httpServer.ListenAndServe(klog.NewContext(ctx, logger))
 			if err != nil {
 				logger.Error(err, "Failed to start HTTP server at specified address and metrics path", "address", addr, "path", standardflags.Configuration.MetricsPath)
 				klog.FlushAndExit(klog.ExitFlushTimeout, 1)
@@ -167,58 +269,103 @@ func main() {
 		}()
 	}
 
-	supportsService, err := supportsPluginControllerService(cancelationCtx, csiConn)
-	if err != nil {
-		logger.Error(err, "Failed to check whether the CSI driver supports the Plugin Controller Service")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
-	}
-	if !supportsService {
-		logger.V(2).Info("CSI driver does not support Plugin Controller Service, exiting")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	var classifier handler.Classifier
+	if *abnormalReasonsConfig != "" {
+		classifier, err = handler.LoadClassifier(*abnormalReasonsConfig, storageDriver)
+		if err != nil {
+			logger.Error(err, "Failed to load abnormal reasons")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
 	}
 
-	supportControllerListVolumes, err := supportControllerListVolumes(cancelationCtx, csiConn)
-	if err != nil {
-		logger.Error(err, "Failed to check whether the CSI driver supports the Controller Service ListVolumes")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	if *mode == modeNode {
+		runNodeMonitor(cancelationCtx, logger, clientset, factory, csiConn, storageDriver, metricsRecorder, classifier, mux, &driverHealth)
+		return
 	}
 
-	supportControllerGetVolume, err := supportControllerGetVolume(cancelationCtx, csiConn)
-	if err != nil {
-		logger.Error(err, "Failed to check whether the CSI driver supports the Controller Service GetVolume")
+	// The driver may lack the capabilities while it is upgraded, so they are detected again
+	// periodically and after reconnects instead of exiting
+	if *capabilitiesRetries <= 0 {
+		logger.Error(nil, "Option --capabilities-retries must be greater than zero")
 		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
-
-	supportControllerVolumeCondition, err := supportControllerVolumeCondition(cancelationCtx, csiConn)
+	discoverer := capabilities.NewDiscoverer(csiConn, *capabilitiesTimeout, wait.Backoff{
+		Duration: *capabilitiesRetryInterval,
+		Factor:   2,
+		Steps:    *capabilitiesRetries,
+	})
+	if addr != "" {
+		mux.Handle("/capabilities", discoverer)
+	}
+	detect := func(ctx context.Context) (handler.Capabilities, error) {
+		return detectCapabilities(ctx, discoverer)
+	}
+	driverCapabilities, err := detect(klog.NewContext(ctx, logger))
 	if err != nil {
-		logger.Error(err, "Failed to check whether the CSI driver supports the Controller Service VolumeCondition")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		logger.Error(err, "Failed to detect the capabilities of the CSI driver, detecting them again later")
 	}
-
-	if (!supportControllerListVolumes && !supportControllerGetVolume) || !supportControllerVolumeCondition {
-		logger.V(2).Info("CSI driver does not support Controller ListVolumes and GetVolume service or does not implement VolumeCondition, exiting")
-		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	if !driverCapabilities.CanMonitor() {
+		logger.Info("CSI driver does not support Controller ListVolumes and GetVolume service or does not implement VolumeCondition, waiting until it does")
 	}
+	if *enableAttachmentDriftCheck && !driverCapabilities.SupportsAttachmentDriftCheck(driverCapabilities.CanListVolumeConditions()) {
+		logger.Info("CSI driver does not report the nodes volumes are published to, attachment drift is not checked until it does")
+	}
+	capabilitiesMonitor := handler.NewCapabilitiesMonitor(driverCapabilities, detect, *capabilitiesInterval)
+	capabilitiesMonitorPtr.Store(capabilitiesMonitor)
+	go capabilitiesMonitor.Run(klog.NewContext(ctx, logger))
 
 	option := monitorcontroller.PVMonitorOptions{
 		DriverName:        storageDriver,
 		ContextTimeout:    *timeout,
 		EnableNodeWatcher: *enableNodeWatcher,
-		SupportListVolume: supportControllerListVolumes,
+		Capabilities:      capabilitiesMonitor,
 
-		ListVolumesInterval:      *listVolumesInterval,
-		PVWorkerExecuteInterval:  *monitorInterval,
-		VolumeListAndAddInterval: *volumeListAndAddInterval,
+		ListVolumesInterval:              *listVolumesInterval,
+		PVWorkerExecuteInterval:          *monitorInterval,
+		UnhealthyPVWorkerExecuteInterval: *unhealthyMonitorInterval,
+		VolumeListAndAddInterval:         *volumeListAndAddInterval,
+		RetryIntervalStart:               *retryIntervalStart,
+		RetryIntervalMax:                 *retryIntervalMax,
 
 		NodeWorkerExecuteInterval: *monitorInterval,
 		NodeListAndAddInterval:    *nodeListAndAddInterval,
+		NodeWorkerThreads:         int(*nodeWorkerThreads),
+		NodeFailureCriteria: monitorcontroller.NodeFailureCriteria{
+			GracePeriod:        *nodeFailureGracePeriod,
+			UnreachableTaint:   *nodeFailureUnreachableTaint,
+			OutOfServiceTaint:  *nodeFailureOutOfServiceTaint,
+			LeaseDuration:      *nodeFailureLeaseDuration,
+			PressureConditions: parseNodeConditions(*nodeFailurePressureConditions),
+		},
+
+		VolumeNotFoundGracePeriod: *volumeNotFoundGracePeriod,
+		VolumeNotFoundThreshold:   *volumeNotFoundThreshold,
+
+		EnableAttachmentDriftCheck: *enableAttachmentDriftCheck,
+
+		Classifier:      classifier,
+		MetricsRecorder: metricsRecorder,
+	}
+
+	var dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+	if *enableVolumeHealthResource {
+		dynamicClient, err := dynamic.NewForConfig(config)
+		if err != nil {
+			logger.Error(err, "Failed to create a dynamic client")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+		}
+		dynamicFactory = dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, *resync)
+		option.VolumeHealth = volumehealth.NewUpdater(dynamicClient, dynamicFactory, *volumeHealthHistoryLimit)
 	}
 
 	broadcaster := record.NewBroadcaster(record.WithContext(ctx))
 	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: clientset.CoreV1().Events(v1.NamespaceAll)})
 	eventRecorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: fmt.Sprintf("csi-pv-monitor-controller-%s", option.DriverName)}).WithLogger(logger)
 
-	monitorController := monitorcontroller.NewPVMonitorController(
+	// The driver is probed by all replicas, so that /healthz/driver works on all of them
+	option.DriverHealth = startDriverHealthMonitor(klog.NewContext(ctx, logger), logger, csiConn, storageDriver, eventRecorder, metricsRecorder, mux, &driverHealth)
+
+	monitorController, err := monitorcontroller.NewPVMonitorController(
 		logger,
 		clientset,
 		csiConn,
@@ -226,6 +373,13 @@ func main() {
 		eventRecorder,
 		&option,
 	)
+	if err != nil {
+		logger.Error(err, "Failed to create the PV monitor controller")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	if *enableDebugEndpoints && addr != "" {
+		monitorController.RegisterDebugHandlers(mux)
+	}
 
 	// handle SIGTERM and SIGINT by cancelling the context.
 
@@ -256,10 +410,16 @@ func main() {
 			var wg sync.WaitGroup
 			stopCh := controllerCtx.Done()
 			factory.Start(stopCh)
+			if dynamicFactory != nil {
+				dynamicFactory.Start(stopCh)
+			}
 			monitorController.Run(controllerCtx, int(*workerThreads), &wg)
 		} else {
 			stopCh := ctx.Done()
 			factory.Start(stopCh)
+			if dynamicFactory != nil {
+				dynamicFactory.Start(stopCh)
+			}
 			monitorController.Run(ctx, int(*workerThreads), nil)
 		}
 	}
@@ -274,89 +434,138 @@ func main() {
 	)
 }
 
-func supportControllerListVolumes(ctx context.Context, csiConn *grpc.ClientConn) (supportControllerListVolumes bool, err error) {
-	caps, err := rpc.GetControllerCapabilities(ctx, csiConn)
-	if err != nil {
-		return false, fmt.Errorf("failed to get controller capabilities: %v", err)
+// runNodeMonitor checks the volumes published on the local node until a signal is received.
+// Every node runs its own monitor, so leader election is not used.
+func runNodeMonitor(ctx context.Context, logger klog.Logger, clientset kubernetes.Interface, factory informers.SharedInformerFactory, csiConn *grpc.ClientConn, storageDriver string, metricsRecorder *healthmetrics.Recorder, classifier handler.Classifier, mux *http.ServeMux, driverHealth *atomic.Pointer[handler.DriverHealthMonitor]) {
+	nodeName := os.Getenv(util.EnvNodeName)
+	if nodeName == "" {
+		logger.Error(nil, "Environment variable must be set in node mode", "env", util.EnvNodeName)
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
-	return caps[csi.ControllerServiceCapability_RPC_LIST_VOLUMES], nil
-}
+	// leader election, which serves /healthz/leader-election in controller mode, is not used in
+	// node mode, so liveness probes of the DaemonSet use /healthz
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
 
-// TODO: move this to csi-lib-utils
-func supportControllerGetVolume(ctx context.Context, csiConn *grpc.ClientConn) (supportControllerGetVolume bool, err error) {
-	client := csi.NewControllerClient(csiConn)
-	req := csi.ControllerGetCapabilitiesRequest{}
-	rsp, err := client.ControllerGetCapabilities(ctx, &req)
+	caps, err := getNodeCapabilities(ctx, csiConn)
 	if err != nil {
-		return false, err
+		logger.Error(err, "Failed to get the node capabilities of the CSI driver")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
+	}
+	if !caps[csi.NodeServiceCapability_RPC_GET_VOLUME_STATS] || !caps[csi.NodeServiceCapability_RPC_VOLUME_CONDITION] {
+		logger.V(2).Info("CSI driver does not support NodeGetVolumeStats or does not implement VolumeCondition, exiting")
+		klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 	}
 
-	for _, cap := range rsp.GetCapabilities() {
-		if cap == nil {
-			continue
-		}
-		rpc := cap.GetRpc()
-		if rpc == nil {
-			continue
-		}
-		t := rpc.GetType()
-		if t == csi.ControllerServiceCapability_RPC_GET_VOLUME {
-			return true, nil
+	var usageThresholds *handler.UsageThresholds
+	if *usageThresholdsConfig != "" {
+		usageThresholds, err = handler.LoadUsageThresholds(*usageThresholdsConfig)
+		if err != nil {
+			logger.Error(err, "Failed to load usage thresholds")
+			klog.FlushAndExit(klog.ExitFlushTimeout, 1)
 		}
 	}
 
-	return false, nil
+	option := monitorcontroller.NodeMonitorOptions{
+		ContextTimeout:     *timeout,
+		DriverName:         storageDriver,
+		NodeName:           nodeName,
+		KubeletRootDir:     *kubeletRootDir,
+		StageUnstageVolume: caps[csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME],
+		MonitorInterval:    *monitorInterval,
+		UsageThresholds:    usageThresholds,
+		MetricsRecorder:    metricsRecorder,
+		Classifier:         classifier,
+	}
+
+	runCtx := klog.NewContext(server.SetupSignalContext(), logger)
+	broadcaster := record.NewBroadcaster(record.WithContext(runCtx))
+	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: clientset.CoreV1().Events(v1.NamespaceAll)})
+	eventRecorder := broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: fmt.Sprintf("csi-pv-monitor-node-%s", storageDriver), Host: nodeName}).WithLogger(logger)
+	option.DriverHealth = startDriverHealthMonitor(runCtx, logger, csiConn, storageDriver, eventRecorder, metricsRecorder, mux, driverHealth)
+
+	nodeMonitor := monitorcontroller.NewNodeMonitorController(logger, clientset, csiConn, factory, eventRecorder, &option)
+	factory.Start(runCtx.Done())
+	nodeMonitor.Run(runCtx)
 }
 
-// TODO: move this to csi-lib-utils
-func supportControllerVolumeCondition(ctx context.Context, csiConn *grpc.ClientConn) (supportControllerVolumeCondition bool, err error) {
-	client := csi.NewControllerClient(csiConn)
-	req := csi.ControllerGetCapabilitiesRequest{}
-	rsp, err := client.ControllerGetCapabilities(ctx, &req)
-	if err != nil {
-		return false, err
+// startDriverHealthMonitor starts probing the CSI driver in the background and serves its health
+// at /healthz/driver. It returns nil if the driver health monitoring is disabled.
+func startDriverHealthMonitor(ctx context.Context, logger klog.Logger, csiConn *grpc.ClientConn, storageDriver string, eventRecorder record.EventRecorder, metricsRecorder *healthmetrics.Recorder, mux *http.ServeMux, driverHealth *atomic.Pointer[handler.DriverHealthMonitor]) *handler.DriverHealthMonitor {
+	if *driverHealthInterval <= 0 {
+		return nil
 	}
 
-	for _, cap := range rsp.GetCapabilities() {
-		if cap == nil {
-			continue
-		}
+	eventObject := podReference()
+	if eventObject == nil {
+		logger.Info("Environment variables of the Pod are not set, DriverUnavailable events are not sent", "env", []string{util.EnvPodName, util.EnvPodNamespace})
+	}
+	monitor := handler.NewDriverHealthMonitor(storageDriver, csiConn, *timeout, *driverHealthInterval, *driverHealthFailureThreshold, eventRecorder, eventObject, metricsRecorder)
+	driverHealth.Store(monitor)
+	mux.Handle("/healthz/driver", monitor)
+	go monitor.Run(ctx)
+	return monitor
+}
 
-		rpc := cap.GetRpc()
-		if rpc == nil {
-			continue
-		}
-		t := rpc.GetType()
-		if t == csi.ControllerServiceCapability_RPC_VOLUME_CONDITION {
-			return true, nil
+// podReference returns a reference to the Pod the monitor runs in, or nil if it is unknown
+func podReference() runtime.Object {
+	name, namespace := os.Getenv(util.EnvPodName), os.Getenv(util.EnvPodNamespace)
+	if name == "" || namespace == "" {
+		return nil
+	}
+	return &v1.ObjectReference{Kind: "Pod", APIVersion: "v1", Name: name, Namespace: namespace}
+}
+
+// parseNodeConditions parses a comma separated list of node condition types
+func parseNodeConditions(list string) []v1.NodeConditionType {
+	var conditions []v1.NodeConditionType
+	for _, condition := range strings.Split(list, ",") {
+		if condition = strings.TrimSpace(condition); condition != "" {
+			conditions = append(conditions, v1.NodeConditionType(condition))
 		}
 	}
+	return conditions
+}
 
-	return false, nil
+// detectCapabilities discovers the capabilities of the CSI driver which decide how volumes are checked
+func detectCapabilities(ctx context.Context, discoverer *capabilities.Discoverer) (handler.Capabilities, error) {
+	caps, err := discoverer.Discover(ctx)
+	if err != nil {
+		return handler.Capabilities{}, err
+	}
+
+	return handler.Capabilities{
+		ControllerService:         caps.HasPluginService(csi.PluginCapability_Service_CONTROLLER_SERVICE),
+		ListVolumes:               caps.HasControllerRPC(csi.ControllerServiceCapability_RPC_LIST_VOLUMES),
+		GetVolume:                 caps.HasControllerRPC(csi.ControllerServiceCapability_RPC_GET_VOLUME),
+		VolumeCondition:           caps.HasControllerRPC(csi.ControllerServiceCapability_RPC_VOLUME_CONDITION),
+		PublishUnpublishVolume:    caps.HasControllerRPC(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME),
+		ListVolumesPublishedNodes: caps.HasControllerRPC(csi.ControllerServiceCapability_RPC_LIST_VOLUMES_PUBLISHED_NODES),
+	}, nil
 }
 
 // TODO: move this to csi-lib-utils
-func supportsPluginControllerService(ctx context.Context, csiConn *grpc.ClientConn) (bool, error) {
-	client := csi.NewIdentityClient(csiConn)
-	req := csi.GetPluginCapabilitiesRequest{}
-	rsp, err := client.GetPluginCapabilities(ctx, &req)
+func getNodeCapabilities(ctx context.Context, csiConn *grpc.ClientConn) (map[csi.NodeServiceCapability_RPC_Type]bool, error) {
+	client := csi.NewNodeClient(csiConn)
+	req := csi.NodeGetCapabilitiesRequest{}
+	rsp, err := client.NodeGetCapabilities(ctx, &req)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+
+	caps := make(map[csi.NodeServiceCapability_RPC_Type]bool)
 	for _, cap := range rsp.GetCapabilities() {
 		if cap == nil {
 			continue
 		}
-		srv := cap.GetService()
-		if srv == nil {
+		rpc := cap.GetRpc()
+		if rpc == nil {
 			continue
 		}
-		t := srv.GetType()
-		if t == csi.PluginCapability_Service_CONTROLLER_SERVICE {
-			return true, nil
-		}
+		caps[rpc.GetType()] = true
 	}
 
-	return false, nil
+	return caps, nil
 }
@@ -0,0 +1,72 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-utils/connection"
+	"github.com/kubernetes-csi/csi-lib-utils/metrics"
+	"github.com/kubernetes-csi/csi-lib-utils/rpc"
+	"google.golang.org/grpc"
+)
+
+// Exit codes of the subcommands
+const (
+	// exitOK means that the subcommand found no problems
+	exitOK = 0
+	// exitProblems means that the subcommand found problems, e.g. abnormal volumes
+	exitProblems = 1
+	// exitError means that the subcommand could not run, e.g. because the driver is not reachable
+	exitError = 2
+)
+
+// subcommands run a one-shot task instead of the monitor, they get the arguments after their name
+// and return the exit code
+var subcommands = map[string]func(args []string) int{
+	"check":       runCheck,
+	"conformance": runConformance,
+}
+
+// connectDriver connects to the CSI driver at address and returns the connection and the driver name.
+// It fails if the driver is not ready within connectTimeout, so that one-shot tasks do not hang
+// on a missing socket. Each probe is limited by probeTimeout.
+func connectDriver(ctx context.Context, address string, connectTimeout, probeTimeout time.Duration) (*grpc.ClientConn, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	csiConn, err := connection.Connect(ctx, address, metrics.NewCSIMetricsManager("" /* driverName */))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to the CSI driver: %v", err)
+	}
+
+	if err := rpc.ProbeForever(ctx, csiConn, probeTimeout); err != nil {
+		csiConn.Close()
+		return nil, "", fmt.Errorf("failed to probe the CSI driver: %v", err)
+	}
+
+	nameCtx, cancel := context.WithTimeout(ctx, csiTimeout)
+	defer cancel()
+	driverName, err := rpc.GetDriverName(nameCtx, csiConn)
+	if err != nil {
+		csiConn.Close()
+		return nil, "", fmt.Errorf("failed to get the CSI driver name: %v", err)
+	}
+	return csiConn, driverName, nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VolumeHealthState is the health state of a volume
+type VolumeHealthState string
+
+const (
+	// VolumeHealthHealthy means the last observation reported the volume healthy
+	VolumeHealthHealthy VolumeHealthState = "Healthy"
+	// VolumeHealthAbnormal means the last observation reported the volume abnormal
+	VolumeHealthAbnormal VolumeHealthState = "Abnormal"
+)
+
+// VolumeHealthSource is the component of the health monitor which observed the volume
+type VolumeHealthSource string
+
+const (
+	// VolumeHealthSourceControllerCheck is the ListVolumes or ControllerGetVolume check of the volume
+	VolumeHealthSourceControllerCheck VolumeHealthSource = "ControllerCheck"
+	// VolumeHealthSourceNodeWatcher is the node watcher, which reports volumes on failed nodes
+	VolumeHealthSourceNodeWatcher VolumeHealthSource = "NodeWatcher"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="State",type=string,JSONPath=`.status.state`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.reason`
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.status.source`
+// +kubebuilder:printcolumn:name="Failures",type=integer,JSONPath=`.status.consecutiveFailures`
+// +kubebuilder:printcolumn:name="Last Check",type=date,JSONPath=`.status.lastCheckTime`
+
+// VolumeHealth records the health of the volume of the PVC with the same name and namespace.
+// It is created and owned by the health monitor, so it is deleted together with the PVC.
+type VolumeHealth struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Status is the health of the volume as observed by the health monitor
+	// +optional
+	Status VolumeHealthStatus `json:"status,omitempty"`
+}
+
+// VolumeHealthStatus is the current health of a volume and its recent transitions. The volume is
+// abnormal as long as any source reports it abnormal. Observations which do not change the rest of
+// the status only update LastCheckTime and ConsecutiveFailures, at most every 5 minutes.
+type VolumeHealthStatus struct {
+	// State is Abnormal if any source reports the volume abnormal, Healthy otherwise
+	// +optional
+	State VolumeHealthState `json:"state,omitempty"`
+	// Reason is the reason of the source which decided the state, e.g. VolumeConditionAbnormal or NodeFailed
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is the message of the source which decided the state
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Source is the source which decided the state
+	// +optional
+	Source VolumeHealthSource `json:"source,omitempty"`
+	// LastCheckTime is the time of the last observation of the volume, it may be up to 5 minutes
+	// older while the observations do not change the rest of the status
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+	// ConsecutiveFailures is the number of consecutive observations which found the volume abnormal,
+	// as of LastCheckTime
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+	// Sources are the last observations of each source
+	// +optional
+	// +listType=map
+	// +listMapKey=source
+	Sources []VolumeHealthSourceStatus `json:"sources,omitempty"`
+	// History are the most recent transitions of the state or reason, oldest first
+	// +optional
+	// +listType=atomic
+	History []VolumeHealthTransition `json:"history,omitempty"`
+}
+
+// VolumeHealthSourceStatus is the health of a volume as last observed by one source
+type VolumeHealthSourceStatus struct {
+	// Source is the component which made the observation
+	Source VolumeHealthSource `json:"source"`
+	// State is the health state reported by the source
+	State VolumeHealthState `json:"state"`
+	// Reason is the reason reported by the source
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is the message reported by the source
+	// +optional
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the time the source last changed its observation
+	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
+}
+
+// VolumeHealthTransition is a change of the health state or reason of a volume
+type VolumeHealthTransition struct {
+	// Time is the time of the observation which changed the health
+	Time metav1.Time `json:"time"`
+	// State is the health state after the transition
+	State VolumeHealthState `json:"state"`
+	// Reason is the reason after the transition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// Message is the message of the observation which changed the health
+	// +optional
+	Message string `json:"message,omitempty"`
+	// Source is the component which observed the transition
+	Source VolumeHealthSource `json:"source"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+
+// VolumeHealthList is a list of VolumeHealth objects
+type VolumeHealthList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []VolumeHealth `json:"items"`
+}
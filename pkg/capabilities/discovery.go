@@ -0,0 +1,199 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capabilities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// DriverCapabilities are the plugin and controller capabilities reported by a CSI driver
+type DriverCapabilities struct {
+	Plugin     map[csi.PluginCapability_Service_Type]bool
+	Controller map[csi.ControllerServiceCapability_RPC_Type]bool
+}
+
+// HasPluginService returns true if the driver provides the plugin service
+func (caps DriverCapabilities) HasPluginService(service csi.PluginCapability_Service_Type) bool {
+	return caps.Plugin[service]
+}
+
+// HasControllerRPC returns true if the controller service of the driver supports the RPC
+func (caps DriverCapabilities) HasControllerRPC(rpc csi.ControllerServiceCapability_RPC_Type) bool {
+	return caps.Controller[rpc]
+}
+
+// PluginNames returns the sorted names of the plugin services of the driver
+func (caps DriverCapabilities) PluginNames() []string {
+	names := []string{}
+	for service := range caps.Plugin {
+		names = append(names, service.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ControllerNames returns the sorted names of the controller RPCs supported by the driver
+func (caps DriverCapabilities) ControllerNames() []string {
+	names := []string{}
+	for rpc := range caps.Controller {
+		names = append(names, rpc.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Discoverer fetches the capabilities of a CSI driver with one GetPluginCapabilities and, if the
+// driver provides the controller service, one ControllerGetCapabilities call. Failed discoveries
+// are retried with an exponential backoff. The last result is served as JSON at /capabilities.
+type Discoverer struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+	backoff wait.Backoff
+
+	// used for updating the fields below
+	sync.RWMutex
+	capabilities  *DriverCapabilities
+	lastDiscovery time.Time
+	lastError     error
+}
+
+// NewDiscoverer creates a Discoverer. Each attempt may take up to timeout, failed attempts are
+// retried according to backoff.
+func NewDiscoverer(conn *grpc.ClientConn, timeout time.Duration, backoff wait.Backoff) *Discoverer {
+	return &Discoverer{
+		conn:    conn,
+		timeout: timeout,
+		backoff: backoff,
+	}
+}
+
+// Discover fetches the capabilities of the driver, retrying failed attempts until the backoff is exhausted
+func (discoverer *Discoverer) Discover(ctx context.Context) (DriverCapabilities, error) {
+	logger := klog.FromContext(ctx)
+
+	var caps DriverCapabilities
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, discoverer.backoff, func(ctx context.Context) (bool, error) {
+		caps, lastErr = discoverer.fetch(ctx)
+		if lastErr != nil {
+			logger.V(4).Info("Failed to discover the capabilities of the CSI driver, retrying", "err", lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		if lastErr != nil {
+			err = lastErr
+		}
+		discoverer.Lock()
+		discoverer.lastError = err
+		discoverer.Unlock()
+		return DriverCapabilities{}, fmt.Errorf("failed to discover the capabilities of the CSI driver: %v", err)
+	}
+
+	discoverer.Lock()
+	changed := discoverer.capabilities == nil || !reflect.DeepEqual(*discoverer.capabilities, caps)
+	discoverer.capabilities = &caps
+	discoverer.lastDiscovery = time.Now()
+	discoverer.lastError = nil
+	discoverer.Unlock()
+
+	if changed {
+		logger.Info("Discovered CSI driver capabilities", "plugin", caps.PluginNames(), "controller", caps.ControllerNames())
+	} else {
+		logger.V(4).Info("CSI driver capabilities did not change")
+	}
+	return caps, nil
+}
+
+// fetch calls the capability RPCs of the driver once
+func (discoverer *Discoverer) fetch(ctx context.Context) (DriverCapabilities, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoverer.timeout)
+	defer cancel()
+
+	caps := DriverCapabilities{
+		Plugin:     map[csi.PluginCapability_Service_Type]bool{},
+		Controller: map[csi.ControllerServiceCapability_RPC_Type]bool{},
+	}
+
+	pluginRsp, err := csi.NewIdentityClient(discoverer.conn).GetPluginCapabilities(ctx, &csi.GetPluginCapabilitiesRequest{})
+	if err != nil {
+		return caps, fmt.Errorf("failed to get plugin capabilities: %v", err)
+	}
+	for _, cap := range pluginRsp.GetCapabilities() {
+		if service := cap.GetService(); service != nil {
+			caps.Plugin[service.GetType()] = true
+		}
+	}
+
+	if !caps.Plugin[csi.PluginCapability_Service_CONTROLLER_SERVICE] {
+		return caps, nil
+	}
+
+	controllerRsp, err := csi.NewControllerClient(discoverer.conn).ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		return caps, fmt.Errorf("failed to get controller capabilities: %v", err)
+	}
+	for _, cap := range controllerRsp.GetCapabilities() {
+		if rpc := cap.GetRpc(); rpc != nil {
+			caps.Controller[rpc.GetType()] = true
+		}
+	}
+	return caps, nil
+}
+
+// discoveryStatus is the JSON representation of the last discovery served at /capabilities
+type discoveryStatus struct {
+	Plugin        []string   `json:"plugin"`
+	Controller    []string   `json:"controller"`
+	LastDiscovery *time.Time `json:"lastDiscovery,omitempty"`
+	Error         string     `json:"error,omitempty"`
+}
+
+// ServeHTTP serves the /capabilities endpoint with the last discovered capabilities
+func (discoverer *Discoverer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	discoverer.RLock()
+	status := discoveryStatus{Plugin: []string{}, Controller: []string{}}
+	if discoverer.capabilities != nil {
+		status.Plugin = discoverer.capabilities.PluginNames()
+		status.Controller = discoverer.capabilities.ControllerNames()
+		lastDiscovery := discoverer.lastDiscovery
+		status.LastDiscovery = &lastDiscovery
+	}
+	if discoverer.lastError != nil {
+		status.Error = discoverer.lastError.Error()
+	}
+	discoverer.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, fmt.Sprintf("internal server error: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,117 @@
+package capabilities
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2/ktesting"
+	_ "k8s.io/klog/v2/ktesting/init"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+)
+
+func pluginCapabilities(services ...csi.PluginCapability_Service_Type) *csi.GetPluginCapabilitiesResponse {
+	rsp := &csi.GetPluginCapabilitiesResponse{}
+	for _, service := range services {
+		rsp.Capabilities = append(rsp.Capabilities, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{Service: &csi.PluginCapability_Service{Type: service}},
+		})
+	}
+	return rsp
+}
+
+func controllerCapabilities(rpcs ...csi.ControllerServiceCapability_RPC_Type) *csi.ControllerGetCapabilitiesResponse {
+	rsp := &csi.ControllerGetCapabilitiesResponse{}
+	for _, rpc := range rpcs {
+		rsp.Capabilities = append(rsp.Capabilities, &csi.ControllerServiceCapability{
+			Type: &csi.ControllerServiceCapability_Rpc{Rpc: &csi.ControllerServiceCapability_RPC{Type: rpc}},
+		})
+	}
+	return rsp
+}
+
+func testBackoff() wait.Backoff {
+	return wait.Backoff{Duration: 10 * time.Millisecond, Factor: 2, Steps: 3}
+}
+
+func TestDiscoverer_Discover(t *testing.T) {
+	assert := assert.New(t)
+	_, ctx := ktesting.NewTestContext(t)
+	_, _, identityServer, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+
+	// the first attempt fails, the capabilities are fetched with a single call each afterwards
+	gomock.InOrder(
+		identityServer.EXPECT().GetPluginCapabilities(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "driver is starting")).Times(1),
+		identityServer.EXPECT().GetPluginCapabilities(gomock.Any(), gomock.Any()).Return(pluginCapabilities(csi.PluginCapability_Service_CONTROLLER_SERVICE), nil).Times(1),
+	)
+	controllerServer.EXPECT().ControllerGetCapabilities(gomock.Any(), gomock.Any()).Return(controllerCapabilities(
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+		csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+	), nil).Times(1)
+
+	discoverer := NewDiscoverer(csiConn, time.Second, testBackoff())
+	caps, err := discoverer.Discover(ctx)
+	assert.Nil(err)
+	assert.True(caps.HasPluginService(csi.PluginCapability_Service_CONTROLLER_SERVICE))
+	assert.True(caps.HasControllerRPC(csi.ControllerServiceCapability_RPC_LIST_VOLUMES))
+	assert.True(caps.HasControllerRPC(csi.ControllerServiceCapability_RPC_VOLUME_CONDITION))
+	assert.False(caps.HasControllerRPC(csi.ControllerServiceCapability_RPC_GET_VOLUME))
+	assert.Equal([]string{"LIST_VOLUMES", "VOLUME_CONDITION"}, caps.ControllerNames())
+
+	recorder := httptest.NewRecorder()
+	discoverer.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	var served discoveryStatus
+	assert.Nil(json.Unmarshal(recorder.Body.Bytes(), &served))
+	assert.Equal([]string{"CONTROLLER_SERVICE"}, served.Plugin)
+	assert.Equal([]string{"LIST_VOLUMES", "VOLUME_CONDITION"}, served.Controller)
+	assert.NotNil(served.LastDiscovery)
+	assert.Empty(served.Error)
+}
+
+func TestDiscoverer_WithoutControllerService(t *testing.T) {
+	assert := assert.New(t)
+	_, ctx := ktesting.NewTestContext(t)
+	_, _, identityServer, _, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+
+	// ControllerGetCapabilities is not called
+	identityServer.EXPECT().GetPluginCapabilities(gomock.Any(), gomock.Any()).Return(pluginCapabilities(), nil).Times(1)
+
+	caps, err := NewDiscoverer(csiConn, time.Second, testBackoff()).Discover(ctx)
+	assert.Nil(err)
+	assert.Empty(caps.PluginNames())
+	assert.Empty(caps.ControllerNames())
+}
+
+func TestDiscoverer_Failure(t *testing.T) {
+	assert := assert.New(t)
+	_, ctx := ktesting.NewTestContext(t)
+	_, _, identityServer, _, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+
+	identityServer.EXPECT().GetPluginCapabilities(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.Unavailable, "driver is down")).Times(testBackoff().Steps)
+
+	discoverer := NewDiscoverer(csiConn, time.Second, testBackoff())
+	_, err = discoverer.Discover(ctx)
+	assert.ErrorContains(err, "driver is down")
+
+	recorder := httptest.NewRecorder()
+	discoverer.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/capabilities", nil))
+	var served discoveryStatus
+	assert.Nil(json.Unmarshal(recorder.Body.Bytes(), &served))
+	assert.Empty(served.Controller)
+	assert.Nil(served.LastDiscovery)
+	assert.Contains(served.Error, "driver is down")
+}
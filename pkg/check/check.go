@@ -0,0 +1,213 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package check audits the health of all volumes of a CSI driver once, without sending events
+// or updating any objects, so that it can run next to the health monitor.
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	handler "github.com/kubernetes-csi/external-health-monitor/pkg/csi-handler"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+)
+
+// Health is the health of a volume in a report
+type Health string
+
+const (
+	// HealthHealthy means the driver reported the volume normal
+	HealthHealthy Health = "Healthy"
+	// HealthAbnormal means the driver reported the volume abnormal or it is missing on the backend
+	HealthAbnormal Health = "Abnormal"
+	// HealthUnknown means the volume could not be checked
+	HealthUnknown Health = "Unknown"
+)
+
+// Options configure a check
+type Options struct {
+	DriverName string
+	// Method is metrics.MethodListVolumes or metrics.MethodControllerGetVolume
+	Method string
+	// Timeout limits the ListVolumes pagination or each ControllerGetVolume call
+	Timeout time.Duration
+	// NotFoundGracePeriod is the minimum age of a PV before its volume is abnormal when the backend does not know it
+	NotFoundGracePeriod time.Duration
+	// Classifier maps driver messages to reasons, it can be nil
+	Classifier handler.Classifier
+}
+
+// VolumeResult is the health of the volume of one PV
+type VolumeResult struct {
+	PVCNamespace string `json:"pvcNamespace"`
+	PVCName      string `json:"pvcName"`
+	PVName       string `json:"pvName"`
+	VolumeHandle string `json:"volumeHandle"`
+	Health       Health `json:"health"`
+	Reason       string `json:"reason,omitempty"`
+	Message      string `json:"message,omitempty"`
+}
+
+// Report is the result of a check of all bound volumes of a driver
+type Report struct {
+	Driver  string         `json:"driver"`
+	Method  string         `json:"method"`
+	Volumes []VolumeResult `json:"volumes"`
+}
+
+// Healthy returns true if all volumes were checked and are healthy
+func (report *Report) Healthy() bool {
+	for _, volume := range report.Volumes {
+		if volume.Health != HealthHealthy {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTable writes the report as a table with one volume per line
+func (report *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tPVC\tPV\tVOLUME HANDLE\tHEALTH\tREASON\tMESSAGE")
+	for _, volume := range report.Volumes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", volume.PVCNamespace, volume.PVCName, volume.PVName, volume.VolumeHandle, volume.Health, volume.Reason, volume.Message)
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as indented JSON
+func (report *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// Run checks all bound volumes of the driver once with a read-only PVHealthConditionChecker
+func Run(ctx context.Context, client kubernetes.Interface, conn *grpc.ClientConn, options Options) (*Report, error) {
+	if options.Method != metrics.MethodListVolumes && options.Method != metrics.MethodControllerGetVolume {
+		return nil, fmt.Errorf("unknown check method %q", options.Method)
+	}
+
+	factory := informers.NewSharedInformerFactory(client, 0)
+	pvInformer := factory.Core().V1().PersistentVolumes()
+	pvcInformer := factory.Core().V1().PersistentVolumeClaims()
+	pvSynced := pvInformer.Informer().HasSynced
+	pvcSynced := pvcInformer.Informer().HasSynced
+	informerCtx, cancel := context.WithCancel(ctx)
+	factory.Start(informerCtx.Done())
+	defer factory.Shutdown()
+	defer cancel()
+	if !cache.WaitForCacheSync(ctx.Done(), pvSynced, pvcSynced) {
+		return nil, fmt.Errorf("failed to sync the PV and PVC caches: %v", ctx.Err())
+	}
+
+	// a single miss reports a volume as not found, events are dropped by the recorder and the
+	// checker does not update anything
+	checker := handler.NewPVHealthConditionChecker(options.DriverName, conn, client, options.Timeout,
+		pvcInformer.Lister(), pvInformer.Lister(), factory.Core().V1().Events(), &record.FakeRecorder{},
+		&handler.PVHealthConditionCheckerOptions{
+			NotFoundGracePeriod: options.NotFoundGracePeriod,
+			NotFoundThreshold:   1,
+			Classifier:          options.Classifier,
+		})
+	checker.SetReadOnly(true)
+
+	pvs, err := pvInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pvs = boundVolumes(pvs, options.DriverName)
+
+	logger := klog.FromContext(ctx)
+	checkErrors := map[string]error{}
+	if options.Method == metrics.MethodListVolumes {
+		if err := checker.CheckControllerListVolumeStatuses(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, pv := range pvs {
+			if err := checker.CheckControllerVolumeStatus(ctx, pv); err != nil {
+				logger.V(2).Info("Failed to check volume", "pv", pv.Name, "err", err)
+				checkErrors[pv.Name] = err
+			}
+		}
+	}
+
+	records := map[string]handler.VolumeHealthRecord{}
+	for _, record := range checker.VolumeHealthRecords() {
+		records[record.VolumeHandle] = record
+	}
+
+	report := &Report{Driver: options.DriverName, Method: options.Method, Volumes: []VolumeResult{}}
+	for _, pv := range pvs {
+		result := VolumeResult{
+			PVCNamespace: pv.Spec.ClaimRef.Namespace,
+			PVCName:      pv.Spec.ClaimRef.Name,
+			PVName:       pv.Name,
+			VolumeHandle: pv.Spec.CSI.VolumeHandle,
+			Health:       HealthUnknown,
+		}
+		if record, ok := records[result.VolumeHandle]; ok {
+			result.Health = HealthHealthy
+			if record.State == handler.VolumeHealthAbnormal {
+				result.Health = HealthAbnormal
+			}
+			result.Reason = record.Reason
+			result.Message = record.Message
+		} else if err := checkErrors[pv.Name]; err != nil {
+			result.Message = err.Error()
+		} else {
+			result.Message = "Volume was not found by the driver, it may still be provisioned"
+		}
+		report.Volumes = append(report.Volumes, result)
+	}
+	sort.Slice(report.Volumes, func(i, j int) bool {
+		a, b := report.Volumes[i], report.Volumes[j]
+		if a.PVCNamespace != b.PVCNamespace {
+			return a.PVCNamespace < b.PVCNamespace
+		}
+		return a.PVCName < b.PVCName
+	})
+	return report, nil
+}
+
+// boundVolumes returns the bound PVs of the driver
+func boundVolumes(pvs []*v1.PersistentVolume, driverName string) []*v1.PersistentVolume {
+	var bound []*v1.PersistentVolume
+	for _, pv := range pvs {
+		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName || pv.Spec.ClaimRef == nil || pv.Status.Phase != v1.VolumeBound {
+			continue
+		}
+		bound = append(bound, pv)
+	}
+	return bound
+}
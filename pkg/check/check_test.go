@@ -0,0 +1,122 @@
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2/ktesting"
+	_ "k8s.io/klog/v2/ktesting/init"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newVolumes returns three bound PVs with the volume handles volume1 to volume3 and their PVCs
+func newVolumes() []runtime.Object {
+	var objects []runtime.Object
+	for _, name := range []string{"1", "2", "3"} {
+		objects = append(objects,
+			mock.CreatePV(2, "pvc"+name, "pv"+name, mock.DefaultNS, "volume"+name, types.UID("uid"+name), &mock.FSVolumeMode, v1.VolumeBound),
+			mock.CreatePVC(1, 2, "pvc"+name, "uid"+name, mock.DefaultNS, "pv"+name, v1.ClaimBound),
+		)
+	}
+	return objects
+}
+
+func volumeEntry(id string, abnormal bool, message string) *csi.ListVolumesResponse_Entry {
+	return &csi.ListVolumesResponse_Entry{
+		Volume: &csi.Volume{VolumeId: id},
+		Status: &csi.ListVolumesResponse_VolumeStatus{
+			VolumeCondition: &csi.VolumeCondition{Abnormal: abnormal, Message: message},
+		},
+	}
+}
+
+func TestRun_ListVolumes(t *testing.T) {
+	assert := assert.New(t)
+	_, ctx := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset(newVolumes()...)
+	_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+
+	controllerServer.EXPECT().ListVolumes(gomock.Any(), gomock.Any()).Return(&csi.ListVolumesResponse{
+		Entries: []*csi.ListVolumesResponse_Entry{
+			volumeEntry("volume1", false, ""),
+			volumeEntry("volume2", true, "disk failure"),
+		},
+	}, nil).Times(1)
+
+	report, err := Run(ctx, client, csiConn, Options{
+		DriverName: mock.DriverName,
+		Method:     metrics.MethodListVolumes,
+		Timeout:    time.Second,
+	})
+	assert.Nil(err)
+	assert.False(report.Healthy())
+	assert.Equal([]VolumeResult{
+		{PVCNamespace: mock.DefaultNS, PVCName: "pvc1", PVName: "pv1", VolumeHandle: "volume1", Health: HealthHealthy, Reason: ""},
+		{PVCNamespace: mock.DefaultNS, PVCName: "pvc2", PVName: "pv2", VolumeHandle: "volume2", Health: HealthAbnormal, Reason: "VolumeConditionAbnormal", Message: "disk failure"},
+		{PVCNamespace: mock.DefaultNS, PVCName: "pvc3", PVName: "pv3", VolumeHandle: "volume3", Health: HealthAbnormal, Reason: "VolumeNotFoundOnBackend", Message: "Volume volume3 is not found on the storage backend"},
+	}, report.Volumes)
+
+	// the check is read-only
+	for _, action := range client.Actions() {
+		assert.Contains([]string{"list", "watch"}, action.GetVerb())
+	}
+
+	var table bytes.Buffer
+	assert.Nil(report.WriteTable(&table))
+	assert.Contains(table.String(), "pvc2  pv2  volume2        Abnormal  VolumeConditionAbnormal  disk failure")
+
+	var decoded Report
+	var encoded bytes.Buffer
+	assert.Nil(report.WriteJSON(&encoded))
+	assert.Nil(json.Unmarshal(encoded.Bytes(), &decoded))
+	assert.Equal(*report, decoded)
+}
+
+func TestRun_ControllerGetVolume(t *testing.T) {
+	assert := assert.New(t)
+	_, ctx := ktesting.NewTestContext(t)
+	client := fake.NewSimpleClientset(newVolumes()...)
+	_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+
+	controllerServer.EXPECT().ControllerGetVolume(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+			if req.VolumeId == "volume3" {
+				return nil, status.Error(codes.Unavailable, "backend is down")
+			}
+			return &csi.ControllerGetVolumeResponse{
+				Volume: &csi.Volume{VolumeId: req.VolumeId},
+				Status: &csi.ControllerGetVolumeResponse_VolumeStatus{VolumeCondition: &csi.VolumeCondition{}},
+			}, nil
+		}).Times(3)
+
+	report, err := Run(ctx, client, csiConn, Options{
+		DriverName: mock.DriverName,
+		Method:     metrics.MethodControllerGetVolume,
+		Timeout:    time.Second,
+	})
+	assert.Nil(err)
+	assert.False(report.Healthy())
+	assert.Len(report.Volumes, 3)
+	assert.Equal(HealthHealthy, report.Volumes[0].Health)
+	assert.Equal(HealthHealthy, report.Volumes[1].Health)
+	assert.Equal(HealthUnknown, report.Volumes[2].Health)
+	assert.Contains(report.Volumes[2].Message, "backend is down")
+
+	report.Volumes = report.Volumes[:2]
+	assert.True(report.Healthy())
+}
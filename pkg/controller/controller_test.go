@@ -1,13 +1,30 @@
 package pv_monitor_controller
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	k8smetrics "k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+	"k8s.io/klog/v2/ktesting"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-csi/csi-test/v5/utils"
+	handler "github.com/kubernetes-csi/external-health-monitor/pkg/csi-handler"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func Test_AbnormalVolumeWithoutNodeWatcher(t *testing.T) {
@@ -253,3 +270,281 @@ func Test_RecoveryEventWithoutListVolume(t *testing.T) {
 
 	runTest(t, testCase)
 }
+
+func Test_PVQueueSchedulesNextCheck(t *testing.T) {
+	tests := []struct {
+		name             string
+		abnormal         bool
+		checkErr         error
+		wantRequeues     int
+		wantNextCheckDue time.Duration
+	}{
+		{
+			name:             "healthy volume is checked after monitor interval",
+			wantNextCheckDue: time.Second,
+		},
+		{
+			name:             "abnormal volume is checked after unhealthy monitor interval",
+			abnormal:         true,
+			wantNextCheckDue: 200 * time.Millisecond,
+		},
+		{
+			name:         "failed check is retried with backoff",
+			checkErr:     status.Error(codes.Unavailable, "backend unavailable"),
+			wantRequeues: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumeBound)
+			pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+			client := fake.NewSimpleClientset(pv, pvc)
+			factory := informers.NewSharedInformerFactory(client, 0)
+			assert.Nil(factory.Core().V1().PersistentVolumes().Informer().GetStore().Add(pv))
+			assert.Nil(factory.Core().V1().PersistentVolumeClaims().Informer().GetStore().Add(pvc))
+
+			_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+			assert.Nil(err)
+			in := &csi.ControllerGetVolumeRequest{VolumeId: "volume1"}
+			if tt.checkErr != nil {
+				controllerServer.EXPECT().ControllerGetVolume(gomock.Any(), utils.Protobuf(in)).Return(nil, tt.checkErr).Times(1)
+			} else {
+				out := &csi.ControllerGetVolumeResponse{
+					Volume: &csi.Volume{VolumeId: "volume1"},
+					Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+						VolumeCondition: &csi.VolumeCondition{Abnormal: tt.abnormal, Message: "message"},
+					},
+				}
+				controllerServer.EXPECT().ControllerGetVolume(gomock.Any(), utils.Protobuf(in)).Return(out, nil).Times(1)
+			}
+
+			logger, ctx := ktesting.NewTestContext(t)
+			ctrl, err := NewPVMonitorController(logger, client, csiConn, factory, &record.FakeRecorder{Events: make(chan string, 10)}, &PVMonitorOptions{
+				DriverName:                       "fake.csi.driver.io",
+				ContextTimeout:                   15 * time.Second,
+				PVWorkerExecuteInterval:          time.Second,
+				UnhealthyPVWorkerExecuteInterval: 200 * time.Millisecond,
+				RetryIntervalStart:               time.Minute,
+				RetryIntervalMax:                 5 * time.Minute,
+			})
+			assert.Nil(err)
+			defer ctrl.pvQueue.ShutDown()
+
+			assert.Nil(ctrl.AddPVsToQueue())
+			item := pvQueueItem{name: pv.Name, generation: ctrl.pvEnqueued[pv.Name]}
+			assert.True(ctrl.processNextPV(ctx))
+			assert.Equal(tt.wantRequeues, ctrl.pvQueue.NumRequeues(item))
+			assert.Equal(0, ctrl.pvQueue.Len(), "the PV must not be checked again immediately")
+
+			if tt.wantNextCheckDue > 0 {
+				assert.Never(func() bool { return ctrl.pvQueue.Len() > 0 }, tt.wantNextCheckDue/2, 10*time.Millisecond)
+				assert.Eventually(func() bool { return ctrl.pvQueue.Len() == 1 }, tt.wantNextCheckDue, 10*time.Millisecond)
+			}
+		})
+	}
+}
+
+func Test_AddPVsToQueueSkipsUnboundPVs(t *testing.T) {
+	assert := assert.New(t)
+	bound := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumeBound)
+	available := mock.CreatePV(2, "", "available", mock.DefaultNS, "volume2", "", &mock.FSVolumeMode, v1.VolumeAvailable)
+	available.Spec.ClaimRef = nil
+	released := mock.CreatePV(2, "deleted", "released", mock.DefaultNS, "volume3", "deleteduid", &mock.FSVolumeMode, v1.VolumeReleased)
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	for _, pv := range []*v1.PersistentVolume{bound, available, released} {
+		assert.Nil(factory.Core().V1().PersistentVolumes().Informer().GetStore().Add(pv))
+	}
+
+	_, _, _, _, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+	registry := k8smetrics.NewKubeRegistry()
+	metricsRecorder := metrics.NewRecorder("fake.csi.driver.io")
+	metricsRecorder.Register(registry)
+
+	logger, _ := ktesting.NewTestContext(t)
+	ctrl, err := NewPVMonitorController(logger, client, csiConn, factory, &record.FakeRecorder{Events: make(chan string, 10)}, &PVMonitorOptions{
+		DriverName:              "fake.csi.driver.io",
+		ContextTimeout:          15 * time.Second,
+		PVWorkerExecuteInterval: time.Minute,
+		RetryIntervalStart:      time.Second,
+		RetryIntervalMax:        5 * time.Minute,
+		MetricsRecorder:         metricsRecorder,
+	})
+	assert.Nil(err)
+	defer ctrl.pvQueue.ShutDown()
+
+	assert.Nil(ctrl.AddPVsToQueue())
+	assert.Equal(1, ctrl.pvQueue.Len())
+	assert.Contains(ctrl.pvEnqueued, bound.Name)
+	want := `
+# HELP csi_volume_health_volumes_checked [ALPHA] Number of volumes checked in the last check round.
+# TYPE csi_volume_health_volumes_checked gauge
+csi_volume_health_volumes_checked{driver="fake.csi.driver.io",method="ControllerGetVolume"} 1
+`
+	assert.Nil(testutil.GatherAndCompare(registry, strings.NewReader(want), "csi_volume_health_volumes_checked"))
+}
+
+func Test_PVInformerEvents(t *testing.T) {
+	assert := assert.New(t)
+	pending := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumePending)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+	client := fake.NewSimpleClientset(pvc)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	assert.Nil(factory.Core().V1().PersistentVolumeClaims().Informer().GetStore().Add(pvc))
+
+	_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+	in := &csi.ControllerGetVolumeRequest{VolumeId: "volume1"}
+	out := &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{VolumeId: "volume1"},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: &csi.VolumeCondition{Abnormal: true, Message: "message"},
+		},
+	}
+	controllerServer.EXPECT().ControllerGetVolume(gomock.Any(), utils.Protobuf(in)).Return(out, nil).AnyTimes()
+
+	logger, ctx := ktesting.NewTestContext(t)
+	ctrl, err := NewPVMonitorController(logger, client, csiConn, factory, &record.FakeRecorder{Events: make(chan string, 10)}, &PVMonitorOptions{
+		DriverName:              "fake.csi.driver.io",
+		ContextTimeout:          15 * time.Second,
+		PVWorkerExecuteInterval: time.Minute,
+		RetryIntervalStart:      time.Second,
+		RetryIntervalMax:        5 * time.Minute,
+	})
+	assert.Nil(err)
+	defer ctrl.pvQueue.ShutDown()
+
+	// a pending PV is not checked
+	ctrl.pvAdded(pending)
+	assert.Equal(0, ctrl.pvQueue.Len())
+
+	// the PV is checked as soon as it becomes bound
+	bound := pending.DeepCopy()
+	bound.Status.Phase = v1.VolumeBound
+	assert.Nil(factory.Core().V1().PersistentVolumes().Informer().GetStore().Add(bound))
+	ctrl.pvUpdated(pending, bound)
+	assert.Equal(1, ctrl.pvQueue.Len())
+	assert.True(ctrl.processNextPV(ctx))
+	assert.True(ctrl.pvChecker.IsVolumeAbnormal(bound))
+
+	// releasing the PV drops its state
+	released := bound.DeepCopy()
+	released.Status.Phase = v1.VolumeReleased
+	ctrl.pvUpdated(bound, released)
+	assert.NotContains(ctrl.pvEnqueued, bound.Name)
+	assert.False(ctrl.pvChecker.IsVolumeAbnormal(bound))
+
+	// deleting the PV drops its state, also when only a tombstone is received
+	ctrl.pvUpdated(released, bound)
+	assert.Contains(ctrl.pvEnqueued, bound.Name)
+	ctrl.pvDeleted(cache.DeletedFinalStateUnknown{Key: bound.Name, Obj: bound})
+	assert.NotContains(ctrl.pvEnqueued, bound.Name)
+}
+
+func Test_PVRecreatedWhileCheckIsScheduled(t *testing.T) {
+	assert := assert.New(t)
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+	client := fake.NewSimpleClientset(pv, pvc)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	assert.Nil(factory.Core().V1().PersistentVolumes().Informer().GetStore().Add(pv))
+	assert.Nil(factory.Core().V1().PersistentVolumeClaims().Informer().GetStore().Add(pvc))
+
+	_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+	in := &csi.ControllerGetVolumeRequest{VolumeId: "volume1"}
+	out := &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{VolumeId: "volume1"},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: &csi.VolumeCondition{Message: "message"},
+		},
+	}
+	// the PV is checked once before and once after it is recreated, the check scheduled before is dropped
+	controllerServer.EXPECT().ControllerGetVolume(gomock.Any(), utils.Protobuf(in)).Return(out, nil).Times(2)
+
+	logger, ctx := ktesting.NewTestContext(t)
+	ctrl, err := NewPVMonitorController(logger, client, csiConn, factory, &record.FakeRecorder{Events: make(chan string, 10)}, &PVMonitorOptions{
+		DriverName:              "fake.csi.driver.io",
+		ContextTimeout:          15 * time.Second,
+		PVWorkerExecuteInterval: 100 * time.Millisecond,
+		RetryIntervalStart:      time.Second,
+		RetryIntervalMax:        5 * time.Minute,
+	})
+	assert.Nil(err)
+	defer ctrl.pvQueue.ShutDown()
+
+	ctrl.pvAdded(pv)
+	assert.True(ctrl.processNextPV(ctx))
+
+	// the PV is deleted and created again with the same name before its next check is due
+	ctrl.pvDeleted(pv)
+	ctrl.pvAdded(pv)
+	generation := ctrl.pvEnqueued[pv.Name]
+	assert.True(ctrl.processNextPV(ctx))
+
+	// the check scheduled before the deletion is due first and dropped
+	assert.Eventually(func() bool { return ctrl.pvQueue.Len() > 0 }, time.Second, 10*time.Millisecond)
+	assert.True(ctrl.processNextPV(ctx))
+	assert.Equal(generation, ctrl.pvEnqueued[pv.Name])
+}
+
+func Test_PVQueueFollowsCapabilities(t *testing.T) {
+	assert := assert.New(t)
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+	client := fake.NewSimpleClientset(pv, pvc)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	assert.Nil(factory.Core().V1().PersistentVolumes().Informer().GetStore().Add(pv))
+	assert.Nil(factory.Core().V1().PersistentVolumeClaims().Informer().GetStore().Add(pvc))
+
+	_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+	in := &csi.ControllerGetVolumeRequest{VolumeId: "volume1"}
+	out := &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{VolumeId: "volume1"},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: &csi.VolumeCondition{Abnormal: true, Message: "message"},
+		},
+	}
+	controllerServer.EXPECT().ControllerGetVolume(gomock.Any(), utils.Protobuf(in)).Return(out, nil).Times(1)
+
+	// the driver does not implement VolumeCondition yet
+	detected := handler.Capabilities{ControllerService: true, GetVolume: true}
+	capabilities := handler.NewCapabilitiesMonitor(detected, func(ctx context.Context) (handler.Capabilities, error) {
+		return detected, nil
+	}, 0)
+
+	logger, ctx := ktesting.NewTestContext(t)
+	ctrl, err := NewPVMonitorController(logger, client, csiConn, factory, &record.FakeRecorder{Events: make(chan string, 10)}, &PVMonitorOptions{
+		DriverName:              "fake.csi.driver.io",
+		ContextTimeout:          15 * time.Second,
+		Capabilities:            capabilities,
+		PVWorkerExecuteInterval: time.Minute,
+		RetryIntervalStart:      time.Second,
+		RetryIntervalMax:        5 * time.Minute,
+	})
+	assert.Nil(err)
+	defer ctrl.pvQueue.ShutDown()
+
+	// the controller idles instead of checking volumes
+	ctrl.pvAdded(pv)
+	assert.True(ctrl.processNextPV(ctx))
+	assert.NotContains(ctrl.pvEnqueued, pv.Name)
+	assert.Nil(ctrl.AddPVsToQueue())
+	assert.Equal(0, ctrl.pvQueue.Len())
+
+	// the upgraded driver implements VolumeCondition
+	detected.VolumeCondition = true
+	assert.Nil(capabilities.Refresh(ctx))
+	assert.Nil(ctrl.AddPVsToQueue())
+	assert.True(ctrl.processNextPV(ctx))
+	assert.True(ctrl.pvChecker.IsVolumeAbnormal(pv))
+
+	// ListVolumes is preferred once the driver supports it
+	detected.ListVolumes = true
+	assert.Nil(capabilities.Refresh(ctx))
+	assert.True(ctrl.useListVolumes())
+	assert.False(ctrl.useGetVolume())
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pv_monitor_controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	handler "github.com/kubernetes-csi/external-health-monitor/pkg/csi-handler"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+)
+
+// checkMethodNone is served as check method while volumes are not checked
+const checkMethodNone = "None"
+
+// debugVolume is the last known health of a volume served at /debug/volumes
+type debugVolume struct {
+	VolumeHandle       string    `json:"volumeHandle"`
+	PV                 string    `json:"pv"`
+	Namespace          string    `json:"namespace"`
+	PVC                string    `json:"pvc"`
+	State              string    `json:"state"`
+	Message            string    `json:"message,omitempty"`
+	Reason             string    `json:"reason,omitempty"`
+	Severity           string    `json:"severity,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+	LastCheckTime      time.Time `json:"lastCheckTime"`
+	AttachmentDrift    string    `json:"attachmentDrift,omitempty"`
+}
+
+// debugNodes is the node watcher state served at /debug/nodes
+type debugNodes struct {
+	Enabled bool        `json:"enabled"`
+	Nodes   []nodeState `json:"nodes"`
+}
+
+// debugQueue is the PV queue state served at /debug/queue
+type debugQueue struct {
+	// CheckMethod is the method volumes are currently checked with
+	CheckMethod string `json:"checkMethod"`
+	// Length is the number of PVs waiting to be checked now, PVs waiting for their next check are not included
+	Length int `json:"length"`
+	// Enqueued is the number of PVs which are checked periodically
+	Enqueued int `json:"enqueued"`
+}
+
+// RegisterDebugHandlers serves the live state of the controller as JSON on the mux. The state
+// is only filled on the leader, other replicas do not check volumes.
+func (ctrl *PVMonitorController) RegisterDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /debug/volumes", ctrl.serveDebugVolumes)
+	mux.HandleFunc("GET /debug/volumes/{namespace}/{pvc}", ctrl.serveDebugVolume)
+	mux.HandleFunc("GET /debug/nodes", ctrl.serveDebugNodes)
+	mux.HandleFunc("GET /debug/queue", ctrl.serveDebugQueue)
+}
+
+func (ctrl *PVMonitorController) serveDebugVolumes(w http.ResponseWriter, _ *http.Request) {
+	volumes := []debugVolume{}
+	for _, record := range ctrl.pvChecker.VolumeHealthRecords() {
+		volumes = append(volumes, newDebugVolume(record))
+	}
+	writeJSON(w, volumes)
+}
+
+func (ctrl *PVMonitorController) serveDebugVolume(w http.ResponseWriter, r *http.Request) {
+	namespace, pvc := r.PathValue("namespace"), r.PathValue("pvc")
+	for _, record := range ctrl.pvChecker.VolumeHealthRecords() {
+		if record.PVCNamespace == namespace && record.PVCName == pvc {
+			writeJSON(w, newDebugVolume(record))
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("volume of PVC %s/%s was not checked", namespace, pvc), http.StatusNotFound)
+}
+
+func (ctrl *PVMonitorController) serveDebugNodes(w http.ResponseWriter, _ *http.Request) {
+	nodes := debugNodes{Enabled: ctrl.enableNodeWatcher, Nodes: []nodeState{}}
+	if ctrl.nodeWatcher != nil {
+		nodes.Nodes = ctrl.nodeWatcher.nodeStates.snapshot()
+	}
+	writeJSON(w, nodes)
+}
+
+func (ctrl *PVMonitorController) serveDebugQueue(w http.ResponseWriter, _ *http.Request) {
+	queue := debugQueue{CheckMethod: checkMethodNone, Length: ctrl.pvQueue.Len()}
+	switch {
+	case ctrl.useListVolumes():
+		queue.CheckMethod = metrics.MethodListVolumes
+	case ctrl.useGetVolume():
+		queue.CheckMethod = metrics.MethodControllerGetVolume
+	}
+
+	ctrl.Lock()
+	queue.Enqueued = len(ctrl.pvEnqueued)
+	ctrl.Unlock()
+	writeJSON(w, queue)
+}
+
+func newDebugVolume(record handler.VolumeHealthRecord) debugVolume {
+	return debugVolume{
+		VolumeHandle:       record.VolumeHandle,
+		PV:                 record.PVName,
+		Namespace:          record.PVCNamespace,
+		PVC:                record.PVCName,
+		State:              string(record.State),
+		Message:            record.Message,
+		Reason:             record.Reason,
+		Severity:           string(record.Severity),
+		LastTransitionTime: record.LastTransitionTime,
+		LastCheckTime:      record.LastCheckTime,
+		AttachmentDrift:    record.AttachmentDrift,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, fmt.Sprintf("internal server error: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,102 @@
+package pv_monitor_controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/ktesting"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-csi/csi-test/v5/utils"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func getDebugEndpoint(t *testing.T, mux *http.ServeMux, path string, v interface{}) int {
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if recorder.Code == http.StatusOK {
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), v))
+	}
+	return recorder.Code
+}
+
+func Test_DebugHandlers(t *testing.T) {
+	assert := assert.New(t)
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+	client := fake.NewSimpleClientset(pv, pvc)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	assert.Nil(factory.Core().V1().PersistentVolumes().Informer().GetStore().Add(pv))
+	assert.Nil(factory.Core().V1().PersistentVolumeClaims().Informer().GetStore().Add(pvc))
+
+	_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+	in := &csi.ControllerGetVolumeRequest{VolumeId: "volume1"}
+	out := &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{VolumeId: "volume1"},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: &csi.VolumeCondition{Abnormal: true, Message: "Volume not found"},
+		},
+	}
+	controllerServer.EXPECT().ControllerGetVolume(gomock.Any(), utils.Protobuf(in)).Return(out, nil).Times(1)
+
+	logger, ctx := ktesting.NewTestContext(t)
+	ctrl, err := NewPVMonitorController(logger, client, csiConn, factory, &record.FakeRecorder{Events: make(chan string, 10)}, &PVMonitorOptions{
+		DriverName:                "fake.csi.driver.io",
+		ContextTimeout:            15 * time.Second,
+		EnableNodeWatcher:         true,
+		PVWorkerExecuteInterval:   time.Minute,
+		RetryIntervalStart:        time.Second,
+		RetryIntervalMax:          5 * time.Minute,
+		NodeWorkerExecuteInterval: time.Minute,
+		NodeListAndAddInterval:    5 * time.Minute,
+		NodeFailureCriteria:       NodeFailureCriteria{GracePeriod: DefaultNodeNotReadyTimeDuration},
+	})
+	assert.Nil(err)
+	defer ctrl.pvQueue.ShutDown()
+	mux := http.NewServeMux()
+	ctrl.RegisterDebugHandlers(mux)
+
+	assert.Nil(ctrl.AddPVsToQueue())
+	var queue debugQueue
+	assert.Equal(http.StatusOK, getDebugEndpoint(t, mux, "/debug/queue", &queue))
+	assert.Equal(debugQueue{CheckMethod: metrics.MethodControllerGetVolume, Length: 1, Enqueued: 1}, queue)
+
+	var volumes []debugVolume
+	assert.Equal(http.StatusOK, getDebugEndpoint(t, mux, "/debug/volumes", &volumes))
+	assert.Empty(volumes)
+	assert.Equal(http.StatusNotFound, getDebugEndpoint(t, mux, "/debug/volumes/"+mock.DefaultNS+"/pvc", nil))
+
+	assert.True(ctrl.processNextPV(ctx))
+	assert.Equal(http.StatusOK, getDebugEndpoint(t, mux, "/debug/volumes", &volumes))
+	assert.Len(volumes, 1)
+	var volume debugVolume
+	assert.Equal(http.StatusOK, getDebugEndpoint(t, mux, "/debug/volumes/"+mock.DefaultNS+"/pvc", &volume))
+	assert.Equal("volume1", volume.VolumeHandle)
+	assert.Equal("pv", volume.PV)
+	assert.Equal("Abnormal", volume.State)
+	assert.Equal("Volume not found", volume.Message)
+	assert.Equal("VolumeConditionAbnormal", volume.Reason)
+
+	now := time.Now()
+	ctrl.nodeWatcher.nodeStates.failingSince("node1", now)
+	ctrl.nodeWatcher.nodeStates.markDown("node2")
+	var nodes debugNodes
+	assert.Equal(http.StatusOK, getDebugEndpoint(t, mux, "/debug/nodes", &nodes))
+	assert.True(nodes.Enabled)
+	assert.Len(nodes.Nodes, 2)
+	assert.Equal("node1", nodes.Nodes[0].Name)
+	assert.True(now.Equal(*nodes.Nodes[0].FailingSince))
+	assert.False(nodes.Nodes[0].MarkedDown)
+	assert.Equal(nodeState{Name: "node2", MarkedDown: true}, nodes.Nodes[1])
+}
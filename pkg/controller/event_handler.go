@@ -18,25 +18,53 @@ package pv_monitor_controller
 
 import (
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
 )
 
 func (ctrl *PVMonitorController) pvAdded(obj interface{}) {
 	pv := obj.(*v1.PersistentVolume)
-	if pv.Status.Phase != v1.VolumeBound || pv.Spec.CSI == nil || pv.Spec.CSI.Driver != ctrl.driverName {
+	if pv.Status.Phase != v1.VolumeBound || !ctrl.isDriverPV(pv) {
 		return
 	}
 
-	ctrl.Lock()
-	defer ctrl.Unlock()
+	ctrl.enqueuePV(pv.Name)
+}
 
-	ctrl.pvQueue.Add(pv.Name)
-	ctrl.pvEnqueued[pv.Name] = true
+func (ctrl *PVMonitorController) pvUpdated(oldObj, newObj interface{}) {
+	oldPV := oldObj.(*v1.PersistentVolume)
+	newPV := newObj.(*v1.PersistentVolume)
+	if !ctrl.isDriverPV(newPV) || oldPV.Status.Phase == newPV.Status.Phase {
+		return
+	}
+
+	switch {
+	case newPV.Status.Phase == v1.VolumeBound:
+		ctrl.enqueuePV(newPV.Name)
+	case oldPV.Status.Phase == v1.VolumeBound:
+		// the claim was released, the volume is not checked anymore
+		ctrl.forgetPV(newPV)
+	}
 }
 
-func (ctrl *PVMonitorController) podAdded(obj interface{}) {
-	ctrl.pvcToPodsCache.AddPod(obj.(*v1.Pod))
+func (ctrl *PVMonitorController) pvDeleted(obj interface{}) {
+	pv, ok := obj.(*v1.PersistentVolume)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		pv, ok = tombstone.Obj.(*v1.PersistentVolume)
+		if !ok {
+			return
+		}
+	}
+	if !ctrl.isDriverPV(pv) {
+		return
+	}
+
+	ctrl.forgetPV(pv)
 }
 
-func (ctrl *PVMonitorController) podDeleted(obj interface{}) {
-	ctrl.pvcToPodsCache.DeletePod(obj.(*v1.Pod))
+func (ctrl *PVMonitorController) isDriverPV(pv *v1.PersistentVolume) bool {
+	return pv.Spec.CSI != nil && pv.Spec.CSI.Driver == ctrl.driverName
 }
@@ -5,9 +5,12 @@ import (
 	"testing"
 	"time"
 
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2/ktesting"
 	_ "k8s.io/klog/v2/ktesting/init"
@@ -17,6 +20,7 @@ import (
 	"github.com/kubernetes-csi/csi-test/v5/driver"
 	"github.com/kubernetes-csi/csi-test/v5/utils"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,7 +70,10 @@ func runTest(t *testing.T, tc *testCase) {
 		VolumeListAndAddInterval:  5 * time.Minute,
 		NodeWorkerExecuteInterval: 1 * time.Minute,
 		NodeListAndAddInterval:    5 * time.Minute,
+		NodeFailureCriteria:       NodeFailureCriteria{GracePeriod: DefaultNodeNotReadyTimeDuration},
 		SupportListVolume:         tc.supportListVolumes,
+		RetryIntervalStart:        time.Second,
+		RetryIntervalMax:          5 * time.Minute,
 	}
 
 	_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
@@ -94,8 +101,8 @@ func runTest(t *testing.T, tc *testCase) {
 
 	logger, ctx := ktesting.NewTestContext(t)
 	mockCSIcontrollerServer(controllerServer, tc.supportListVolumes, volumes)
-	pvMonitorController := NewPVMonitorController(logger, client, csiConn, informers, &eventRecorder, option)
-	assert.NotNil(pvMonitorController)
+	pvMonitorController, err := NewPVMonitorController(logger, client, csiConn, informers, &eventRecorder, option)
+	assert.Nil(err)
 
 	if tc.hasRecoveryEvent {
 		err = eventInformer.Informer().GetStore().Add(tc.fakeNativeObjects.MockEvent.NativeEvent)
@@ -157,3 +164,99 @@ func mockCSIcontrollerServer(csiControllerServer *driver.MockControllerServer, s
 		}
 	}
 }
+
+// runNodeDeletionTest deletes a node with a Pod using a volume of the driver while the node watcher runs
+// and returns the events sent for it
+// newPVCToPodsCache returns a PVCToPodsCache on a pod informer which is not started, with the pods in its store
+func newPVCToPodsCache(tb testing.TB, pods ...*v1.Pod) (*util.PVCToPodsCache, cache.Store) {
+	podInformer := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0).Core().V1().Pods().Informer()
+	pvcToPodsCache, err := util.NewPVCToPodsCache(podInformer)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, pod := range pods {
+		addPod(tb, podInformer.GetStore(), pod)
+	}
+	return pvcToPodsCache, podInformer.GetStore()
+}
+
+// addPod adds the pod to the store of a pod informer like the informer would
+func addPod(tb testing.TB, podStore cache.Store, pod *v1.Pod) {
+	if err := podStore.Add(pod); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func runNodeDeletionTest(t *testing.T, deleteFunc func(watcher *NodeWatcher, client *fake.Clientset, node *v1.Node)) []string {
+	assert := assert.New(t)
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+	node := mock.CreateNode("node1", "")
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	client := fake.NewSimpleClientset(pv, pvc, node)
+	informers := informers.NewSharedInformerFactory(client, 0)
+
+	pvcToPodsCache, _ := newPVCToPodsCache(t, mock.CreatePod("pod1", mock.DefaultNS, "data", "pvc", "node1", "pod1uid", false))
+
+	eventStore := make(chan string, 10)
+	logger, ctx := ktesting.NewTestContext(t)
+	watcher, err := NewNodeWatcher(
+		logger,
+		"fake.csi.driver.io",
+		client,
+		informers.Core().V1().PersistentVolumes().Lister(),
+		informers.Core().V1().PersistentVolumeClaims().Lister(),
+		informers.Core().V1().Nodes(),
+		&record.FakeRecorder{Events: eventStore},
+		pvcToPodsCache,
+		10*time.Millisecond,
+		5*time.Minute,
+		NodeFailureCriteria{GracePeriod: DefaultNodeNotReadyTimeDuration},
+		nil,
+		nil,
+		nil,
+		nil,
+	)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	informers.Start(ctx.Done())
+	informers.WaitForCacheSync(ctx.Done())
+	go watcher.Run(ctx, 1)
+
+	deleteFunc(watcher, client, node)
+
+	var events []string
+	for i := 0; i < 2; i++ {
+		event, err := mock.WatchEvent(true, eventStore)
+		assert.Nil(err)
+		events = append(events, event)
+	}
+	assert.Eventually(func() bool { return watcher.nodeStates.getDeleted(node.Name) == nil }, 5*time.Second, 10*time.Millisecond)
+	return events
+}
+
+func Test_NodeDeletion(t *testing.T) {
+	wantEvents := []string{
+		"Warning NodeFailed Volume pv used by PVC pvc is on failed node node1",
+		"Warning NodeFailed Volume pv used by Pods [pod1] is on failed node node1",
+	}
+
+	t.Run("delete event", func(t *testing.T) {
+		events := runNodeDeletionTest(t, func(watcher *NodeWatcher, client *fake.Clientset, node *v1.Node) {
+			assert.Nil(t, client.CoreV1().Nodes().Delete(context.Background(), node.Name, metav1.DeleteOptions{}))
+		})
+		assert.Equal(t, wantEvents, events)
+	})
+
+	t.Run("tombstone", func(t *testing.T) {
+		events := runNodeDeletionTest(t, func(watcher *NodeWatcher, client *fake.Clientset, node *v1.Node) {
+			// the deletion was missed by the watch, the informer only delivers the last known state
+			logger, _ := ktesting.NewTestContext(t)
+			watcher.nodeDeleted(logger, cache.DeletedFinalStateUnknown{Key: node.Name, Obj: node})
+			assert.Nil(t, client.CoreV1().Nodes().Delete(context.Background(), node.Name, metav1.DeleteOptions{}))
+		})
+		assert.Equal(t, wantEvents, events)
+	})
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pv_monitor_controller
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	handler "github.com/kubernetes-csi/external-health-monitor/pkg/csi-handler"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+)
+
+// NodeMonitorController checks the volumes published on the local node by NodeGetVolumeStats,
+// it runs next to the node plugin of the CSI driver on every node
+type NodeMonitorController struct {
+	nodeName string
+	checker  *handler.NodeVolumeHealthChecker
+
+	podListerSynced cache.InformerSynced
+
+	// Time interval for checking the volumes of the node
+	MonitorInterval time.Duration
+}
+
+// NodeMonitorOptions configures node monitor
+type NodeMonitorOptions struct {
+	ContextTimeout time.Duration
+	DriverName     string
+	// NodeName is the name of the local node, only Pods on it are checked
+	NodeName string
+	// KubeletRootDir is the root directory of kubelet, volume paths are computed from it
+	KubeletRootDir string
+	// StageUnstageVolume is set when the node plugin has the STAGE_UNSTAGE_VOLUME capability
+	StageUnstageVolume bool
+
+	MonitorInterval time.Duration
+
+	// UsageThresholds are the thresholds of VolumeNearlyFull events by StorageClass, they are disabled if it is nil
+	UsageThresholds *handler.UsageThresholds
+	// MetricsRecorder records volume usage metrics, it can be nil
+	MetricsRecorder *metrics.Recorder
+	// Classifier maps driver messages of abnormal volumes to structured reasons, it can be nil
+	Classifier handler.Classifier
+	// DriverHealth suppresses abnormal volume events while the driver is unhealthy, it can be nil
+	DriverHealth *handler.DriverHealthMonitor
+}
+
+// NewNodeMonitorController creates node monitor controller. Only the Pods of the node are watched,
+// the PVCs and PVs they use are got from the API server on each check.
+func NewNodeMonitorController(
+	logger klog.Logger,
+	client kubernetes.Interface,
+	conn *grpc.ClientConn,
+	factory informers.SharedInformerFactory,
+	eventRecorder record.EventRecorder,
+	option *NodeMonitorOptions,
+) *NodeMonitorController {
+	// only the Pods of the local node are watched
+	podInformer := factory.InformerFor(&v1.Pod{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		return coreinformers.NewFilteredPodInformer(client, v1.NamespaceAll, resyncPeriod, cache.Indexers{}, func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", option.NodeName).String()
+		})
+	})
+
+	logger.V(2).Info("Creating node monitor controller", "node", option.NodeName)
+	return &NodeMonitorController{
+		nodeName: option.NodeName,
+		checker: handler.NewNodeVolumeHealthChecker(
+			option.DriverName,
+			option.NodeName,
+			option.KubeletRootDir,
+			option.StageUnstageVolume,
+			conn,
+			option.ContextTimeout,
+			corelisters.NewPodLister(podInformer.GetIndexer()),
+			client,
+			eventRecorder,
+			option.UsageThresholds,
+			option.MetricsRecorder,
+			option.Classifier,
+			option.DriverHealth,
+		),
+		podListerSynced: podInformer.HasSynced,
+		MonitorInterval: option.MonitorInterval,
+	}
+}
+
+// Run checks the volumes of the node periodically until ctx is done
+func (ctrl *NodeMonitorController) Run(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	logger.Info("Starting CSI External Node Health Monitor", "node", ctrl.nodeName)
+	defer logger.Info("Shutting down CSI External Node Health Monitor")
+
+	if !cache.WaitForCacheSync(ctx.Done(), ctrl.podListerSynced) {
+		logger.Error(nil, "Cannot sync cache")
+		return
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := ctrl.checker.CheckNodeVolumes(ctx); err != nil {
+			klog.FromContext(ctx).Error(err, "Failed to check volumes of the node")
+		}
+	}, ctrl.MonitorInterval)
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pv_monitor_controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// nodeStateStore stores the failure state of nodes seen by the node watcher,
+// it is safe to be used by multiple node workers
+type nodeStateStore struct {
+	sync.Mutex
+
+	// firstFailing stores when a node was first seen failing, it is removed once the node is marked down or recovers
+	firstFailing map[string]time.Time
+	// markedDown stores all nodes whose PVCs and Pods were marked, it is removed once the node recovers
+	markedDown map[string]bool
+	// deleted stores the last known state of deleted nodes until their PVCs and Pods are marked,
+	// because deleted nodes cannot be got from the node lister anymore
+	deleted map[string]*v1.Node
+}
+
+func newNodeStateStore() *nodeStateStore {
+	return &nodeStateStore{
+		firstFailing: make(map[string]time.Time),
+		markedDown:   make(map[string]bool),
+		deleted:      make(map[string]*v1.Node),
+	}
+}
+
+// failingSince returns when the node was first seen failing and whether it was failing before,
+// it records now if the node was not failing before
+func (store *nodeStateStore) failingSince(name string, now time.Time) (time.Time, bool) {
+	store.Lock()
+	defer store.Unlock()
+
+	first, ok := store.firstFailing[name]
+	if !ok {
+		store.firstFailing[name] = now
+		return now, false
+	}
+	return first, true
+}
+
+func (store *nodeStateStore) clearFailing(name string) {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.firstFailing, name)
+}
+
+// markDown records that the PVCs and Pods of the broken node were marked
+func (store *nodeStateStore) markDown(name string) {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.firstFailing, name)
+	store.markedDown[name] = true
+}
+
+func (store *nodeStateStore) isMarkedDown(name string) bool {
+	store.Lock()
+	defer store.Unlock()
+
+	return store.markedDown[name]
+}
+
+func (store *nodeStateStore) clearMarkedDown(name string) {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.markedDown, name)
+}
+
+func (store *nodeStateStore) setDeleted(node *v1.Node) {
+	store.Lock()
+	defer store.Unlock()
+
+	store.deleted[node.Name] = node
+}
+
+// getDeleted returns the last known state of the deleted node, or nil if it is unknown
+func (store *nodeStateStore) getDeleted(name string) *v1.Node {
+	store.Lock()
+	defer store.Unlock()
+
+	return store.deleted[name]
+}
+
+func (store *nodeStateStore) clearDeleted(name string) {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.deleted, name)
+}
+
+// forget drops all state of the node
+func (store *nodeStateStore) forget(name string) {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.firstFailing, name)
+	delete(store.markedDown, name)
+	delete(store.deleted, name)
+}
+
+// counts returns the number of nodes which are marked down and which are failing but not yet marked down
+func (store *nodeStateStore) counts() (markedDown, failing int) {
+	store.Lock()
+	defer store.Unlock()
+
+	return len(store.markedDown), len(store.firstFailing)
+}
+
+// nodeState is the failure state of a node, it is served by the debug endpoints
+type nodeState struct {
+	Name string `json:"name"`
+	// FailingSince is when the node was first seen failing, it is nil if it is not failing or already marked down
+	FailingSince *time.Time `json:"failingSince,omitempty"`
+	MarkedDown   bool       `json:"markedDown"`
+	Deleted      bool       `json:"deleted"`
+}
+
+// snapshot returns the state of all nodes which are failing, marked down or deleted sorted by name
+func (store *nodeStateStore) snapshot() []nodeState {
+	store.Lock()
+	defer store.Unlock()
+
+	states := map[string]*nodeState{}
+	get := func(name string) *nodeState {
+		if states[name] == nil {
+			states[name] = &nodeState{Name: name}
+		}
+		return states[name]
+	}
+	for name, first := range store.firstFailing {
+		get(name).FailingSince = &first
+	}
+	for name := range store.markedDown {
+		get(name).MarkedDown = true
+	}
+	for name := range store.deleted {
+		get(name).Deleted = true
+	}
+
+	result := make([]nodeState, 0, len(states))
+	for _, state := range states {
+		result = append(result, *state)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
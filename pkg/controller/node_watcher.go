@@ -18,48 +18,96 @@ package pv_monitor_controller
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
 	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
+	healthv1alpha1 "github.com/kubernetes-csi/external-health-monitor/pkg/apis/volumehealth/v1alpha1"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/volumehealth"
 )
 
 const (
 	// DefaultNodeNotReadyTimeDuration is the default time interval we need to consider node broken if it keeps NotReady
 	DefaultNodeNotReadyTimeDuration = 5 * time.Minute
+
+	// NodeFailedReason is the reason of events sent to PVCs and Pods when their node is broken
+	NodeFailedReason = "NodeFailed"
+	// NodeRecoveredReason is the reason of events sent to PVCs and Pods when their broken node recovers
+	NodeRecoveredReason = "NodeRecovered"
+
+	// nodeRetryIntervalStart is the initial interval of retrying a node whose PVCs and Pods could
+	// not be marked, it doubles with each failure up to nodeRetryIntervalMax
+	nodeRetryIntervalStart = time.Second
+	nodeRetryIntervalMax   = 5 * time.Minute
+
+	// leaseExpiryCheckDelay is added to the expiry time of a node Lease when the node is re-checked,
+	// so that the Lease is already expired when it is checked
+	leaseExpiryCheckDelay = time.Second
 )
 
+// NodeFailureCriteria configures when the node watcher considers a node broken.
+// A node is failing when it is not ready or matches one of the optional criteria,
+// and broken once it keeps failing for GracePeriod.
+type NodeFailureCriteria struct {
+	// GracePeriod is the time a node must keep failing before it is considered broken
+	GracePeriod time.Duration
+	// UnreachableTaint makes nodes with the node.kubernetes.io/unreachable taint failing
+	UnreachableTaint bool
+	// OutOfServiceTaint makes nodes with the node.kubernetes.io/out-of-service taint broken
+	// without waiting for GracePeriod, the taint is set by admins for nodes which are shut down
+	OutOfServiceTaint bool
+	// LeaseDuration makes nodes failing whose Lease in kube-node-lease was not renewed for
+	// this duration, 0 disables it
+	LeaseDuration time.Duration
+	// PressureConditions are node conditions which make a node failing while they are True
+	PressureConditions []v1.NodeConditionType
+}
+
 // NodeWatcher watches nodes conditions
 type NodeWatcher struct {
 	driverName string
 	client     kubernetes.Interface
 	recorder   record.EventRecorder
 
-	nodeQueue workqueue.Interface
+	nodeQueue workqueue.TypedRateLimitingInterface[string]
 
 	nodeLister       corelisters.NodeLister
 	nodeListerSynced cache.InformerSynced
 
+	failureCriteria NodeFailureCriteria
+	// leaseLister lists node Leases, it is nil if failureCriteria.LeaseDuration is 0
+	leaseLister       coordinationlisters.LeaseLister
+	leaseListerSynced cache.InformerSynced
+
+	// vaIndexer indexes VolumeAttachments by node name to find the volumes attached to a node,
+	// it is nil if VolumeAttachments are not watched
+	vaIndexer      cache.Indexer
+	vaListerSynced cache.InformerSynced
+
 	volumeLister corelisters.PersistentVolumeLister
 	pvcLister    corelisters.PersistentVolumeClaimLister
 
-	// mark the time when we first found the node is broken
-	nodeFirstBrokenMap map[string]time.Time
-
-	// nodeEverMarkedDown stores all nodes which are marked down
-	// if nodes recover, they will be removed from here
-	nodeEverMarkedDown map[string]bool
+	// nodeStates stores the failure state of nodes, it is shared by all node workers
+	nodeStates *nodeStateStore
 
 	// pvcToPodsCache stores PVC/Pods mapping info, we can get all pods using one specific PVC more efficiently by this
 	pvcToPodsCache *util.PVCToPodsCache
@@ -68,9 +116,15 @@ type NodeWatcher struct {
 	nodeWorkerExecuteInterval time.Duration
 	// Time interval for listing nodess and add them to queue
 	nodeListAndAddInterval time.Duration
+
+	metricsRecorder *metrics.Recorder
+
+	// volumeHealth records node failures of PVCs in VolumeHealth objects, it can be nil
+	volumeHealth *volumehealth.Updater
 }
 
-// NewNodeWatcher creates a node watcher object that will watch the nodes
+// NewNodeWatcher creates a node watcher object that will watch the nodes, the informers
+// must not have been started because indexes are added to them
 func NewNodeWatcher(
 	logger klog.Logger,
 	driverName string,
@@ -82,7 +136,12 @@ func NewNodeWatcher(
 	pvcToPodsCache *util.PVCToPodsCache,
 	nodeWorkerExecuteInterval time.Duration,
 	nodeListAndAddInterval time.Duration,
-) *NodeWatcher {
+	failureCriteria NodeFailureCriteria,
+	leaseInformer cache.SharedIndexInformer,
+	vaInformer cache.SharedIndexInformer,
+	metricsRecorder *metrics.Recorder,
+	volumeHealth *volumehealth.Updater,
+) (*NodeWatcher, error) {
 
 	watcher := &NodeWatcher{
 		driverName:                driverName,
@@ -92,27 +151,67 @@ func NewNodeWatcher(
 		recorder:                  recorder,
 		volumeLister:              volumeLister,
 		pvcLister:                 pvcLister,
-		nodeQueue:                 workqueue.NewNamed("nodes"),
-		nodeFirstBrokenMap:        make(map[string]time.Time),
-		nodeEverMarkedDown:        make(map[string]bool),
-		pvcToPodsCache:            pvcToPodsCache,
+		nodeQueue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](nodeRetryIntervalStart, nodeRetryIntervalMax),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "nodes"},
+		),
+		nodeStates:      newNodeStateStore(),
+		pvcToPodsCache:  pvcToPodsCache,
+		failureCriteria: failureCriteria,
+		metricsRecorder: metricsRecorder,
+		volumeHealth:    volumeHealth,
 	}
 
 	nodeInformer.Informer().AddEventHandler(
 		cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) { watcher.enqueueWork(logger, obj) },
+			AddFunc: func(obj interface{}) {
+				if node, ok := obj.(*v1.Node); ok {
+					// the node was created again, forget its previous deletion
+					watcher.nodeStates.clearDeleted(node.Name)
+				}
+				watcher.enqueueWork(logger, obj)
+			},
 			UpdateFunc: func(oldObj, newObj interface{}) {
 				watcher.enqueueWork(logger, newObj)
 			},
 			DeleteFunc: func(obj interface{}) {
-				watcher.enqueueWork(logger, obj)
+				watcher.nodeDeleted(logger, obj)
 			},
 		},
 	)
 	watcher.nodeLister = nodeInformer.Lister()
 	watcher.nodeListerSynced = nodeInformer.Informer().HasSynced
 
-	return watcher
+	if leaseInformer != nil {
+		// Leases are named after their nodes, re-check the node whenever its Lease is created, renewed
+		// or deleted. Expiry does not cause any event, the worker schedules a check for it instead.
+		leaseInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				watcher.enqueueWork(logger, obj)
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				watcher.enqueueWork(logger, newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				watcher.enqueueWork(logger, obj)
+			},
+		})
+		watcher.leaseLister = coordinationlisters.NewLeaseLister(leaseInformer.GetIndexer())
+		watcher.leaseListerSynced = leaseInformer.HasSynced
+	}
+
+	if vaInformer != nil {
+		err := vaInformer.AddIndexers(cache.Indexers{
+			util.VolumeAttachmentNodeIndexerName: util.VolumeAttachmentNodeIndexFunc,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add VolumeAttachment node indexer: %v", err)
+		}
+		watcher.vaIndexer = vaInformer.GetIndexer()
+		watcher.vaListerSynced = vaInformer.HasSynced
+	}
+
+	return watcher, nil
 }
 
 // enqueueWork adds node to given work queue.
@@ -121,6 +220,12 @@ func (watcher *NodeWatcher) enqueueWork(logger klog.Logger, obj interface{}) {
 	if unknown, ok := obj.(cache.DeletedFinalStateUnknown); ok && unknown.Obj != nil {
 		obj = unknown.Obj
 	}
+	// Leases are namespaced, but named after their cluster scoped nodes
+	if lease, ok := obj.(*coordinationv1.Lease); ok {
+		logger.V(6).Info("Enqueued node of Lease for sync", "objectName", lease.Name)
+		watcher.nodeQueue.Add(lease.Name)
+		return
+	}
 	objName, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
 		logger.Error(err, "Failed to get key from object")
@@ -130,6 +235,46 @@ func (watcher *NodeWatcher) enqueueWork(logger klog.Logger, obj interface{}) {
 	watcher.nodeQueue.Add(objName)
 }
 
+// enqueueAtLeaseExpiry re-checks the node when its Lease expires, unless the Lease is renewed
+// before and the node is checked again anyway. The delaying queue keeps only the earliest
+// pending check of a node, so every check of the node schedules the next one.
+func (watcher *NodeWatcher) enqueueAtLeaseExpiry(logger klog.Logger, nodeName string) {
+	if watcher.leaseLister == nil || watcher.failureCriteria.LeaseDuration <= 0 {
+		return
+	}
+	lease, err := watcher.leaseLister.Leases(v1.NamespaceNodeLease).Get(nodeName)
+	if err != nil || lease.Spec.RenewTime == nil {
+		return
+	}
+	delay := time.Until(lease.Spec.RenewTime.Add(watcher.failureCriteria.LeaseDuration)) + leaseExpiryCheckDelay
+	if delay <= 0 {
+		// already expired
+		return
+	}
+	logger.V(6).Info("Scheduled node check at Lease expiry", "node", nodeName, "delay", delay)
+	watcher.nodeQueue.AddAfter(nodeName, delay)
+}
+
+// nodeDeleted stores the last known state of the deleted node and enqueues it
+func (watcher *NodeWatcher) nodeDeleted(logger klog.Logger, obj interface{}) {
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			logger.Error(nil, "Unexpected object in node delete event", "object", obj)
+			return
+		}
+		node, ok = tombstone.Obj.(*v1.Node)
+		if !ok {
+			logger.Error(nil, "Unexpected object in node tombstone", "object", tombstone.Obj)
+			return
+		}
+	}
+
+	watcher.nodeStates.setDeleted(node)
+	watcher.enqueueWork(logger, node)
+}
+
 // addNodesToQueue adds all existing nodes to queue periodically
 func (watcher *NodeWatcher) addNodesToQueue(ctx context.Context) {
 	logger := klog.FromContext(ctx)
@@ -145,17 +290,21 @@ func (watcher *NodeWatcher) addNodesToQueue(ctx context.Context) {
 	}
 }
 
-// Run starts all of this controller's control loops
-func (watcher *NodeWatcher) Run(ctx context.Context) {
+// Run starts all of this controller's control loops, nodes are processed by the given number of workers
+func (watcher *NodeWatcher) Run(ctx context.Context, workers int) {
 	logger := klog.FromContext(ctx)
 	defer watcher.nodeQueue.ShutDown()
-	if !cache.WaitForCacheSync(ctx.Done(), watcher.nodeListerSynced) {
+	if !cache.WaitForCacheSync(ctx.Done(), watcher.nodeListerSynced) ||
+		(watcher.leaseLister != nil && !cache.WaitForCacheSync(ctx.Done(), watcher.leaseListerSynced)) ||
+		(watcher.vaIndexer != nil && !cache.WaitForCacheSync(ctx.Done(), watcher.vaListerSynced)) {
 		logger.Error(nil, "Cannot sync cache")
 		return
 	}
 
 	go wait.UntilWithContext(ctx, watcher.addNodesToQueue, watcher.nodeListAndAddInterval)
-	go wait.UntilWithContext(ctx, watcher.WatchNodes, watcher.nodeWorkerExecuteInterval)
+	for i := 0; i < workers; i++ {
+		go wait.UntilWithContext(ctx, watcher.WatchNodes, watcher.nodeWorkerExecuteInterval)
+	}
 	<-ctx.Done()
 }
 
@@ -163,12 +312,11 @@ func (watcher *NodeWatcher) Run(ctx context.Context) {
 func (watcher *NodeWatcher) WatchNodes(ctx context.Context) {
 	logger := klog.FromContext(ctx)
 	workFunc := func() bool {
-		keyObj, quit := watcher.nodeQueue.Get()
+		key, quit := watcher.nodeQueue.Get()
 		if quit {
 			return true
 		}
-		defer watcher.nodeQueue.Done(keyObj)
-		key := keyObj.(string)
+		defer watcher.nodeQueue.Done(key)
 		logger.V(4).Info("WatchNode", "node", key)
 
 		_, name, err := cache.SplitMetaNamespaceKey(key)
@@ -180,7 +328,14 @@ func (watcher *NodeWatcher) WatchNodes(ctx context.Context) {
 		if err == nil {
 			// The node still exists in informer cache, the event must have
 			// been add/update/sync
-			watcher.updateNode(logger, node)
+			if err := watcher.updateNode(logger, node); err != nil {
+				logger.Error(err, "Mark PVCs on not ready node failed, re-enqueue")
+				watcher.nodeQueue.AddRateLimited(key)
+			} else {
+				watcher.nodeQueue.Forget(key)
+			}
+			watcher.enqueueAtLeaseExpiry(logger, node.Name)
+			watcher.metricsRecorder.SetNodes(watcher.nodeStates.counts())
 			return false
 		}
 		if !errors.IsNotFound(err) {
@@ -189,7 +344,19 @@ func (watcher *NodeWatcher) WatchNodes(ctx context.Context) {
 		}
 
 		// The node is not in informer cache, the event must be "delete"
-		watcher.deleteNode(logger, node)
+		deletedNode := watcher.nodeStates.getDeleted(name)
+		if deletedNode == nil {
+			logger.V(4).Info("Node is not found and its deletion was not observed, ignoring", "node", name)
+			return false
+		}
+		if err := watcher.deleteNode(logger, deletedNode); err != nil {
+			logger.Error(err, "Marking PVs failed")
+			// the deleted node is kept until its PVs are marked, because it cannot be taken from the informer anymore
+			watcher.nodeQueue.AddRateLimited(key)
+		} else {
+			watcher.nodeQueue.Forget(key)
+		}
+		watcher.metricsRecorder.SetNodes(watcher.nodeStates.counts())
 		return false
 	}
 	for {
@@ -200,27 +367,26 @@ func (watcher *NodeWatcher) WatchNodes(ctx context.Context) {
 	}
 }
 
-func (watcher *NodeWatcher) updateNode(logger klog.Logger, node *v1.Node) {
+// updateNode marks the PVCs and Pods on the node once it is broken and cleans the marks once
+// it recovers, it returns an error if they could not be marked
+func (watcher *NodeWatcher) updateNode(logger klog.Logger, node *v1.Node) error {
 	// TODO: if node is ready, check if node was ever marked down, if yes, reset it
-	if watcher.isNodeReady(node) {
+	if reason := watcher.nodeFailureReason(logger, node); reason == "" {
 		// The node status is ok, but if it was marked before, remove the mark
-		_, ok := watcher.nodeFirstBrokenMap[node.Name]
-		if ok {
-			delete(watcher.nodeFirstBrokenMap, node.Name)
-		}
+		watcher.nodeStates.clearFailing(node.Name)
 
 		// if the node was ever marked down, reset PVCs status on it
-		if watcher.nodeEverMarkedDown[node.Name] {
+		if watcher.nodeStates.isMarkedDown(node.Name) {
 			// TODO: reset PVCs status on the node
 			err := watcher.cleanNodeFailureConditionForPVC(logger, node)
 			if err == nil {
 				// when node recovers and send recovery event successfully, remove the node from the map
-				delete(watcher.nodeEverMarkedDown, node.Name)
+				watcher.nodeStates.clearMarkedDown(node.Name)
 			} else {
 				logger.Error(err, "Clean node failure message error")
 			}
 		}
-		return
+		return nil
 	}
 
 	if watcher.isNodeBroken(logger, node) {
@@ -228,21 +394,14 @@ func (watcher *NodeWatcher) updateNode(logger klog.Logger, node *v1.Node) {
 		// mark all PVCs/Pods on this node
 		err := watcher.markPVCsAndPodsOnUnhealthyNode(logger, node)
 		if err != nil {
-			logger.Error(err, "Mark PVCs on not ready node failed, re-enqueue")
-			// if error happened, re-enqueue
-			watcher.enqueueWork(logger, node)
-			return
-		}
-
-		// node is broken and PVCs on it are marked, remove it from map
-		_, ok := watcher.nodeFirstBrokenMap[node.Name]
-		if ok {
-			delete(watcher.nodeFirstBrokenMap, node.Name)
+			// the node is retried with backoff, e.g. until the PVC of a PV on it is in the cache
+			return err
 		}
 
-		watcher.nodeEverMarkedDown[node.Name] = true
+		// node is broken and PVCs on it are marked
+		watcher.nodeStates.markDown(node.Name)
 	}
-
+	return nil
 }
 
 func (watcher *NodeWatcher) isNodeReady(node *v1.Node) bool {
@@ -255,53 +414,128 @@ func (watcher *NodeWatcher) isNodeReady(node *v1.Node) bool {
 	return false
 }
 
-func (watcher *NodeWatcher) isNodeBroken(logger klog.Logger, node *v1.Node) bool {
-	if node.Status.Phase == v1.NodeTerminated {
-		return true
+// nodeFailureReason returns why the node is failing according to the failure criteria,
+// or an empty string if it is healthy
+func (watcher *NodeWatcher) nodeFailureReason(logger klog.Logger, node *v1.Node) string {
+	// nodes with the out-of-service taint are shut down and therefore also not ready
+	if watcher.isNodeOutOfService(node) {
+		return "OutOfService"
+	}
+
+	if !watcher.isNodeReady(node) {
+		return "NotReady"
 	}
-	objName := node.Name
+
+	for _, taint := range node.Spec.Taints {
+		if watcher.failureCriteria.UnreachableTaint && taint.Key == v1.TaintNodeUnreachable {
+			return "Unreachable"
+		}
+	}
+
 	for _, condition := range node.Status.Conditions {
-		if condition.Type == v1.NodeReady && condition.Status != v1.ConditionTrue {
-			now := time.Now()
-			firstMarkTime, ok := watcher.nodeFirstBrokenMap[objName]
-			if ok {
-				timeInterval := now.Sub(firstMarkTime)
-				if timeInterval.Seconds() > DefaultNodeNotReadyTimeDuration.Seconds() {
-					return true
-				}
-				logger.V(6).Info("Node is not ready, but less than 5 minutes", "node", node.Name)
-				return false
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+		for _, pressure := range watcher.failureCriteria.PressureConditions {
+			if condition.Type == pressure {
+				return string(condition.Type)
 			}
+		}
+	}
 
-			// first time to mark the node NotReady
-			watcher.nodeFirstBrokenMap[objName] = now
-			return false
+	if watcher.leaseLister != nil && watcher.failureCriteria.LeaseDuration > 0 {
+		lease, err := watcher.leaseLister.Leases(v1.NamespaceNodeLease).Get(node.Name)
+		if err != nil {
+			logger.V(4).Info("Cannot get node lease", "node", node.Name, "err", err)
+		} else if lease.Spec.RenewTime != nil && time.Since(lease.Spec.RenewTime.Time) > watcher.failureCriteria.LeaseDuration {
+			return "LeaseExpired"
 		}
 	}
 
+	return ""
+}
+
+// isNodeOutOfService returns true if the out-of-service taint is a failure criterion and the node has it
+func (watcher *NodeWatcher) isNodeOutOfService(node *v1.Node) bool {
+	if !watcher.failureCriteria.OutOfServiceTaint {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Key == v1.TaintNodeOutOfService {
+			return true
+		}
+	}
 	return false
 }
 
-func (watcher *NodeWatcher) deleteNode(logger klog.Logger, node *v1.Node) {
+func (watcher *NodeWatcher) isNodeBroken(logger klog.Logger, node *v1.Node) bool {
+	if node.Status.Phase == v1.NodeTerminated {
+		return true
+	}
+
+	// the out-of-service taint is set by admins for nodes which are shut down, whether the node
+	// is ready or not it does not wait for the grace period
+	if watcher.isNodeOutOfService(node) {
+		return true
+	}
+
+	reason := watcher.nodeFailureReason(logger, node)
+	if reason == "" {
+		return false
+	}
+
+	now := time.Now()
+	firstMarkTime, wasFailing := watcher.nodeStates.failingSince(node.Name, now)
+	if !wasFailing {
+		// first time to mark the node failing
+		return false
+	}
+	if now.Sub(firstMarkTime) > watcher.failureCriteria.GracePeriod {
+		return true
+	}
+	logger.V(6).Info("Node is failing, but less than the grace period", "node", node.Name, "reason", reason, "gracePeriod", watcher.failureCriteria.GracePeriod)
+	return false
+}
+
+// deleteNode marks the PVCs and Pods on the deleted node and forgets it, it returns an error if
+// they could not be marked
+func (watcher *NodeWatcher) deleteNode(logger klog.Logger, node *v1.Node) error {
 	logger.Info("Node is deleted, so mark the PVs on the node", "node", node.Name)
 
 	// mark all PVs on this node
-	err := watcher.markPVCsAndPodsOnUnhealthyNode(logger, node)
-	if err != nil {
-		logger.Error(err, "Marking PVs failed")
-		// must re-enqueue here, because we can not get this from informer(node-lister) any more
-		watcher.enqueueWork(logger, node)
+	if err := watcher.markPVCsAndPodsOnUnhealthyNode(logger, node); err != nil {
+		return err
 	}
+
+	watcher.nodeStates.forget(node.Name)
+	return nil
 }
 
-func (watcher *NodeWatcher) cleanNodeFailureConditionForPVC(logger klog.Logger, node *v1.Node) error {
-	pvs, err := watcher.volumeLister.List(labels.NewSelector())
+// volumeOnNode is a bound volume of the driver together with the Pods using it on one node
+type volumeOnNode struct {
+	pv   *v1.PersistentVolume
+	pvc  *v1.PersistentVolumeClaim
+	pods []*v1.Pod
+}
+
+// getVolumesOnNode returns the bound volumes of the driver which are used by Pods on the node
+func (watcher *NodeWatcher) getVolumesOnNode(logger klog.Logger, node *v1.Node) ([]volumeOnNode, error) {
+	pvNames, err := watcher.getPVNamesOnNode(logger, node)
 	if err != nil {
-		logger.Info("Cannot list pvs", "err", err)
-		return err
+		return nil, err
 	}
 
-	for _, pv := range pvs {
+	var volumes []volumeOnNode
+	for _, pvName := range sets.List(pvNames) {
+		pv, err := watcher.volumeLister.Get(pvName)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			logger.Error(err, "Get PV from PV lister error", "pv", pvName)
+			return nil, err
+		}
+
 		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != watcher.driverName {
 			continue
 		}
@@ -324,69 +558,123 @@ func (watcher *NodeWatcher) cleanNodeFailureConditionForPVC(logger klog.Logger,
 		if len(podsOnThatNode) == 0 {
 			continue
 		}
+		sort.Slice(podsOnThatNode, func(i, j int) bool {
+			return podsOnThatNode[i].Name < podsOnThatNode[j].Name
+		})
 
-		// TODO: add events to Pods instead
 		pvc, err := watcher.pvcLister.PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(pv.Spec.ClaimRef.Name)
 		if err != nil {
 			logger.Error(err, "Get PVC from PVC lister error", "pvc", klog.KRef(pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name))
-			return err
+			return nil, err
 		}
 
-		pvcClone := pvc.DeepCopy()
-		message := "Node: " + node.Name + " recovered"
-		watcher.recorder.Event(pvcClone, v1.EventTypeWarning, "NodeRecovered", message)
+		volumes = append(volumes, volumeOnNode{pv: pv, pvc: pvc, pods: podsOnThatNode})
+	}
+	return volumes, nil
+}
 
+// getPVNamesOnNode returns the names of the PVs attached to the node by VolumeAttachments of the driver,
+// plus the PVs of the PVCs used by Pods on the node, which covers volumes that do not need to be attached
+func (watcher *NodeWatcher) getPVNamesOnNode(logger klog.Logger, node *v1.Node) (sets.Set[string], error) {
+	pvNames := sets.New[string]()
+
+	if watcher.vaIndexer != nil {
+		objs, err := watcher.vaIndexer.ByIndex(util.VolumeAttachmentNodeIndexerName, node.Name)
+		if err != nil {
+			logger.Error(err, "Get VolumeAttachments of node error", "node", node.Name)
+			return nil, err
+		}
+		for _, obj := range objs {
+			va, ok := obj.(*storagev1.VolumeAttachment)
+			if !ok || va.Spec.Attacher != watcher.driverName || va.Spec.Source.PersistentVolumeName == nil {
+				continue
+			}
+			pvNames.Insert(*va.Spec.Source.PersistentVolumeName)
+		}
 	}
-	return nil
+
+	for _, pod := range watcher.pvcToPodsCache.GetPodsByNode(node.Name) {
+		for _, pvcName := range util.GetPodPVCNames(pod) {
+			pvc, err := watcher.pvcLister.PersistentVolumeClaims(pod.Namespace).Get(pvcName)
+			if err != nil {
+				logger.V(4).Info("Cannot get PVC of pod", "pod", klog.KObj(pod), "pvc", pvcName, "err", err)
+				continue
+			}
+			if pvc.Spec.VolumeName != "" {
+				pvNames.Insert(pvc.Spec.VolumeName)
+			}
+		}
+	}
+
+	return pvNames, nil
 }
 
-func (watcher *NodeWatcher) markPVCsAndPodsOnUnhealthyNode(logger klog.Logger, node *v1.Node) error {
-	pvs, err := watcher.volumeLister.List(labels.NewSelector())
+func (watcher *NodeWatcher) cleanNodeFailureConditionForPVC(logger klog.Logger, node *v1.Node) error {
+	volumes, err := watcher.getVolumesOnNode(logger, node)
 	if err != nil {
-		logger.Info("Cannot list pvs", "err", err)
 		return err
 	}
 
-	for _, pv := range pvs {
-		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != watcher.driverName {
-			continue
+	for _, volume := range volumes {
+		for _, pod := range volume.pods {
+			message := fmt.Sprintf("Node %s of volume %s used by PVC %s recovered", node.Name, volume.pv.Name, volume.pvc.Name)
+			watcher.recorder.Event(pod.DeepCopy(), v1.EventTypeNormal, NodeRecoveredReason, message)
 		}
 
-		if pv.Status.Phase != v1.VolumeBound {
-			continue
-		}
+		message := fmt.Sprintf("Node %s of volume %s used by Pods %s recovered", node.Name, volume.pv.Name, podNames(volume.pods))
+		watcher.recorder.Event(volume.pvc.DeepCopy(), v1.EventTypeNormal, NodeRecoveredReason, message)
+		watcher.recordVolumeHealth(logger, volume.pvc, healthv1alpha1.VolumeHealthHealthy, NodeRecoveredReason, message)
+	}
 
-		pods := watcher.pvcToPodsCache.GetPodsByPVC(pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name)
-		if len(pods) == 0 {
-			continue
-		}
+	for _, volume := range watcher.pvcToPodsCache.GetInlineVolumesByNode(watcher.driverName, node.Name) {
+		message := fmt.Sprintf("Node %s of inline volume %s recovered", node.Name, volume.VolumeName)
+		watcher.recorder.Event(volume.Pod.DeepCopy(), v1.EventTypeNormal, NodeRecoveredReason, message)
+	}
+	return nil
+}
 
-		podsOnThatNode := make([]*v1.Pod, 0)
-		for _, pod := range pods {
-			if pod.Spec.NodeName == node.Name {
-				podsOnThatNode = append(podsOnThatNode, pod)
-			}
-		}
-		if len(podsOnThatNode) == 0 {
-			continue
-		}
+func (watcher *NodeWatcher) markPVCsAndPodsOnUnhealthyNode(logger klog.Logger, node *v1.Node) error {
+	volumes, err := watcher.getVolumesOnNode(logger, node)
+	if err != nil {
+		return err
+	}
 
-		pvc, err := watcher.pvcLister.PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(pv.Spec.ClaimRef.Name)
-		if err != nil {
-			logger.Error(err, "Get PVC from PVC lister error", "pvc", klog.KRef(pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name))
-			return err
+	for _, volume := range volumes {
+		for _, pod := range volume.pods {
+			message := fmt.Sprintf("Volume %s used by PVC %s is on failed node %s", volume.pv.Name, volume.pvc.Name, node.Name)
+			watcher.recorder.Event(pod.DeepCopy(), v1.EventTypeWarning, NodeFailedReason, message)
 		}
 
-		// TODO: add events to Pods instead
-		pvcClone := pvc.DeepCopy()
-
-		message := "Pods: [ "
-		for _, pod := range podsOnThatNode {
-			message = message + pod.Name + " "
-		}
-		message += "]" + " consuming PVC: " + pvcClone.Name + " in namespace: " + pvcClone.Namespace + " are now on a failed node: " + node.Name
+		message := fmt.Sprintf("Volume %s used by Pods %s is on failed node %s", volume.pv.Name, podNames(volume.pods), node.Name)
+		watcher.recorder.Event(volume.pvc.DeepCopy(), v1.EventTypeWarning, NodeFailedReason, message)
+		watcher.recordVolumeHealth(logger, volume.pvc, healthv1alpha1.VolumeHealthAbnormal, NodeFailedReason, message)
+	}
 
-		watcher.recorder.Event(pvcClone, v1.EventTypeWarning, "NodeFailed", message)
+	for _, volume := range watcher.pvcToPodsCache.GetInlineVolumesByNode(watcher.driverName, node.Name) {
+		message := fmt.Sprintf("Inline volume %s is on failed node %s", volume.VolumeName, node.Name)
+		watcher.recorder.Event(volume.Pod.DeepCopy(), v1.EventTypeWarning, NodeFailedReason, message)
 	}
 	return nil
 }
+
+// recordVolumeHealth records a node failure or recovery in the VolumeHealth of the PVC, failed updates are only logged
+func (watcher *NodeWatcher) recordVolumeHealth(logger klog.Logger, pvc *v1.PersistentVolumeClaim, state healthv1alpha1.VolumeHealthState, reason, message string) {
+	observation := volumehealth.Observation{
+		Source:  healthv1alpha1.VolumeHealthSourceNodeWatcher,
+		State:   state,
+		Reason:  reason,
+		Message: message,
+	}
+	if err := watcher.volumeHealth.Record(klog.NewContext(context.TODO(), logger), pvc, observation); err != nil {
+		logger.Error(err, "Failed to record volume health", "pvc", klog.KObj(pvc))
+	}
+}
+
+// podNames returns the names of the Pods as a list for event messages
+func podNames(pods []*v1.Pod) string {
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
@@ -0,0 +1,537 @@
+package pv_monitor_controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/ktesting"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func createReadyNode(name string, conditions ...v1.NodeCondition) *v1.Node {
+	node := mock.CreateNode(name, "")
+	node.Status.Conditions = append([]v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}, conditions...)
+	return node
+}
+
+func Test_NodeFailureCriteria(t *testing.T) {
+	unreachable := createReadyNode("node1")
+	unreachable.Spec.Taints = []v1.Taint{{Key: v1.TaintNodeUnreachable, Effect: v1.TaintEffectNoExecute}}
+	outOfService := createReadyNode("node1")
+	outOfService.Spec.Taints = []v1.Taint{{Key: v1.TaintNodeOutOfService, Effect: v1.TaintEffectNoExecute}}
+	// nodes are shut down when the out-of-service taint is set, so they are not ready
+	notReadyOutOfService := mock.CreateNode("node1", "")
+	notReadyOutOfService.Spec.Taints = []v1.Taint{{Key: v1.TaintNodeOutOfService, Effect: v1.TaintEffectNoExecute}}
+	diskPressure := createReadyNode("node1", v1.NodeCondition{Type: v1.NodeDiskPressure, Status: v1.ConditionTrue})
+
+	tests := []struct {
+		name         string
+		node         *v1.Node
+		criteria     NodeFailureCriteria
+		leaseRenewed time.Duration
+		wantReason   string
+		// wantBroken are the expected results of two consecutive checks
+		wantBroken [2]bool
+	}{
+		{
+			name:     "ready node",
+			node:     createReadyNode("node1"),
+			criteria: NodeFailureCriteria{UnreachableTaint: true, OutOfServiceTaint: true},
+		},
+		{
+			name:       "not ready node is broken after grace period",
+			node:       mock.CreateNode("node1", ""),
+			wantReason: "NotReady",
+			wantBroken: [2]bool{false, true},
+		},
+		{
+			name:       "not ready node within grace period",
+			node:       mock.CreateNode("node1", ""),
+			criteria:   NodeFailureCriteria{GracePeriod: time.Hour},
+			wantReason: "NotReady",
+		},
+		{
+			name: "unreachable taint is ignored by default",
+			node: unreachable,
+		},
+		{
+			name:       "unreachable taint",
+			node:       unreachable,
+			criteria:   NodeFailureCriteria{UnreachableTaint: true},
+			wantReason: "Unreachable",
+			wantBroken: [2]bool{false, true},
+		},
+		{
+			name:       "out-of-service taint is broken immediately",
+			node:       outOfService,
+			criteria:   NodeFailureCriteria{GracePeriod: time.Hour, OutOfServiceTaint: true},
+			wantReason: "OutOfService",
+			wantBroken: [2]bool{true, true},
+		},
+		{
+			name:       "not ready node with out-of-service taint is broken immediately",
+			node:       notReadyOutOfService,
+			criteria:   NodeFailureCriteria{GracePeriod: time.Hour, OutOfServiceTaint: true},
+			wantReason: "OutOfService",
+			wantBroken: [2]bool{true, true},
+		},
+		{
+			name:       "out-of-service taint is ignored by default",
+			node:       notReadyOutOfService,
+			criteria:   NodeFailureCriteria{GracePeriod: time.Hour},
+			wantReason: "NotReady",
+		},
+		{
+			name:       "pressure condition",
+			node:       diskPressure,
+			criteria:   NodeFailureCriteria{PressureConditions: []v1.NodeConditionType{v1.NodeDiskPressure}},
+			wantReason: "DiskPressure",
+			wantBroken: [2]bool{false, true},
+		},
+		{
+			name:         "renewed lease",
+			node:         createReadyNode("node1"),
+			criteria:     NodeFailureCriteria{LeaseDuration: time.Minute},
+			leaseRenewed: 10 * time.Second,
+		},
+		{
+			name:         "stale lease",
+			node:         createReadyNode("node1"),
+			criteria:     NodeFailureCriteria{LeaseDuration: time.Minute},
+			leaseRenewed: 2 * time.Minute,
+			wantReason:   "LeaseExpired",
+			wantBroken:   [2]bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			client := fake.NewSimpleClientset()
+			factory := informers.NewSharedInformerFactory(client, 0)
+			leaseInformer := factory.Coordination().V1().Leases().Informer()
+			if tt.leaseRenewed > 0 {
+				renewTime := metav1.NewMicroTime(time.Now().Add(-tt.leaseRenewed))
+				assert.Nil(leaseInformer.GetStore().Add(&coordinationv1.Lease{
+					ObjectMeta: metav1.ObjectMeta{Name: tt.node.Name, Namespace: v1.NamespaceNodeLease},
+					Spec:       coordinationv1.LeaseSpec{RenewTime: &renewTime},
+				}))
+			}
+
+			pvcToPodsCache, _ := newPVCToPodsCache(t)
+			logger, _ := ktesting.NewTestContext(t)
+			watcher, err := NewNodeWatcher(
+				logger,
+				"fake.csi.driver.io",
+				client,
+				factory.Core().V1().PersistentVolumes().Lister(),
+				factory.Core().V1().PersistentVolumeClaims().Lister(),
+				factory.Core().V1().Nodes(),
+				&record.FakeRecorder{},
+				pvcToPodsCache,
+				time.Minute,
+				5*time.Minute,
+				tt.criteria,
+				leaseInformer,
+				nil,
+				nil,
+				nil,
+			)
+			assert.Nil(err)
+
+			assert.Equal(tt.wantReason, watcher.nodeFailureReason(logger, tt.node))
+			for i, want := range tt.wantBroken {
+				assert.Equal(want, watcher.isNodeBroken(logger, tt.node), "check %d", i)
+			}
+		})
+	}
+}
+
+func Test_NodeFailureEvents(t *testing.T) {
+	assert := assert.New(t)
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	assert.Nil(factory.Core().V1().PersistentVolumes().Informer().GetStore().Add(pv))
+	assert.Nil(factory.Core().V1().PersistentVolumeClaims().Informer().GetStore().Add(pvc))
+
+	pvcToPodsCache, podStore := newPVCToPodsCache(t,
+		mock.CreatePod("pod2", mock.DefaultNS, "data", "pvc", "node1", "pod2uid", false),
+		mock.CreatePod("pod1", mock.DefaultNS, "data", "pvc", "node1", "pod1uid", false),
+		mock.CreatePod("pod3", mock.DefaultNS, "data", "pvc", "node2", "pod3uid", false),
+	)
+	inlinePod := mock.CreatePod("pod4", mock.DefaultNS, "data", "pvc", "node1", "pod4uid", false)
+	inlinePod.Spec.Volumes = []v1.Volume{{
+		Name:         "inline",
+		VolumeSource: v1.VolumeSource{CSI: &v1.CSIVolumeSource{Driver: "fake.csi.driver.io"}},
+	}}
+	addPod(t, podStore, inlinePod)
+
+	eventStore := make(chan string, 10)
+	logger, _ := ktesting.NewTestContext(t)
+	watcher, err := NewNodeWatcher(
+		logger,
+		"fake.csi.driver.io",
+		client,
+		factory.Core().V1().PersistentVolumes().Lister(),
+		factory.Core().V1().PersistentVolumeClaims().Lister(),
+		factory.Core().V1().Nodes(),
+		&record.FakeRecorder{Events: eventStore},
+		pvcToPodsCache,
+		time.Minute,
+		5*time.Minute,
+		NodeFailureCriteria{},
+		nil,
+		nil,
+		nil,
+		nil,
+	)
+	assert.Nil(err)
+	node := mock.CreateNode("node1", "")
+
+	assert.Nil(watcher.markPVCsAndPodsOnUnhealthyNode(logger, node))
+	assert.Equal([]string{
+		"Warning NodeFailed Volume pv used by PVC pvc is on failed node node1",
+		"Warning NodeFailed Volume pv used by PVC pvc is on failed node node1",
+		"Warning NodeFailed Volume pv used by Pods [pod1 pod2] is on failed node node1",
+		"Warning NodeFailed Inline volume inline is on failed node node1",
+	}, drainEvents(eventStore))
+
+	assert.Nil(watcher.cleanNodeFailureConditionForPVC(logger, node))
+	assert.Equal([]string{
+		"Normal NodeRecovered Node node1 of volume pv used by PVC pvc recovered",
+		"Normal NodeRecovered Node node1 of volume pv used by PVC pvc recovered",
+		"Normal NodeRecovered Node node1 of volume pv used by Pods [pod1 pod2] recovered",
+		"Normal NodeRecovered Node node1 of inline volume inline recovered",
+	}, drainEvents(eventStore))
+}
+
+func drainEvents(eventStore chan string) []string {
+	var events []string
+	for len(eventStore) > 0 {
+		events = append(events, <-eventStore)
+	}
+	return events
+}
+
+func Test_ConcurrentNodeFlaps(t *testing.T) {
+	const (
+		nodes = 10
+		flaps = 20
+	)
+	assert := assert.New(t)
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	pvcToPodsCache, podStore := newPVCToPodsCache(t)
+	for i := 0; i < nodes; i++ {
+		name := fmt.Sprintf("node%d", i)
+		pv := mock.CreatePV(2, "pvc-"+name, "pv-"+name, mock.DefaultNS, "volume-"+name, types.UID("uid-"+name), &mock.FSVolumeMode, v1.VolumeBound)
+		pvc := mock.CreatePVC(1, 2, "pvc-"+name, "uid-"+name, mock.DefaultNS, "pv-"+name, v1.ClaimBound)
+		_, err := client.CoreV1().PersistentVolumes().Create(context.Background(), pv, metav1.CreateOptions{})
+		assert.Nil(err)
+		_, err = client.CoreV1().PersistentVolumeClaims(mock.DefaultNS).Create(context.Background(), pvc, metav1.CreateOptions{})
+		assert.Nil(err)
+		_, err = client.CoreV1().Nodes().Create(context.Background(), createReadyNode(name), metav1.CreateOptions{})
+		assert.Nil(err)
+		addPod(t, podStore, mock.CreatePod("pod-"+name, mock.DefaultNS, "data", "pvc-"+name, name, "pod-uid-"+name, false))
+	}
+
+	logger, ctx := ktesting.NewTestContext(t)
+	watcher, err := NewNodeWatcher(
+		logger,
+		"fake.csi.driver.io",
+		client,
+		factory.Core().V1().PersistentVolumes().Lister(),
+		factory.Core().V1().PersistentVolumeClaims().Lister(),
+		factory.Core().V1().Nodes(),
+		&record.FakeRecorder{},
+		pvcToPodsCache,
+		10*time.Millisecond,
+		5*time.Minute,
+		NodeFailureCriteria{},
+		nil,
+		nil,
+		metrics.NewRecorder("fake.csi.driver.io"),
+		nil,
+	)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	go watcher.Run(ctx, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < nodes; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for j := 0; j < flaps; j++ {
+				node := createReadyNode(name)
+				if j%2 == 0 {
+					node.Status.Conditions[0].Status = v1.ConditionFalse
+				}
+				_, err := client.CoreV1().Nodes().UpdateStatus(context.Background(), node, metav1.UpdateOptions{})
+				assert.Nil(err)
+				time.Sleep(time.Millisecond)
+			}
+		}(fmt.Sprintf("node%d", i))
+	}
+	wg.Wait()
+
+	// all nodes end up ready, so none of them is failing or marked down anymore
+	assert.Eventually(func() bool {
+		markedDown, failing := watcher.nodeStates.counts()
+		return markedDown == 0 && failing == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_LeaseExpiry(t *testing.T) {
+	assert := assert.New(t)
+	renewTime := metav1.NewMicroTime(time.Now())
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", Namespace: v1.NamespaceNodeLease},
+		Spec:       coordinationv1.LeaseSpec{RenewTime: &renewTime},
+	}
+	client := fake.NewSimpleClientset(createReadyNode("node1"), lease)
+	factory := informers.NewSharedInformerFactory(client, 0)
+	pvcToPodsCache, _ := newPVCToPodsCache(t)
+
+	logger, ctx := ktesting.NewTestContext(t)
+	watcher, err := NewNodeWatcher(
+		logger,
+		"fake.csi.driver.io",
+		client,
+		factory.Core().V1().PersistentVolumes().Lister(),
+		factory.Core().V1().PersistentVolumeClaims().Lister(),
+		factory.Core().V1().Nodes(),
+		&record.FakeRecorder{},
+		pvcToPodsCache,
+		10*time.Millisecond,
+		time.Hour,
+		NodeFailureCriteria{GracePeriod: time.Hour, LeaseDuration: 200 * time.Millisecond},
+		factory.Coordination().V1().Leases().Informer(),
+		nil,
+		metrics.NewRecorder("fake.csi.driver.io"),
+		nil,
+	)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	factory.Start(ctx.Done())
+	factory.WaitForCacheSync(ctx.Done())
+	go watcher.Run(ctx, 1)
+
+	// the Lease is not renewed, so it expires without any event and long before the next resync
+	assert.Eventually(func() bool {
+		_, failing := watcher.nodeStates.counts()
+		return failing == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_NodeRetriedWithBackoff(t *testing.T) {
+	outOfService := mock.CreateNode("node1", "")
+	outOfService.Spec.Taints = []v1.Taint{{Key: v1.TaintNodeOutOfService, Effect: v1.TaintEffectNoExecute}}
+
+	tests := []struct {
+		name   string
+		node   *v1.Node
+		delete bool
+		// done returns true once the volumes of the node are marked
+		done func(watcher *NodeWatcher) bool
+	}{
+		{
+			name: "broken node",
+			node: outOfService,
+			done: func(watcher *NodeWatcher) bool {
+				markedDown, _ := watcher.nodeStates.counts()
+				return markedDown == 1
+			},
+		},
+		{
+			name:   "deleted node",
+			node:   createReadyNode("node1"),
+			delete: true,
+			done: func(watcher *NodeWatcher) bool {
+				return watcher.nodeStates.getDeleted("node1") == nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			pvName := "pv"
+			pv := mock.CreatePV(2, "pvc", pvName, mock.DefaultNS, "volume1", "pvcuid", &mock.FSVolumeMode, v1.VolumeBound)
+			pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, pvName, v1.ClaimBound)
+			va := &storagev1.VolumeAttachment{
+				ObjectMeta: metav1.ObjectMeta{Name: "va"},
+				Spec: storagev1.VolumeAttachmentSpec{
+					Attacher: "fake.csi.driver.io",
+					NodeName: tt.node.Name,
+					Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+				},
+			}
+			// the PVC of the attached PV is not in the cache yet, so the volumes of the node cannot be marked
+			client := fake.NewSimpleClientset(pv, tt.node, va)
+			factory := informers.NewSharedInformerFactory(client, 0)
+			pvcToPodsCache, _ := newPVCToPodsCache(t, mock.CreatePod("pod1", mock.DefaultNS, "data", "pvc", tt.node.Name, "pod1uid", false))
+
+			eventStore := make(chan string, 10)
+			logger, ctx := ktesting.NewTestContext(t)
+			watcher, err := NewNodeWatcher(
+				logger,
+				"fake.csi.driver.io",
+				client,
+				factory.Core().V1().PersistentVolumes().Lister(),
+				factory.Core().V1().PersistentVolumeClaims().Lister(),
+				factory.Core().V1().Nodes(),
+				&record.FakeRecorder{Events: eventStore},
+				pvcToPodsCache,
+				time.Hour,
+				time.Hour,
+				NodeFailureCriteria{GracePeriod: time.Hour, OutOfServiceTaint: true},
+				nil,
+				factory.Storage().V1().VolumeAttachments().Informer(),
+				metrics.NewRecorder("fake.csi.driver.io"),
+				nil,
+			)
+			assert.Nil(err)
+
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			factory.Start(ctx.Done())
+			factory.WaitForCacheSync(ctx.Done())
+			go watcher.Run(ctx, 1)
+
+			if tt.delete {
+				assert.Nil(client.CoreV1().Nodes().Delete(context.Background(), tt.node.Name, metav1.DeleteOptions{}))
+			}
+
+			// the node is retried with an increasing delay, not in a hot loop
+			assert.Eventually(func() bool { return watcher.nodeQueue.NumRequeues(tt.node.Name) >= 2 }, 5*time.Second, 10*time.Millisecond)
+			assert.Less(watcher.nodeQueue.NumRequeues(tt.node.Name), 10)
+
+			_, err = client.CoreV1().PersistentVolumeClaims(mock.DefaultNS).Create(context.Background(), pvc, metav1.CreateOptions{})
+			assert.Nil(err)
+			assert.Eventually(func() bool {
+				return tt.done(watcher) && watcher.nodeQueue.NumRequeues(tt.node.Name) == 0
+			}, 10*time.Second, 10*time.Millisecond)
+			assert.Equal([]string{
+				"Warning NodeFailed Volume pv used by PVC pvc is on failed node node1",
+				"Warning NodeFailed Volume pv used by Pods [pod1] is on failed node node1",
+			}, drainEvents(eventStore))
+		})
+	}
+}
+
+// newVolumeLookupTestWatcher creates a node watcher whose informer stores contain a PV, PVC and Pod for
+// each of the given number of volumes, spread round robin over the given number of nodes. Volumes with
+// an even index are attached by a VolumeAttachment, the others are only found through their Pods.
+func newVolumeLookupTestWatcher(tb testing.TB, volumes, nodes int) *NodeWatcher {
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	pvStore := factory.Core().V1().PersistentVolumes().Informer().GetStore()
+	pvcStore := factory.Core().V1().PersistentVolumeClaims().Informer().GetStore()
+	vaInformer := factory.Storage().V1().VolumeAttachments().Informer()
+	pvcToPodsCache, podStore := newPVCToPodsCache(tb)
+
+	logger, _ := ktesting.NewTestContext(tb)
+	watcher, err := NewNodeWatcher(
+		logger,
+		"fake.csi.driver.io",
+		client,
+		factory.Core().V1().PersistentVolumes().Lister(),
+		factory.Core().V1().PersistentVolumeClaims().Lister(),
+		factory.Core().V1().Nodes(),
+		&record.FakeRecorder{},
+		pvcToPodsCache,
+		time.Minute,
+		5*time.Minute,
+		NodeFailureCriteria{},
+		nil,
+		vaInformer,
+		nil,
+		nil,
+	)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	for i := 0; i < volumes; i++ {
+		pvName := fmt.Sprintf("pv%d", i)
+		pvcName := fmt.Sprintf("pvc%d", i)
+		nodeName := fmt.Sprintf("node%d", i%nodes)
+		pv := mock.CreatePV(2, pvcName, pvName, mock.DefaultNS, fmt.Sprintf("volume%d", i), types.UID(pvcName), &mock.FSVolumeMode, v1.VolumeBound)
+		pvc := mock.CreatePVC(1, 2, pvcName, pvcName, mock.DefaultNS, pvName, v1.ClaimBound)
+		if err := pvStore.Add(pv); err != nil {
+			tb.Fatal(err)
+		}
+		if err := pvcStore.Add(pvc); err != nil {
+			tb.Fatal(err)
+		}
+		addPod(tb, podStore, mock.CreatePod(fmt.Sprintf("pod%d", i), mock.DefaultNS, "data", pvcName, nodeName, fmt.Sprintf("poduid%d", i), false))
+		if i%2 == 0 {
+			va := &storagev1.VolumeAttachment{
+				ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("va%d", i)},
+				Spec: storagev1.VolumeAttachmentSpec{
+					Attacher: "fake.csi.driver.io",
+					NodeName: nodeName,
+					Source:   storagev1.VolumeAttachmentSource{PersistentVolumeName: &pvName},
+				},
+			}
+			if err := vaInformer.GetStore().Add(va); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return watcher
+}
+
+func Test_GetVolumesOnNode(t *testing.T) {
+	assert := assert.New(t)
+	watcher := newVolumeLookupTestWatcher(t, 8, 2)
+	logger, _ := ktesting.NewTestContext(t)
+
+	volumes, err := watcher.getVolumesOnNode(logger, mock.CreateNode("node1", ""))
+	assert.Nil(err)
+	var pvNames []string
+	for _, volume := range volumes {
+		pvNames = append(pvNames, volume.pv.Name)
+		assert.Len(volume.pods, 1)
+	}
+	// pv1, pv3, ... have no VolumeAttachment and are found through their Pods
+	assert.Equal([]string{"pv1", "pv3", "pv5", "pv7"}, pvNames)
+
+	volumes, err = watcher.getVolumesOnNode(logger, mock.CreateNode("node2", ""))
+	assert.Nil(err)
+	assert.Empty(volumes)
+}
+
+func BenchmarkGetVolumesOnNode(b *testing.B) {
+	watcher := newVolumeLookupTestWatcher(b, 30000, 300)
+	logger, _ := ktesting.NewTestContext(b)
+	node := mock.CreateNode("node42", "")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := watcher.getVolumesOnNode(logger, node); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
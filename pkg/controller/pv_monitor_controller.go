@@ -24,14 +24,17 @@ import (
 
 	"google.golang.org/grpc"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
 	v1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/wait"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/informers"
+	coordinationinformers "k8s.io/client-go/informers/coordination/v1"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -39,20 +42,32 @@ import (
 
 	handler "github.com/kubernetes-csi/external-health-monitor/pkg/csi-handler"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/features"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/volumehealth"
 )
 
+// pvQueueItem is a PV in the queue. Each time a PV is enqueued it gets a new generation, so that
+// checks scheduled before it was dequeued are dropped instead of checking it in a second chain.
+type pvQueueItem struct {
+	name       string
+	generation uint64
+}
+
 // PVMonitorController is the struct of pv monitor controller containing all information to perform volumes health condition checking
 type PVMonitorController struct {
-	client             kubernetes.Interface
-	driverName         string
-	eventRecorder      record.EventRecorder
-	supportListVolumes bool
+	client        kubernetes.Interface
+	driverName    string
+	eventRecorder record.EventRecorder
+	// capabilities decide whether volumes are checked with ListVolumes, ControllerGetVolume or not at all
+	capabilities *handler.CapabilitiesMonitor
 
-	pvChecker *handler.PVHealthConditionChecker
+	pvChecker       *handler.PVHealthConditionChecker
+	metricsRecorder *metrics.Recorder
 
 	enableNodeWatcher bool
 	nodeWatcher       *NodeWatcher
+	nodeWorkerThreads int
 
 	csiConn *grpc.ClientConn
 
@@ -65,19 +80,31 @@ type PVMonitorController struct {
 	podLister       corelisters.PodLister
 	podListerSynced cache.InformerSynced
 
+	enableAttachmentDriftCheck bool
+	vaIndexer                  cache.Indexer
+	vaListerSynced             cache.InformerSynced
+	csiNodeLister              storagelisters.CSINodeLister
+	csiNodeListerSynced        cache.InformerSynced
+
+	volumeHealthSynced cache.InformerSynced
+
 	// used for updating pvEnqueue map
 	sync.Mutex
-	// pvEnqueued stores all CSI PVs which are enqueued
-	pvEnqueued map[string]bool
+	// pvEnqueued stores the generation of all CSI PVs which are enqueued
+	pvEnqueued map[string]uint64
+	// pvGeneration is the generation of the PV enqueued last
+	pvGeneration uint64
 	// pvcToPodsCache stores PVCs/Pods mapping info
 	pvcToPodsCache *util.PVCToPodsCache
 	// we get PVs from pvQueue to check their health conditions
-	pvQueue workqueue.Interface
+	pvQueue workqueue.TypedRateLimitingInterface[pvQueueItem]
 
 	// Time interval for calling ListVolumes RPC to check volumes' health condition
 	ListVolumesInterval time.Duration
-	// Time interval for executing pv worker goroutines
+	// Time interval for re-checking a PV after its last successful check
 	PVWorkerExecuteInterval time.Duration
+	// Time interval for re-checking a PV whose volume is abnormal, 0 means PVWorkerExecuteInterval
+	UnhealthyPVWorkerExecuteInterval time.Duration
 	// Time interval for listing volumes and add them to queue
 	VolumeListAndAddInterval time.Duration
 }
@@ -87,17 +114,45 @@ type PVMonitorOptions struct {
 	ContextTimeout    time.Duration
 	DriverName        string
 	EnableNodeWatcher bool
+	// Capabilities of the driver are followed at runtime, SupportListVolume decides the check method if it is nil
+	Capabilities      *handler.CapabilitiesMonitor
 	SupportListVolume bool
 
-	ListVolumesInterval      time.Duration
-	PVWorkerExecuteInterval  time.Duration
-	VolumeListAndAddInterval time.Duration
+	ListVolumesInterval              time.Duration
+	PVWorkerExecuteInterval          time.Duration
+	UnhealthyPVWorkerExecuteInterval time.Duration
+	VolumeListAndAddInterval         time.Duration
+
+	// Failed checks of a PV are retried with an exponential backoff from RetryIntervalStart to RetryIntervalMax
+	RetryIntervalStart time.Duration
+	RetryIntervalMax   time.Duration
 
 	NodeWorkerExecuteInterval time.Duration
 	NodeListAndAddInterval    time.Duration
+	NodeFailureCriteria       NodeFailureCriteria
+	// NodeWorkerThreads is the number of nodes the node watcher processes in parallel, at least one
+	NodeWorkerThreads int
+
+	// A bound volume missing on the storage backend VolumeNotFoundThreshold consecutive times
+	// is reported abnormal once its PV is older than VolumeNotFoundGracePeriod, 0 disables it
+	VolumeNotFoundGracePeriod time.Duration
+	VolumeNotFoundThreshold   int
+
+	// EnableAttachmentDriftCheck compares the nodes volumes are published to by the driver with VolumeAttachments
+	EnableAttachmentDriftCheck bool
+
+	// Classifier maps driver messages of abnormal volumes to structured reasons, it can be nil
+	Classifier handler.Classifier
+	// DriverHealth suppresses abnormal volume events while the driver is unhealthy, it can be nil
+	DriverHealth *handler.DriverHealthMonitor
+
+	// MetricsRecorder records volume health metrics, it can be nil
+	MetricsRecorder *metrics.Recorder
+	// VolumeHealth records the health of PVCs in VolumeHealth objects, it can be nil
+	VolumeHealth *volumehealth.Updater
 }
 
-// NewPVMonitorController creates PV monitor controller
+// NewPVMonitorController creates PV monitor controller, it fails if the indexes of the informers cannot be added
 func NewPVMonitorController(
 	logger klog.Logger,
 	client kubernetes.Interface,
@@ -105,37 +160,62 @@ func NewPVMonitorController(
 	factory informers.SharedInformerFactory,
 	eventRecorder record.EventRecorder,
 	option *PVMonitorOptions,
-) *PVMonitorController {
+) (*PVMonitorController, error) {
 	ctrl := &PVMonitorController{
-		csiConn:            conn,
-		eventRecorder:      eventRecorder,
-		supportListVolumes: option.SupportListVolume,
-		enableNodeWatcher:  option.EnableNodeWatcher,
-		client:             client,
-		driverName:         option.DriverName,
-		pvQueue:            workqueue.NewNamed("csi-monitor-pv-queue"),
-
-		pvcToPodsCache: util.NewPVCToPodsCache(),
-		pvEnqueued:     make(map[string]bool),
-
-		ListVolumesInterval:      option.ListVolumesInterval,
-		PVWorkerExecuteInterval:  option.PVWorkerExecuteInterval,
-		VolumeListAndAddInterval: option.VolumeListAndAddInterval,
+		csiConn:           conn,
+		eventRecorder:     eventRecorder,
+		capabilities:      option.Capabilities,
+		enableNodeWatcher: option.EnableNodeWatcher,
+		nodeWorkerThreads: max(option.NodeWorkerThreads, 1),
+		client:            client,
+		driverName:        option.DriverName,
+		metricsRecorder:   option.MetricsRecorder,
+		pvQueue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.NewTypedItemExponentialFailureRateLimiter[pvQueueItem](option.RetryIntervalStart, option.RetryIntervalMax),
+			workqueue.TypedRateLimitingQueueConfig[pvQueueItem]{Name: "csi-monitor-pv-queue"},
+		),
+
+		pvEnqueued: make(map[string]uint64),
+
+		enableAttachmentDriftCheck: option.EnableAttachmentDriftCheck,
+		volumeHealthSynced:         option.VolumeHealth.HasSynced,
+
+		ListVolumesInterval:              option.ListVolumesInterval,
+		PVWorkerExecuteInterval:          option.PVWorkerExecuteInterval,
+		UnhealthyPVWorkerExecuteInterval: option.UnhealthyPVWorkerExecuteInterval,
+		VolumeListAndAddInterval:         option.VolumeListAndAddInterval,
+	}
+	if ctrl.capabilities == nil {
+		ctrl.capabilities = handler.NewCapabilitiesMonitor(handler.Capabilities{
+			ControllerService:         true,
+			ListVolumes:               option.SupportListVolume,
+			GetVolume:                 !option.SupportListVolume,
+			VolumeCondition:           true,
+			PublishUnpublishVolume:    true,
+			ListVolumesPublishedNodes: true,
+		}, nil, 0)
 	}
 	ctrl.setupPVInformer(factory)
 	ctrl.setupPVCInformer(factory)
-	ctrl.setupEventInformer(factory)
+	if err := ctrl.setupEventInformer(factory); err != nil {
+		return nil, err
+	}
+	if err := ctrl.setupVolumeAttachmentInformersIfNecessary(factory); err != nil {
+		return nil, err
+	}
 	ctrl.setupPVChecker(factory, client, conn, option)
-	ctrl.setupPodNodeInformersIfNecessary(factory, logger, option)
-	return ctrl
+	if err := ctrl.setupPodNodeInformersIfNecessary(factory, logger, option); err != nil {
+		return nil, err
+	}
+	return ctrl, nil
 }
 
 func (ctrl *PVMonitorController) setupPVInformer(factory informers.SharedInformerFactory) {
 	informer := factory.Core().V1().PersistentVolumes()
 	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: ctrl.pvAdded,
-		// we do not care about PV changes, so do not need UpdateFunc here.
-		// deleted PVs will not be readded to the queue, so do not need DeleteFunc here
+		AddFunc:    ctrl.pvAdded,
+		UpdateFunc: ctrl.pvUpdated,
+		DeleteFunc: ctrl.pvDeleted,
 	})
 	ctrl.pvLister = informer.Lister()
 	ctrl.pvListerSynced = informer.Informer().HasSynced
@@ -147,9 +227,9 @@ func (ctrl *PVMonitorController) setupPVCInformer(factory informers.SharedInform
 	ctrl.pvcListerSynced = informer.Informer().HasSynced
 }
 
-func (ctrl *PVMonitorController) setupEventInformer(factory informers.SharedInformerFactory) {
+func (ctrl *PVMonitorController) setupEventInformer(factory informers.SharedInformerFactory) error {
 	informer := factory.Core().V1().Events()
-	informer.Informer().AddIndexers(cache.Indexers{
+	err := informer.Informer().AddIndexers(cache.Indexers{
 		util.DefaultEventIndexerName: func(obj interface{}) ([]string, error) {
 			event := obj.(*v1.Event)
 			if event != nil {
@@ -160,6 +240,31 @@ func (ctrl *PVMonitorController) setupEventInformer(factory informers.SharedInfo
 			}
 		},
 	})
+	if err != nil {
+		return fmt.Errorf("failed to add event indexer: %v", err)
+	}
+	return nil
+}
+
+func (ctrl *PVMonitorController) setupVolumeAttachmentInformersIfNecessary(factory informers.SharedInformerFactory) error {
+	if !ctrl.enableAttachmentDriftCheck {
+		return nil
+	}
+
+	vaInformer := factory.Storage().V1().VolumeAttachments()
+	err := vaInformer.Informer().AddIndexers(cache.Indexers{
+		util.VolumeAttachmentPVIndexerName: util.VolumeAttachmentPVIndexFunc,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add VolumeAttachment PV indexer: %v", err)
+	}
+	ctrl.vaIndexer = vaInformer.Informer().GetIndexer()
+	ctrl.vaListerSynced = vaInformer.Informer().HasSynced
+
+	csiNodeInformer := factory.Storage().V1().CSINodes()
+	ctrl.csiNodeLister = csiNodeInformer.Lister()
+	ctrl.csiNodeListerSynced = csiNodeInformer.Informer().HasSynced
+	return nil
 }
 
 func (ctrl *PVMonitorController) setupPVChecker(
@@ -177,29 +282,52 @@ func (ctrl *PVMonitorController) setupPVChecker(
 		ctrl.pvLister,
 		factory.Core().V1().Events(),
 		ctrl.eventRecorder,
+		&handler.PVHealthConditionCheckerOptions{
+			MetricsRecorder:     option.MetricsRecorder,
+			NotFoundGracePeriod: option.VolumeNotFoundGracePeriod,
+			NotFoundThreshold:   option.VolumeNotFoundThreshold,
+			VAIndexer:           ctrl.vaIndexer,
+			CSINodeLister:       ctrl.csiNodeLister,
+			Classifier:          option.Classifier,
+			DriverHealth:        option.DriverHealth,
+			Capabilities:        ctrl.capabilities,
+			VolumeHealth:        option.VolumeHealth,
+		},
 	)
 }
 
-func (ctrl *PVMonitorController) setupPodNodeInformersIfNecessary(factory informers.SharedInformerFactory, logger klog.Logger, option *PVMonitorOptions) {
-	if ctrl.enableNodeWatcher {
-		ctrl.setupPodInformer(factory)
-		ctrl.setupNodeWatcher(factory, logger, option)
+func (ctrl *PVMonitorController) setupPodNodeInformersIfNecessary(factory informers.SharedInformerFactory, logger klog.Logger, option *PVMonitorOptions) error {
+	if !ctrl.enableNodeWatcher {
+		return nil
+	}
+	if err := ctrl.setupPodInformer(factory); err != nil {
+		return err
 	}
+	return ctrl.setupNodeWatcher(factory, logger, option)
 }
 
-func (ctrl *PVMonitorController) setupPodInformer(factory informers.SharedInformerFactory) {
+func (ctrl *PVMonitorController) setupPodInformer(factory informers.SharedInformerFactory) error {
 	informer := factory.Core().V1().Pods()
-	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: ctrl.podAdded,
-		// UpdateFunc: ctrl.podUpdated,  TODO: do we need this ?
-		DeleteFunc: ctrl.podDeleted,
-	})
+	pvcToPodsCache, err := util.NewPVCToPodsCache(informer.Informer())
+	if err != nil {
+		return err
+	}
+	ctrl.pvcToPodsCache = pvcToPodsCache
 	ctrl.podLister = informer.Lister()
 	ctrl.podListerSynced = informer.Informer().HasSynced
+	return nil
 }
 
-func (ctrl *PVMonitorController) setupNodeWatcher(factory informers.SharedInformerFactory, logger klog.Logger, option *PVMonitorOptions) {
-	ctrl.nodeWatcher = NewNodeWatcher(
+func (ctrl *PVMonitorController) setupNodeWatcher(factory informers.SharedInformerFactory, logger klog.Logger, option *PVMonitorOptions) error {
+	var leaseInformer cache.SharedIndexInformer
+	if option.NodeFailureCriteria.LeaseDuration > 0 {
+		// only node Leases are needed, so do not watch Leases of other namespaces
+		leaseInformer = factory.InformerFor(&coordinationv1.Lease{}, func(client kubernetes.Interface, resync time.Duration) cache.SharedIndexInformer {
+			return coordinationinformers.NewLeaseInformer(client, v1.NamespaceNodeLease, resync, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		})
+	}
+
+	nodeWatcher, err := NewNodeWatcher(
 		logger,
 		ctrl.driverName,
 		ctrl.client,
@@ -210,7 +338,17 @@ func (ctrl *PVMonitorController) setupNodeWatcher(factory informers.SharedInform
 		ctrl.pvcToPodsCache,
 		option.NodeWorkerExecuteInterval,
 		option.NodeListAndAddInterval,
+		option.NodeFailureCriteria,
+		leaseInformer,
+		factory.Storage().V1().VolumeAttachments().Informer(),
+		option.MetricsRecorder,
+		option.VolumeHealth,
 	)
+	if err != nil {
+		return err
+	}
+	ctrl.nodeWatcher = nodeWatcher
+	return nil
 }
 
 // Run runs the volume health condition checking method
@@ -227,66 +365,64 @@ func (ctrl *PVMonitorController) Run(ctx context.Context, workers int, wg *sync.
 	}
 
 	if ctrl.enableNodeWatcher {
-		go ctrl.nodeWatcher.Run(ctx)
+		go ctrl.nodeWatcher.Run(ctx, ctrl.nodeWorkerThreads)
 	}
 
-	// TODO: we need to cache the PVs info and get the diff so that we can identify the NotFound error
-	// if storage support List Volumes RPC, ListVolumes is preferred for performance reasons
-	if ctrl.supportListVolumes {
+	// Both check methods are started, the capabilities of the driver decide which of them checks
+	// volumes, so that the controller follows driver upgrades and idles while neither works
+	goRun := func(f func(ctx context.Context), period time.Duration) {
 		if utilfeature.DefaultFeatureGate.Enabled(features.ReleaseLeaderElectionOnExit) {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				wait.UntilWithContext(ctx, ctrl.checkPVsHealthConditionByListVolumes, ctrl.ListVolumesInterval)
+				wait.UntilWithContext(ctx, f, period)
 			}()
 		} else {
-			go wait.UntilWithContext(ctx, ctrl.checkPVsHealthConditionByListVolumes, ctrl.ListVolumesInterval)
+			go wait.UntilWithContext(ctx, f, period)
 		}
-	} else {
-		if utilfeature.DefaultFeatureGate.Enabled(features.ReleaseLeaderElectionOnExit) {
-			for i := 0; i < workers; i++ {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					wait.UntilWithContext(ctx, ctrl.checkPVWorker, ctrl.PVWorkerExecuteInterval)
-				}()
-			}
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				wait.UntilWithContext(ctx, func(ctx context.Context) {
-					logger := klog.FromContext(ctx)
-					err := ctrl.AddPVsToQueue()
-					if err != nil {
-						logger.Error(err, "Failed to reconcile volumes")
-					}
-				}, ctrl.VolumeListAndAddInterval)
-			}()
-		} else {
-			for i := 0; i < workers; i++ {
-				go wait.UntilWithContext(ctx, ctrl.checkPVWorker, ctrl.PVWorkerExecuteInterval)
-			}
+	}
 
-			go wait.UntilWithContext(ctx, func(ctx context.Context) {
-				logger := klog.FromContext(ctx)
-				err := ctrl.AddPVsToQueue()
-				if err != nil {
-					logger.Error(err, "Failed to reconcile volumes")
-				}
-			}, ctrl.VolumeListAndAddInterval)
-		}
+	goRun(ctrl.checkPVsHealthConditionByListVolumes, ctrl.ListVolumesInterval)
+	for i := 0; i < workers; i++ {
+		goRun(ctrl.checkPVWorker, time.Second)
 	}
+	goRun(func(ctx context.Context) {
+		logger := klog.FromContext(ctx)
+		err := ctrl.AddPVsToQueue()
+		if err != nil {
+			logger.Error(err, "Failed to reconcile volumes")
+		}
+	}, ctrl.VolumeListAndAddInterval)
 
 	<-ctx.Done()
 }
 
 func waitForCacheSyncSucceed(ctx context.Context, ctrl *PVMonitorController) bool {
 	return cache.WaitForCacheSync(ctx.Done(), ctrl.pvListerSynced, ctrl.pvcListerSynced) &&
-		(!ctrl.enableNodeWatcher || cache.WaitForCacheSync(ctx.Done(), ctrl.podListerSynced))
+		(!ctrl.enableNodeWatcher || cache.WaitForCacheSync(ctx.Done(), ctrl.podListerSynced)) &&
+		(!ctrl.enableAttachmentDriftCheck || cache.WaitForCacheSync(ctx.Done(), ctrl.vaListerSynced, ctrl.csiNodeListerSynced)) &&
+		cache.WaitForCacheSync(ctx.Done(), ctrl.volumeHealthSynced)
+}
+
+// useListVolumes returns true if volumes are currently checked with ListVolumes, it is preferred for performance reasons
+func (ctrl *PVMonitorController) useListVolumes() bool {
+	return ctrl.capabilities.Get().CanListVolumeConditions()
+}
+
+// useGetVolume returns true if volumes are currently checked with ControllerGetVolume
+func (ctrl *PVMonitorController) useGetVolume() bool {
+	capabilities := ctrl.capabilities.Get()
+	return !capabilities.CanListVolumeConditions() && capabilities.CanGetVolumeConditions()
 }
 
 func (ctrl *PVMonitorController) checkPVsHealthConditionByListVolumes(ctx context.Context) {
 	logger := klog.FromContext(ctx)
+	if !ctrl.useListVolumes() {
+		if !ctrl.capabilities.Get().CanMonitor() {
+			logger.V(2).Info("CSI driver does not support Controller ListVolumes and GetVolume service or does not implement VolumeCondition, volumes are not checked")
+		}
+		return
+	}
 	err := ctrl.pvChecker.CheckControllerListVolumeStatuses(ctx)
 	if err != nil {
 		logger.Error(err, "Check controller volume status error")
@@ -295,6 +431,10 @@ func (ctrl *PVMonitorController) checkPVsHealthConditionByListVolumes(ctx contex
 
 // AddPVsToQueue adds PVs to queue periodically
 func (ctrl *PVMonitorController) AddPVsToQueue() error {
+	if !ctrl.useGetVolume() {
+		return nil
+	}
+
 	// TODO: add PV filters when listing
 	// for example: only return CSI PVs
 	pvs, err := ctrl.pvLister.List(labels.Everything())
@@ -302,30 +442,49 @@ func (ctrl *PVMonitorController) AddPVsToQueue() error {
 		return err
 	}
 
+	monitored := 0
 	for _, pv := range pvs {
-		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != ctrl.driverName {
+		// only bound PVs are checked, others would be dropped from the queue by processNextPV
+		if !ctrl.isDriverPV(pv) || pv.Status.Phase != v1.VolumeBound || pv.Spec.ClaimRef == nil {
 			continue
 		}
-		if !ctrl.pvEnqueued[pv.Name] {
-			ctrl.Lock()
-			ctrl.pvEnqueued[pv.Name] = true
-			ctrl.pvQueue.Add(pv.Name)
-			ctrl.Unlock()
-		}
+		monitored++
+		ctrl.enqueuePV(pv.Name)
 	}
+	ctrl.metricsRecorder.SetVolumesChecked(metrics.MethodControllerGetVolume, monitored)
 
 	return nil
 }
 
+// checkPVWorker processes PVs from the queue until it is shut down
 func (ctrl *PVMonitorController) checkPVWorker(ctx context.Context) {
-	key, quit := ctrl.pvQueue.Get()
+	for ctrl.processNextPV(ctx) {
+	}
+}
+
+// processNextPV checks the next PV of the queue and schedules its next check,
+// it returns false when the queue is shut down
+func (ctrl *PVMonitorController) processNextPV(ctx context.Context) bool {
+	item, quit := ctrl.pvQueue.Get()
 	if quit {
-		return
+		return false
 	}
-	defer ctrl.pvQueue.Done(key)
+	defer ctrl.pvQueue.Done(item)
 
 	logger := klog.FromContext(ctx)
-	pvName := key.(string)
+	pvName := item.name
+	if !ctrl.isCurrentPV(item) {
+		// the PV was dequeued after this check was scheduled, it may have been enqueued again since
+		logger.V(4).Info("Dropping check of PV scheduled before it was dequeued", "pv", pvName)
+		ctrl.pvQueue.Forget(item)
+		return true
+	}
+	if !ctrl.useGetVolume() {
+		// the driver does not support ControllerGetVolume anymore, AddPVsToQueue enqueues the PV again once it does
+		logger.V(4).Info("ControllerGetVolume is not used, stop checking PV", "pv", pvName)
+		ctrl.dequeuePV(pvName)
+		return true
+	}
 	logger.V(4).Info("Started PV processing", "pv", pvName)
 
 	// get PV to process
@@ -333,33 +492,81 @@ func (ctrl *PVMonitorController) checkPVWorker(ctx context.Context) {
 	if err != nil {
 		if apierrs.IsNotFound(err) {
 			// PV was deleted in the meantime, ignore.
-			ctrl.Lock()
-			// delete pv from cache here so that we do not need to handle pv deletion events
-			delete(ctrl.pvEnqueued, pvName)
-			ctrl.Unlock()
+			ctrl.dequeuePV(pvName)
 			logger.V(3).Info("PV deleted, ignoring", "pv", pvName)
-			return
+			return true
 		}
 		logger.Error(err, "Error getting PersistentVolume", "pv", pvName)
-		ctrl.pvQueue.Add(pvName)
-		return
+		ctrl.pvQueue.AddRateLimited(item)
+		return true
 	}
 
 	if pv.DeletionTimestamp != nil {
 		logger.Info("PV is being deleted now, skip checking health condition", "pv", pv.Name)
-		return
+		ctrl.forgetPV(pv)
+		return true
 	}
 
 	if pv.Status.Phase != v1.VolumeBound {
 		logger.Info("PV status is not bound, remove it from the queue", "pv", pv.Name)
-		return
+		ctrl.forgetPV(pv)
+		return true
 	}
 
 	err = ctrl.pvChecker.CheckControllerVolumeStatus(ctx, pv)
 	if err != nil {
-		logger.Error(err, "Check controller volume status error")
+		logger.Error(err, "Check controller volume status error", "pv", pv.Name)
+		ctrl.pvQueue.AddRateLimited(item)
+		return true
 	}
 
-	// re-enqueue anyway
-	ctrl.pvQueue.Add(pvName)
+	ctrl.pvQueue.Forget(item)
+	ctrl.pvQueue.AddAfter(item, ctrl.recheckInterval(pv))
+	return true
+}
+
+// recheckInterval returns when the PV should be checked again after a successful check
+func (ctrl *PVMonitorController) recheckInterval(pv *v1.PersistentVolume) time.Duration {
+	if ctrl.UnhealthyPVWorkerExecuteInterval > 0 && ctrl.pvChecker.IsVolumeAbnormal(pv) {
+		return ctrl.UnhealthyPVWorkerExecuteInterval
+	}
+	return ctrl.PVWorkerExecuteInterval
+}
+
+// enqueuePV adds the PV to the queue unless it is already being checked
+func (ctrl *PVMonitorController) enqueuePV(pvName string) {
+	ctrl.Lock()
+	defer ctrl.Unlock()
+
+	if _, ok := ctrl.pvEnqueued[pvName]; !ok {
+		ctrl.pvGeneration++
+		ctrl.pvEnqueued[pvName] = ctrl.pvGeneration
+		ctrl.pvQueue.Add(pvQueueItem{name: pvName, generation: ctrl.pvGeneration})
+	}
+}
+
+// isCurrentPV returns true if the item is the PV as it is currently enqueued
+func (ctrl *PVMonitorController) isCurrentPV(item pvQueueItem) bool {
+	ctrl.Lock()
+	defer ctrl.Unlock()
+
+	generation, ok := ctrl.pvEnqueued[item.name]
+	return ok && generation == item.generation
+}
+
+// dequeuePV stops checking the PV, it is enqueued again once it is bound
+func (ctrl *PVMonitorController) dequeuePV(pvName string) {
+	ctrl.Lock()
+	defer ctrl.Unlock()
+
+	if generation, ok := ctrl.pvEnqueued[pvName]; ok {
+		delete(ctrl.pvEnqueued, pvName)
+		ctrl.pvQueue.Forget(pvQueueItem{name: pvName, generation: generation})
+	}
+}
+
+// forgetPV stops checking the PV and drops the health state of its volume
+func (ctrl *PVMonitorController) forgetPV(pv *v1.PersistentVolume) {
+	ctrl.dequeuePV(pv.Name)
+	ctrl.pvChecker.ForgetVolume(pv)
 }
@@ -0,0 +1,168 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+)
+
+const (
+	// VolumePublishedToUnexpectedNodeReason is the reason used when the storage backend publishes
+	// a volume to a node which Kubernetes does not attach it to
+	VolumePublishedToUnexpectedNodeReason = "VolumePublishedToUnexpectedNode"
+	// VolumeAttachmentMissingOnBackendReason is the reason used when Kubernetes attaches a volume
+	// to a node which the storage backend does not publish it to
+	VolumeAttachmentMissingOnBackendReason = "VolumeAttachmentMissingOnBackend"
+	// VolumeAttachmentDriftResolvedReason is the reason used when the attachments of a volume agree again
+	VolumeAttachmentDriftResolvedReason = "VolumeAttachmentDriftResolved"
+)
+
+// errUnmappedNode means that the node of a VolumeAttachment of the volume cannot be mapped to a CSI
+// node ID, e.g. because the node plugin is not registered yet, so the drift of the volume is unknown
+var errUnmappedNode = errors.New("cannot map node of VolumeAttachment to CSI node ID")
+
+// attachmentDrift is the difference between the nodes a volume is published to by the
+// storage backend and the nodes Kubernetes attached it to, by CSI node ID
+type attachmentDrift struct {
+	// unexpected are node IDs the backend publishes the volume to without a VolumeAttachment
+	unexpected []string
+	// missing are node IDs with an attached VolumeAttachment which the backend does not publish the volume to
+	missing []string
+}
+
+func (drift attachmentDrift) empty() bool {
+	return len(drift.unexpected) == 0 && len(drift.missing) == 0
+}
+
+// key identifies the drift, so that events are only sent when it changes
+func (drift attachmentDrift) key() string {
+	if drift.empty() {
+		return ""
+	}
+	return "unexpected=" + strings.Join(drift.unexpected, ",") + ";missing=" + strings.Join(drift.missing, ",")
+}
+
+// checkAttachmentDrift compares the nodes the volume is published to by the storage backend
+// with its VolumeAttachments and sends PVC events when they disagree
+func (checker *PVHealthConditionChecker) checkAttachmentDrift(logger klog.Logger, pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim, volumeHandle string, volumeCondition *VolumeConditionResult) {
+	// drift is reported by events, which a read-only checker must not send
+	if checker.readOnly || checker.vaIndexer == nil || checker.csiNodeLister == nil {
+		return
+	}
+
+	drift, err := checker.getAttachmentDrift(pv, volumeCondition.GetPublishedNodeIDs())
+	if errors.Is(err, errUnmappedNode) {
+		// the published node ID of that node would be reported as unexpected
+		logger.V(4).Info("Skipping attachment drift check", "pv", pv.Name, "err", err)
+		return
+	}
+	if err != nil {
+		logger.Error(err, "Failed to check attachment drift", "pv", pv.Name)
+		return
+	}
+
+	previous, changed := checker.healthStore.RecordAttachmentDrift(volumeHandle, drift.key())
+	if !changed {
+		return
+	}
+
+	if drift.empty() {
+		logger.V(2).Info("Volume attachment drift resolved", "pv", pv.Name, "previousDrift", previous)
+		checker.eventRecorder.Event(pvc, v1.EventTypeNormal, VolumeAttachmentDriftResolvedReason,
+			fmt.Sprintf("Volume %s is published to the same nodes by the storage backend and Kubernetes again", volumeHandle))
+		return
+	}
+
+	logger.Info("Volume attachment drift detected", "pv", pv.Name, "unexpectedNodeIDs", drift.unexpected, "missingNodeIDs", drift.missing)
+	if len(drift.unexpected) > 0 {
+		checker.eventRecorder.Event(pvc, v1.EventTypeWarning, VolumePublishedToUnexpectedNodeReason,
+			fmt.Sprintf("Volume %s is published to node IDs %v by the storage backend, but it is not attached to them by any VolumeAttachment", volumeHandle, drift.unexpected))
+	}
+	if len(drift.missing) > 0 {
+		checker.eventRecorder.Event(pvc, v1.EventTypeWarning, VolumeAttachmentMissingOnBackendReason,
+			fmt.Sprintf("Volume %s is attached to node IDs %v by VolumeAttachments, but it is not published to them by the storage backend", volumeHandle, drift.missing))
+	}
+}
+
+// getAttachmentDrift computes the attachment drift of the PV, it returns errUnmappedNode if the node of
+// any VolumeAttachment cannot be mapped to a CSI node ID
+func (checker *PVHealthConditionChecker) getAttachmentDrift(pv *v1.PersistentVolume, publishedNodeIDs []string) (attachmentDrift, error) {
+	objs, err := checker.vaIndexer.ByIndex(util.VolumeAttachmentPVIndexerName, pv.Name)
+	if err != nil {
+		return attachmentDrift{}, err
+	}
+
+	// nodes with a VolumeAttachment in any state, used to tolerate attach/detach in progress
+	known := make(map[string]bool)
+	// nodes with an attached VolumeAttachment which is not being deleted
+	attached := make(map[string]bool)
+	for _, obj := range objs {
+		va, ok := obj.(*storagev1.VolumeAttachment)
+		if !ok || va.Spec.Attacher != checker.driverName {
+			continue
+		}
+		nodeID, err := checker.getCSINodeID(va.Spec.NodeName)
+		if err != nil {
+			return attachmentDrift{}, fmt.Errorf("%w: node %s of VolumeAttachment %s: %v", errUnmappedNode, va.Spec.NodeName, va.Name, err)
+		}
+		known[nodeID] = true
+		if va.Status.Attached && va.DeletionTimestamp == nil {
+			attached[nodeID] = true
+		}
+	}
+
+	published := make(map[string]bool)
+	drift := attachmentDrift{}
+	for _, nodeID := range publishedNodeIDs {
+		published[nodeID] = true
+		if !known[nodeID] {
+			drift.unexpected = append(drift.unexpected, nodeID)
+		}
+	}
+	for nodeID := range attached {
+		if !published[nodeID] {
+			drift.missing = append(drift.missing, nodeID)
+		}
+	}
+	sort.Strings(drift.unexpected)
+	sort.Strings(drift.missing)
+
+	return drift, nil
+}
+
+// getCSINodeID returns the node ID of the driver on the node from its CSINode object
+func (checker *PVHealthConditionChecker) getCSINodeID(nodeName string) (string, error) {
+	csiNode, err := checker.csiNodeLister.Get(nodeName)
+	if err != nil {
+		return "", err
+	}
+	for _, driver := range csiNode.Spec.Drivers {
+		if driver.Name == checker.driverName {
+			return driver.NodeID, nil
+		}
+	}
+	return "", fmt.Errorf("driver %s is not registered on CSINode %s", checker.driverName, nodeName)
+}
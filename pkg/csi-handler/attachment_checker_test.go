@@ -0,0 +1,138 @@
+package csi_handler
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func createVolumeAttachment(name, pvName, nodeName string, attached bool) *storagev1.VolumeAttachment {
+	return &storagev1.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: storagev1.VolumeAttachmentSpec{
+			Attacher: mock.DriverName,
+			NodeName: nodeName,
+			Source: storagev1.VolumeAttachmentSource{
+				PersistentVolumeName: &pvName,
+			},
+		},
+		Status: storagev1.VolumeAttachmentStatus{
+			Attached: attached,
+		},
+	}
+}
+
+func createCSINode(nodeName, nodeID string) *storagev1.CSINode {
+	return &storagev1.CSINode{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Spec: storagev1.CSINodeSpec{
+			Drivers: []storagev1.CSINodeDriver{
+				{Name: mock.DriverName, NodeID: nodeID},
+			},
+		},
+	}
+}
+
+func TestPVHealthConditionChecker_CheckAttachmentDrift(t *testing.T) {
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+
+	tests := []struct {
+		name              string
+		volumeAttachments []*storagev1.VolumeAttachment
+		publishedNodeIDs  [][]string
+		readOnly          bool
+		wantEvents        [][]string
+	}{
+		{
+			name:              "no drift",
+			volumeAttachments: []*storagev1.VolumeAttachment{createVolumeAttachment("va-1", "pv", "node-1", true)},
+			publishedNodeIDs:  [][]string{{"node-id-1"}},
+			wantEvents:        [][]string{nil},
+		},
+		{
+			name:              "published to unexpected node",
+			volumeAttachments: []*storagev1.VolumeAttachment{createVolumeAttachment("va-1", "pv", "node-1", true)},
+			publishedNodeIDs:  [][]string{{"node-id-1", "node-id-2"}, {"node-id-1", "node-id-2"}, {"node-id-1"}},
+			wantEvents: [][]string{
+				{"Warning VolumePublishedToUnexpectedNode Volume 1 is published to node IDs [node-id-2] by the storage backend, but it is not attached to them by any VolumeAttachment"},
+				nil,
+				{"Normal VolumeAttachmentDriftResolved Volume 1 is published to the same nodes by the storage backend and Kubernetes again"},
+			},
+		},
+		{
+			name:              "attachment missing on backend",
+			volumeAttachments: []*storagev1.VolumeAttachment{createVolumeAttachment("va-1", "pv", "node-1", true)},
+			publishedNodeIDs:  [][]string{nil},
+			wantEvents: [][]string{
+				{"Warning VolumeAttachmentMissingOnBackend Volume 1 is attached to node IDs [node-id-1] by VolumeAttachments, but it is not published to them by the storage backend"},
+			},
+		},
+		{
+			name:              "read only",
+			volumeAttachments: []*storagev1.VolumeAttachment{createVolumeAttachment("va-1", "pv", "node-1", true)},
+			publishedNodeIDs:  [][]string{{"node-id-2"}},
+			readOnly:          true,
+			wantEvents:        [][]string{nil},
+		},
+		{
+			name: "node plugin not registered",
+			volumeAttachments: []*storagev1.VolumeAttachment{
+				createVolumeAttachment("va-1", "pv", "node-1", true),
+				createVolumeAttachment("va-3", "pv", "node-3", true),
+			},
+			publishedNodeIDs: [][]string{{"node-id-1", "node-id-3"}, {"node-id-1"}},
+			wantEvents:       [][]string{nil, nil},
+		},
+		{
+			name:              "attach in progress",
+			volumeAttachments: []*storagev1.VolumeAttachment{createVolumeAttachment("va-2", "pv", "node-2", false)},
+			publishedNodeIDs:  [][]string{{"node-id-2"}, nil},
+			wantEvents:        [][]string{nil, nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			checker := createMockPVHealthConditionChecker(t).pvHealthConditionChecker
+			eventStore := make(chan string, 10)
+			checker.eventRecorder = &record.FakeRecorder{Events: eventStore}
+			checker.SetReadOnly(tt.readOnly)
+
+			vaIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+				util.VolumeAttachmentPVIndexerName: util.VolumeAttachmentPVIndexFunc,
+			})
+			for _, va := range tt.volumeAttachments {
+				assert.Nil(vaIndexer.Add(va))
+			}
+			csiNodeIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			assert.Nil(csiNodeIndexer.Add(createCSINode("node-1", "node-id-1")))
+			assert.Nil(csiNodeIndexer.Add(createCSINode("node-2", "node-id-2")))
+			checker.vaIndexer = vaIndexer
+			checker.csiNodeLister = storagelisters.NewCSINodeLister(csiNodeIndexer)
+
+			_, ctx := ktesting.NewTestContext(t)
+			logger := klog.FromContext(ctx)
+			for i, nodeIDs := range tt.publishedNodeIDs {
+				checker.checkAttachmentDrift(logger, pv, pvc, "1", &VolumeConditionResult{publishedNodeIDs: nodeIDs})
+
+				var events []string
+				for len(eventStore) > 0 {
+					events = append(events, <-eventStore)
+				}
+				assert.Equal(tt.wantEvents[i], events, "check %d", i)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// capabilitiesRetryInterval is the interval of re-probing the capabilities after the connection
+// to the driver was lost, until the driver answers again
+const capabilitiesRetryInterval = time.Second
+
+// Capabilities are the capabilities of the CSI driver which decide how volumes are checked
+type Capabilities struct {
+	ControllerService         bool
+	ListVolumes               bool
+	GetVolume                 bool
+	VolumeCondition           bool
+	PublishUnpublishVolume    bool
+	ListVolumesPublishedNodes bool
+}
+
+// CanListVolumeConditions returns true if volume conditions can be checked with ListVolumes
+func (caps Capabilities) CanListVolumeConditions() bool {
+	return caps.ControllerService && caps.ListVolumes && caps.VolumeCondition
+}
+
+// CanGetVolumeConditions returns true if volume conditions can be checked with ControllerGetVolume
+func (caps Capabilities) CanGetVolumeConditions() bool {
+	return caps.ControllerService && caps.GetVolume && caps.VolumeCondition
+}
+
+// CanMonitor returns true if volume conditions can be checked at all
+func (caps Capabilities) CanMonitor() bool {
+	return caps.CanListVolumeConditions() || caps.CanGetVolumeConditions()
+}
+
+// SupportsAttachmentDriftCheck returns true if the driver reports the nodes volumes are published to
+// by the method used to check volumes
+func (caps Capabilities) SupportsAttachmentDriftCheck(listVolumes bool) bool {
+	if !caps.PublishUnpublishVolume {
+		return false
+	}
+	return !listVolumes || caps.ListVolumesPublishedNodes
+}
+
+// CapabilitiesMonitor re-detects the capabilities of the CSI driver periodically and after the
+// connection to the driver was lost, so that the monitor follows driver upgrades instead of
+// requiring a restart.
+type CapabilitiesMonitor struct {
+	detect   func(ctx context.Context) (Capabilities, error)
+	interval time.Duration
+	// invalidated wakes up Run to re-probe the capabilities
+	invalidated chan struct{}
+
+	// used for updating the fields below
+	sync.RWMutex
+	capabilities Capabilities
+	// stale is true from a lost connection until the capabilities were detected again
+	stale bool
+}
+
+// NewCapabilitiesMonitor creates a CapabilitiesMonitor with the initially detected capabilities.
+// The capabilities never change if detect is nil.
+func NewCapabilitiesMonitor(capabilities Capabilities, detect func(ctx context.Context) (Capabilities, error), interval time.Duration) *CapabilitiesMonitor {
+	return &CapabilitiesMonitor{
+		detect:       detect,
+		interval:     interval,
+		invalidated:  make(chan struct{}, 1),
+		capabilities: capabilities,
+	}
+}
+
+// Get returns the current capabilities of the driver
+func (monitor *CapabilitiesMonitor) Get() Capabilities {
+	monitor.RLock()
+	defer monitor.RUnlock()
+
+	return monitor.capabilities
+}
+
+// Run re-detects the capabilities every interval and when they are invalidated, until ctx is done.
+// A zero interval only re-detects invalidated capabilities.
+func (monitor *CapabilitiesMonitor) Run(ctx context.Context) {
+	if monitor.detect == nil {
+		return
+	}
+
+	logger := klog.FromContext(ctx)
+	for {
+		var next <-chan time.Time
+		if monitor.isStale() {
+			next = time.After(capabilitiesRetryInterval)
+		} else if monitor.interval > 0 {
+			next = time.After(monitor.interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-monitor.invalidated:
+		case <-next:
+		}
+
+		if err := monitor.Refresh(ctx); err != nil {
+			logger.V(4).Info("Failed to detect the capabilities of the CSI driver, keeping the previous ones", "err", err)
+		}
+	}
+}
+
+// Invalidate marks the capabilities stale, they are re-detected until the driver answers again.
+// It is called when the connection to the driver is lost, a nil monitor ignores it.
+func (monitor *CapabilitiesMonitor) Invalidate() {
+	if monitor == nil {
+		return
+	}
+	monitor.Lock()
+	monitor.stale = true
+	monitor.Unlock()
+
+	select {
+	case monitor.invalidated <- struct{}{}:
+	default:
+	}
+}
+
+func (monitor *CapabilitiesMonitor) isStale() bool {
+	monitor.RLock()
+	defer monitor.RUnlock()
+
+	return monitor.stale
+}
+
+// Refresh detects the capabilities of the driver now, the previous capabilities are kept on errors
+func (monitor *CapabilitiesMonitor) Refresh(ctx context.Context) error {
+	if monitor.detect == nil {
+		return nil
+	}
+
+	capabilities, err := monitor.detect(ctx)
+	if err != nil {
+		return err
+	}
+
+	monitor.Lock()
+	previous := monitor.capabilities
+	monitor.capabilities = capabilities
+	monitor.stale = false
+	monitor.Unlock()
+
+	if previous != capabilities {
+		klog.FromContext(ctx).Info("Capabilities of the CSI driver changed", "previous", previous, "current", capabilities)
+	}
+	return nil
+}
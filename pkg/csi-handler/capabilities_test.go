@@ -0,0 +1,117 @@
+package csi_handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/klog/v2/ktesting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilities_CheckMethods(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities Capabilities
+		wantList     bool
+		wantGet      bool
+	}{
+		{
+			name:         "ListVolumes and ControllerGetVolume",
+			capabilities: Capabilities{ControllerService: true, ListVolumes: true, GetVolume: true, VolumeCondition: true},
+			wantList:     true,
+			wantGet:      true,
+		},
+		{
+			name:         "ControllerGetVolume only",
+			capabilities: Capabilities{ControllerService: true, GetVolume: true, VolumeCondition: true},
+			wantGet:      true,
+		},
+		{
+			name:         "no VolumeCondition",
+			capabilities: Capabilities{ControllerService: true, ListVolumes: true, GetVolume: true},
+		},
+		{
+			name:         "no controller service",
+			capabilities: Capabilities{ListVolumes: true, GetVolume: true, VolumeCondition: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantList, tt.capabilities.CanListVolumeConditions())
+			assert.Equal(t, tt.wantGet, tt.capabilities.CanGetVolumeConditions())
+			assert.Equal(t, tt.wantList || tt.wantGet, tt.capabilities.CanMonitor())
+		})
+	}
+}
+
+func TestCapabilities_SupportsAttachmentDriftCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(Capabilities{ListVolumesPublishedNodes: true}.SupportsAttachmentDriftCheck(true))
+	assert.True(Capabilities{PublishUnpublishVolume: true}.SupportsAttachmentDriftCheck(false))
+	assert.False(Capabilities{PublishUnpublishVolume: true}.SupportsAttachmentDriftCheck(true))
+	assert.True(Capabilities{PublishUnpublishVolume: true, ListVolumesPublishedNodes: true}.SupportsAttachmentDriftCheck(true))
+}
+
+func TestCapabilitiesMonitor_Refresh(t *testing.T) {
+	assert := assert.New(t)
+	_, ctx := ktesting.NewTestContext(t)
+
+	var lock sync.Mutex
+	detected := Capabilities{ControllerService: true, GetVolume: true}
+	var detectErr error
+	monitor := NewCapabilitiesMonitor(detected, func(ctx context.Context) (Capabilities, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return detected, detectErr
+	}, time.Hour)
+	assert.False(monitor.Get().CanMonitor())
+
+	// the driver was upgraded to a version which supports VolumeCondition
+	lock.Lock()
+	detected.VolumeCondition = true
+	lock.Unlock()
+	assert.Nil(monitor.Refresh(ctx))
+	assert.True(monitor.Get().CanGetVolumeConditions())
+
+	// the previous capabilities are kept while the driver does not answer
+	lock.Lock()
+	detected, detectErr = Capabilities{}, errors.New("connection refused")
+	lock.Unlock()
+	assert.NotNil(monitor.Refresh(ctx))
+	assert.True(monitor.Get().CanGetVolumeConditions())
+}
+
+func TestCapabilitiesMonitor_Invalidate(t *testing.T) {
+	assert := assert.New(t)
+	_, ctx := ktesting.NewTestContext(t)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lock sync.Mutex
+	detections := 0
+	monitor := NewCapabilitiesMonitor(Capabilities{}, func(ctx context.Context) (Capabilities, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		detections++
+		if detections < 3 {
+			// the driver is still reconnecting
+			return Capabilities{}, errors.New("connection refused")
+		}
+		return Capabilities{ControllerService: true, ListVolumes: true, VolumeCondition: true}, nil
+	}, 0)
+	go monitor.Run(ctx)
+
+	// the capabilities are only detected again after a lost connection, until it succeeds
+	assert.Never(func() bool { return monitor.Get().CanMonitor() }, 100*time.Millisecond, 10*time.Millisecond)
+	monitor.Invalidate()
+	assert.Eventually(func() bool { return monitor.Get().CanListVolumeConditions() }, 5*time.Second, 10*time.Millisecond)
+	assert.False(monitor.isStale())
+
+	var nilMonitor *CapabilitiesMonitor
+	nilMonitor.Invalidate()
+}
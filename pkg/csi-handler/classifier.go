@@ -0,0 +1,178 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Severity is how severe an abnormal volume condition is
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+
+	// DefaultSeverity is the severity of abnormal volume conditions which are not classified
+	DefaultSeverity = SeverityWarning
+)
+
+var (
+	// reasonRegexp matches valid reasons, they are used as event and condition reasons
+	reasonRegexp = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+)
+
+// Classification is the structured reason of an abnormal volume condition
+type Classification struct {
+	Reason   string
+	Severity Severity
+}
+
+// Classifier maps the message of an abnormal volume condition reported by a CSI driver to a structured reason
+type Classifier interface {
+	// Classify returns the classification of the message and whether the message is known
+	Classify(message string) (Classification, bool)
+	// Reasons returns all reasons Classify can return
+	Reasons() []string
+}
+
+// ClassifierRule matches driver messages by prefix or regular expression
+type ClassifierRule struct {
+	// Prefix matches messages starting with it, case insensitive
+	Prefix string `json:"prefix,omitempty"`
+	// Regex matches messages containing a match of the regular expression
+	Regex string `json:"regex,omitempty"`
+
+	Reason   string   `json:"reason"`
+	Severity Severity `json:"severity,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+func (rule *ClassifierRule) matches(message string) bool {
+	if rule.regex != nil {
+		return rule.regex.MatchString(message)
+	}
+	return strings.HasPrefix(strings.ToLower(message), strings.ToLower(rule.Prefix))
+}
+
+// ClassifierConfig holds the classifier rules of CSI drivers
+type ClassifierConfig struct {
+	// Drivers holds the rules by driver name, the rules of "*" apply to all drivers after their own rules
+	Drivers map[string][]ClassifierRule `json:"drivers"`
+}
+
+// RuleClassifier classifies messages by the first matching rule
+type RuleClassifier struct {
+	rules []ClassifierRule
+}
+
+var _ Classifier = &RuleClassifier{}
+
+// NewRuleClassifier validates the rules and creates a RuleClassifier from them
+func NewRuleClassifier(rules []ClassifierRule) (*RuleClassifier, error) {
+	classifier := &RuleClassifier{}
+	for i, rule := range rules {
+		if (rule.Prefix == "") == (rule.Regex == "") {
+			return nil, fmt.Errorf("rule %d: exactly one of prefix and regex must be set", i)
+		}
+		if !reasonRegexp.MatchString(rule.Reason) {
+			return nil, fmt.Errorf("rule %d: reason %q must be UpperCamelCase", i, rule.Reason)
+		}
+		switch rule.Severity {
+		case "":
+			rule.Severity = DefaultSeverity
+		case SeverityInfo, SeverityWarning, SeverityCritical:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown severity %q", i, rule.Severity)
+		}
+		if rule.Regex != "" {
+			regex, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i, err)
+			}
+			rule.regex = regex
+		}
+		classifier.rules = append(classifier.rules, rule)
+	}
+	return classifier, nil
+}
+
+// LoadClassifier reads the classifier rules of the driver from a YAML or JSON file
+func LoadClassifier(path, driverName string) (*RuleClassifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &ClassifierConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse classifier config %s: %v", path, err)
+	}
+
+	// the rules of the driver are cloned, so that appending does not write into the array of the config
+	rules := append(slices.Clone(config.Drivers[driverName]), config.Drivers["*"]...)
+	classifier, err := NewRuleClassifier(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid classifier config %s for driver %s: %v", path, driverName, err)
+	}
+	return classifier, nil
+}
+
+// Classify implements Classifier
+func (classifier *RuleClassifier) Classify(message string) (Classification, bool) {
+	for i := range classifier.rules {
+		if classifier.rules[i].matches(message) {
+			return Classification{Reason: classifier.rules[i].Reason, Severity: classifier.rules[i].Severity}, true
+		}
+	}
+	return Classification{}, false
+}
+
+// Reasons implements Classifier
+func (classifier *RuleClassifier) Reasons() []string {
+	var reasons []string
+	seen := map[string]bool{}
+	for _, rule := range classifier.rules {
+		if !seen[rule.Reason] {
+			seen[rule.Reason] = true
+			reasons = append(reasons, rule.Reason)
+		}
+	}
+	return reasons
+}
+
+// classifyVolumeCondition sets the reason and severity of an abnormal volume condition reported by the driver
+func classifyVolumeCondition(classifier Classifier, volumeCondition *VolumeConditionResult) {
+	if !volumeCondition.GetAbnormal() || volumeCondition.reason != "" {
+		return
+	}
+	volumeCondition.severity = DefaultSeverity
+	if classifier == nil {
+		return
+	}
+	if classification, ok := classifier.Classify(volumeCondition.GetMessage()); ok {
+		volumeCondition.reason = classification.Reason
+		volumeCondition.severity = classification.Severity
+	}
+}
@@ -0,0 +1,69 @@
+package csi_handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadClassifier(t *testing.T) {
+	config := `
+drivers:
+  fake.csi.driver.io:
+    - prefix: "replica lost"
+      reason: ReplicaLost
+      severity: critical
+    - regex: "read[- ]only"
+      reason: ReadOnly
+  "*":
+    - regex: "(?i)unreachable|timed out"
+      reason: Unreachable
+      severity: critical
+    - prefix: "degraded"
+      reason: DiskDegraded
+  other.csi.driver.io:
+    - prefix: "degraded"
+      reason: OtherReason
+`
+	path := filepath.Join(t.TempDir(), "classifier.yaml")
+	assert.Nil(t, os.WriteFile(path, []byte(config), 0644))
+	classifier, err := LoadClassifier(path, "fake.csi.driver.io")
+	assert.Nil(t, err)
+
+	tests := []struct {
+		message string
+		want    Classification
+		wantOK  bool
+	}{
+		{"Replica Lost on node-1", Classification{Reason: "ReplicaLost", Severity: SeverityCritical}, true},
+		{"volume is mounted read-only", Classification{Reason: "ReadOnly", Severity: SeverityWarning}, true},
+		{"backend Unreachable", Classification{Reason: "Unreachable", Severity: SeverityCritical}, true},
+		{"degraded array", Classification{Reason: "DiskDegraded", Severity: SeverityWarning}, true},
+		{"something else", Classification{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := classifier.Classify(tt.message)
+		assert.Equal(t, tt.wantOK, ok, tt.message)
+		assert.Equal(t, tt.want, got, tt.message)
+	}
+	assert.Equal(t, []string{"ReplicaLost", "ReadOnly", "Unreachable", "DiskDegraded"}, classifier.Reasons())
+}
+
+func TestNewRuleClassifier_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ClassifierRule
+	}{
+		{"no matcher", ClassifierRule{Reason: "ReadOnly"}},
+		{"prefix and regex", ClassifierRule{Prefix: "a", Regex: "b", Reason: "ReadOnly"}},
+		{"invalid reason", ClassifierRule{Prefix: "a", Reason: "read only"}},
+		{"invalid severity", ClassifierRule{Prefix: "a", Reason: "ReadOnly", Severity: "fatal"}},
+		{"invalid regex", ClassifierRule{Regex: "(", Reason: "ReadOnly"}},
+	}
+	for _, tt := range tests {
+		_, err := NewRuleClassifier([]ClassifierRule{tt.rule})
+		assert.Error(t, err, tt.name)
+	}
+}
@@ -0,0 +1,440 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConformanceResult is the result of one conformance check
+type ConformanceResult string
+
+const (
+	// ConformancePass means the driver behaves as the health monitor expects
+	ConformancePass ConformanceResult = "Pass"
+	// ConformanceFail means the driver violates the CSI spec or the expectations of the health monitor
+	ConformanceFail ConformanceResult = "Fail"
+	// ConformanceSkip means the check does not apply, e.g. because the driver lacks a capability
+	ConformanceSkip ConformanceResult = "Skip"
+)
+
+const (
+	// maxConditionMessageLength is the maximum length of event messages, longer volume condition
+	// messages are truncated in the events sent for them
+	maxConditionMessageLength = 1024
+	// maxListVolumesPages stops following the NextToken of drivers which never return an empty one
+	maxListVolumesPages = 10000
+	// invalidStartingToken is passed to ListVolumes to check that the driver rejects unknown tokens
+	invalidStartingToken = "external-health-monitor-conformance-invalid-token"
+)
+
+// ConformanceCheck is the result of one check of the volume condition implementation of a driver
+type ConformanceCheck struct {
+	Name   string            `json:"name"`
+	Result ConformanceResult `json:"result"`
+	// Details explain failures and skips, or what the check could not verify
+	Details []string `json:"details,omitempty"`
+}
+
+// failf marks the check failed with the reason
+func (check *ConformanceCheck) failf(format string, args ...interface{}) {
+	check.Result = ConformanceFail
+	check.Details = append(check.Details, fmt.Sprintf(format, args...))
+}
+
+// notef adds a note to the check without changing its result
+func (check *ConformanceCheck) notef(format string, args ...interface{}) {
+	check.Details = append(check.Details, fmt.Sprintf(format, args...))
+}
+
+func skippedCheck(name, reason string) ConformanceCheck {
+	return ConformanceCheck{Name: name, Result: ConformanceSkip, Details: []string{reason}}
+}
+
+// ConformanceReport is the result of all conformance checks of a driver
+type ConformanceReport struct {
+	Driver string             `json:"driver"`
+	Checks []ConformanceCheck `json:"checks"`
+}
+
+// Passed returns true if no check failed
+func (report *ConformanceReport) Passed() bool {
+	for _, check := range report.Checks {
+		if check.Result == ConformanceFail {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTable writes the report as a table with one check per line
+func (report *ConformanceReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tRESULT\tDETAILS")
+	for _, check := range report.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", check.Name, check.Result, strings.Join(check.Details, "; "))
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as indented JSON
+func (report *ConformanceReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// ConformanceOptions configure the conformance checks
+type ConformanceOptions struct {
+	// Capabilities decide which checks apply
+	Capabilities Capabilities
+	// Timeout limits each RPC
+	Timeout time.Duration
+	// PageSize is the max_entries of the paginated ListVolumes calls
+	PageSize int32
+	// MaxVolumes limits the number of ControllerGetVolume calls
+	MaxVolumes int
+	// VolumeIDs are checked with ControllerGetVolume in addition to the volumes returned by ListVolumes
+	VolumeIDs []string
+}
+
+// observedCondition is a volume condition reported by ListVolumes or ControllerGetVolume
+type observedCondition struct {
+	source    string
+	volumeID  string
+	condition *csi.VolumeCondition
+}
+
+// ConformanceChecker validates that the volume condition implementation of a driver behaves as the
+// health monitor expects. The checks share the results of the RPCs, so that every volume is
+// listed and fetched only once.
+type ConformanceChecker struct {
+	handler *csiPVHandler
+	options ConformanceOptions
+
+	// listed are all volumes returned by an unpaginated ListVolumes, nil if it failed or is not supported
+	listed []*csi.ListVolumesResponse_Entry
+	// fetched are the ControllerGetVolume responses by volume ID
+	fetched    map[string]*csi.ControllerGetVolumeResponse
+	conditions []observedCondition
+}
+
+// NewConformanceChecker creates a ConformanceChecker for the driver at conn
+func NewConformanceChecker(conn *grpc.ClientConn, options ConformanceOptions) *ConformanceChecker {
+	if options.PageSize <= 0 {
+		options.PageSize = 1
+	}
+	return &ConformanceChecker{
+		handler: &csiPVHandler{controllerClient: csi.NewControllerClient(conn)},
+		options: options,
+		fetched: map[string]*csi.ControllerGetVolumeResponse{},
+	}
+}
+
+// Run runs all checks against the driver
+func (checker *ConformanceChecker) Run(ctx context.Context, driverName string) *ConformanceReport {
+	report := &ConformanceReport{Driver: driverName}
+	report.Checks = append(report.Checks, checker.checkListVolumesPagination(ctx))
+	report.Checks = append(report.Checks, checker.checkListVolumesStatus())
+	report.Checks = append(report.Checks, checker.checkGetVolumeStatus(ctx))
+	report.Checks = append(report.Checks, checker.checkListGetAgreement())
+	report.Checks = append(report.Checks, checker.checkGetVolumeNotFound(ctx))
+	report.Checks = append(report.Checks, checker.checkMessages())
+	return report
+}
+
+func (checker *ConformanceChecker) supportsListVolumes() bool {
+	return checker.options.Capabilities.ControllerService && checker.options.Capabilities.ListVolumes
+}
+
+func (checker *ConformanceChecker) supportsGetVolume() bool {
+	return checker.options.Capabilities.ControllerService && checker.options.Capabilities.GetVolume
+}
+
+// listAll follows the NextToken of ListVolumes with pages of at most maxEntries volumes and returns all pages
+func (checker *ConformanceChecker) listAll(ctx context.Context, maxEntries int32) ([]*csi.ListVolumesResponse, error) {
+	var pages []*csi.ListVolumesResponse
+	token := ""
+	for len(pages) < maxListVolumesPages {
+		rsp, err := checker.listVolumesPage(ctx, maxEntries, token)
+		if err != nil {
+			return pages, err
+		}
+		pages = append(pages, rsp)
+		token = rsp.GetNextToken()
+		if token == "" {
+			return pages, nil
+		}
+	}
+	return pages, fmt.Errorf("next_token is still set after %d pages", maxListVolumesPages)
+}
+
+func (checker *ConformanceChecker) listVolumesPage(ctx context.Context, maxEntries int32, token string) (*csi.ListVolumesResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, checker.options.Timeout)
+	defer cancel()
+	return checker.handler.listVolumesPage(ctx, maxEntries, token)
+}
+
+// checkListVolumesPagination checks that paginated ListVolumes calls return the same volumes as an
+// unpaginated one, without duplicates and without exceeding max_entries, and that unknown
+// starting tokens are rejected with ABORTED
+func (checker *ConformanceChecker) checkListVolumesPagination(ctx context.Context) ConformanceCheck {
+	const name = "ListVolumesPagination"
+	if !checker.supportsListVolumes() {
+		return skippedCheck(name, "LIST_VOLUMES is not supported")
+	}
+	check := ConformanceCheck{Name: name, Result: ConformancePass}
+
+	pages, err := checker.listAll(ctx, 0)
+	if err != nil {
+		check.failf("ListVolumes failed: %v", err)
+		return check
+	}
+	listed := map[string]bool{}
+	checker.listed = []*csi.ListVolumesResponse_Entry{}
+	for _, page := range pages {
+		for _, entry := range page.GetEntries() {
+			checker.listed = append(checker.listed, entry)
+			listed[entry.GetVolume().GetVolumeId()] = true
+		}
+	}
+
+	pageSize := checker.options.PageSize
+	pages, err = checker.listAll(ctx, pageSize)
+	if err != nil {
+		check.failf("ListVolumes with max_entries %d failed after %d pages: %v", pageSize, len(pages), err)
+		return check
+	}
+	paged := map[string]bool{}
+	for i, page := range pages {
+		if len(page.GetEntries()) > int(pageSize) {
+			check.failf("page %d has %d entries, more than max_entries %d", i+1, len(page.GetEntries()), pageSize)
+		}
+		for _, entry := range page.GetEntries() {
+			volumeID := entry.GetVolume().GetVolumeId()
+			if paged[volumeID] {
+				check.failf("volume %s is returned by more than one page", volumeID)
+			}
+			paged[volumeID] = true
+		}
+	}
+	for volumeID := range listed {
+		if !paged[volumeID] {
+			check.failf("volume %s is missing in the paginated result", volumeID)
+		}
+	}
+	for volumeID := range paged {
+		if !listed[volumeID] {
+			check.failf("volume %s is only in the paginated result", volumeID)
+		}
+	}
+	if len(listed) <= int(pageSize) {
+		check.notef("pagination was not exercised, %d volumes fit into one page of max_entries %d", len(listed), pageSize)
+	}
+
+	_, err = checker.listVolumesPage(ctx, pageSize, invalidStartingToken)
+	if status.Code(err) != codes.Aborted {
+		check.failf("ListVolumes with an invalid starting_token returned %s instead of ABORTED", status.Code(err))
+	}
+	return check
+}
+
+// checkListVolumesStatus checks that ListVolumes returns the condition of every volume
+func (checker *ConformanceChecker) checkListVolumesStatus() ConformanceCheck {
+	const name = "ListVolumesStatus"
+	switch {
+	case !checker.supportsListVolumes():
+		return skippedCheck(name, "LIST_VOLUMES is not supported")
+	case !checker.options.Capabilities.VolumeCondition:
+		return skippedCheck(name, "VOLUME_CONDITION is not supported")
+	case checker.listed == nil:
+		return skippedCheck(name, "ListVolumes failed")
+	}
+	check := ConformanceCheck{Name: name, Result: ConformancePass}
+
+	for _, entry := range checker.listed {
+		volumeID := entry.GetVolume().GetVolumeId()
+		if entry.GetStatus() == nil {
+			check.failf("volume %s has no status", volumeID)
+			continue
+		}
+		condition := entry.GetStatus().GetVolumeCondition()
+		if condition == nil {
+			check.failf("volume %s has no volume_condition", volumeID)
+			continue
+		}
+		checker.conditions = append(checker.conditions, observedCondition{source: "ListVolumes", volumeID: volumeID, condition: condition})
+	}
+	return check
+}
+
+// checkGetVolumeStatus checks that ControllerGetVolume returns the requested volume with its condition
+func (checker *ConformanceChecker) checkGetVolumeStatus(ctx context.Context) ConformanceCheck {
+	const name = "ControllerGetVolumeStatus"
+	if !checker.supportsGetVolume() {
+		return skippedCheck(name, "GET_VOLUME is not supported")
+	}
+	if !checker.options.Capabilities.VolumeCondition {
+		return skippedCheck(name, "VOLUME_CONDITION is not supported")
+	}
+
+	volumeIDs := checker.volumeIDs()
+	if len(volumeIDs) == 0 {
+		return skippedCheck(name, "no volumes to get, ListVolumes returned none and no volume IDs were given")
+	}
+	check := ConformanceCheck{Name: name, Result: ConformancePass}
+
+	for _, volumeID := range volumeIDs {
+		rsp, err := checker.getVolume(ctx, volumeID)
+		if err != nil {
+			check.failf("ControllerGetVolume of volume %s failed: %v", volumeID, err)
+			continue
+		}
+		checker.fetched[volumeID] = rsp
+		if rsp.GetVolume().GetVolumeId() != volumeID {
+			check.failf("ControllerGetVolume of volume %s returned volume %q", volumeID, rsp.GetVolume().GetVolumeId())
+		}
+		if rsp.GetStatus() == nil {
+			check.failf("volume %s has no status", volumeID)
+			continue
+		}
+		condition := rsp.GetStatus().GetVolumeCondition()
+		if condition == nil {
+			check.failf("volume %s has no volume_condition", volumeID)
+			continue
+		}
+		checker.conditions = append(checker.conditions, observedCondition{source: "ControllerGetVolume", volumeID: volumeID, condition: condition})
+	}
+	return check
+}
+
+// volumeIDs returns the volumes to get, the given ones first, up to MaxVolumes
+func (checker *ConformanceChecker) volumeIDs() []string {
+	seen := map[string]bool{}
+	var volumeIDs []string
+	add := func(volumeID string) {
+		if volumeID == "" || seen[volumeID] || (checker.options.MaxVolumes > 0 && len(volumeIDs) >= checker.options.MaxVolumes) {
+			return
+		}
+		seen[volumeID] = true
+		volumeIDs = append(volumeIDs, volumeID)
+	}
+	for _, volumeID := range checker.options.VolumeIDs {
+		add(volumeID)
+	}
+	for _, entry := range checker.listed {
+		add(entry.GetVolume().GetVolumeId())
+	}
+	return volumeIDs
+}
+
+func (checker *ConformanceChecker) getVolume(ctx context.Context, volumeID string) (*csi.ControllerGetVolumeResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, checker.options.Timeout)
+	defer cancel()
+	return checker.handler.controllerClient.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: volumeID})
+}
+
+// checkListGetAgreement checks that ListVolumes and ControllerGetVolume report the same condition
+// for a volume, because the monitor uses either of them depending on the capabilities. Messages
+// may legitimately change between the calls, so differences of only the message are noted.
+func (checker *ConformanceChecker) checkListGetAgreement() ConformanceCheck {
+	const name = "ListVolumesControllerGetVolumeAgreement"
+	if !checker.supportsListVolumes() || !checker.supportsGetVolume() || !checker.options.Capabilities.VolumeCondition {
+		return skippedCheck(name, "LIST_VOLUMES, GET_VOLUME and VOLUME_CONDITION are not all supported")
+	}
+	check := ConformanceCheck{Name: name, Result: ConformancePass}
+
+	compared := 0
+	for _, entry := range checker.listed {
+		volumeID := entry.GetVolume().GetVolumeId()
+		rsp, ok := checker.fetched[volumeID]
+		if !ok {
+			continue
+		}
+		listed := entry.GetStatus().GetVolumeCondition()
+		fetched := rsp.GetStatus().GetVolumeCondition()
+		if listed == nil || fetched == nil {
+			continue
+		}
+		compared++
+		if listed.GetAbnormal() != fetched.GetAbnormal() {
+			check.failf("volume %s: ListVolumes reports abnormal=%t %q, ControllerGetVolume reports abnormal=%t %q",
+				volumeID, listed.GetAbnormal(), listed.GetMessage(), fetched.GetAbnormal(), fetched.GetMessage())
+		} else if listed.GetMessage() != fetched.GetMessage() {
+			check.notef("volume %s: ListVolumes reports message %q, ControllerGetVolume reports message %q",
+				volumeID, listed.GetMessage(), fetched.GetMessage())
+		}
+	}
+	if compared == 0 {
+		return skippedCheck(name, "no volume conditions were returned by both ListVolumes and ControllerGetVolume")
+	}
+	return check
+}
+
+// checkGetVolumeNotFound checks that ControllerGetVolume of a volume which does not exist returns
+// NOT_FOUND, which the monitor relies on to report volumes missing on the backend
+func (checker *ConformanceChecker) checkGetVolumeNotFound(ctx context.Context) ConformanceCheck {
+	const name = "ControllerGetVolumeNotFound"
+	if !checker.supportsGetVolume() {
+		return skippedCheck(name, "GET_VOLUME is not supported")
+	}
+	check := ConformanceCheck{Name: name, Result: ConformancePass}
+
+	volumeID := fmt.Sprintf("external-health-monitor-conformance-%d", time.Now().UnixNano())
+	_, err := checker.getVolume(ctx, volumeID)
+	switch {
+	case err == nil:
+		check.failf("ControllerGetVolume of non-existent volume %s succeeded", volumeID)
+	case status.Code(err) != codes.NotFound:
+		check.failf("ControllerGetVolume of non-existent volume %s returned %s instead of NOT_FOUND", volumeID, status.Code(err))
+	}
+	return check
+}
+
+// checkMessages checks that all reported conditions have messages which can be shown in events
+func (checker *ConformanceChecker) checkMessages() ConformanceCheck {
+	const name = "VolumeConditionMessages"
+	if len(checker.conditions) == 0 {
+		return skippedCheck(name, "no volume conditions were returned")
+	}
+	check := ConformanceCheck{Name: name, Result: ConformancePass}
+
+	for _, observed := range checker.conditions {
+		message := observed.condition.GetMessage()
+		switch {
+		case observed.condition.GetAbnormal() && strings.TrimSpace(message) == "":
+			check.failf("%s reports volume %s abnormal without a message", observed.source, observed.volumeID)
+		case !utf8.ValidString(message):
+			check.failf("%s reports a message for volume %s which is not valid UTF-8", observed.source, observed.volumeID)
+		case len(message) > maxConditionMessageLength:
+			check.failf("%s reports a message of %d bytes for volume %s, events are limited to %d", observed.source, len(message), observed.volumeID, maxConditionMessageLength)
+		}
+	}
+	return check
+}
@@ -0,0 +1,192 @@
+package csi_handler
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-csi/csi-test/v5/driver"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2/ktesting"
+)
+
+var allCapabilities = Capabilities{ControllerService: true, ListVolumes: true, GetVolume: true, VolumeCondition: true}
+
+// fakeDriver serves ListVolumes and ControllerGetVolume from a list of volumes, the token is the index of the next volume
+type fakeDriver struct {
+	volumes []*csi.ListVolumesResponse_Entry
+	// ignoreMaxEntries returns all volumes in one page
+	ignoreMaxEntries bool
+	// getConditions override the conditions returned by ControllerGetVolume
+	getConditions map[string]*csi.VolumeCondition
+	// notFoundCode is returned by ControllerGetVolume for unknown volumes
+	notFoundCode codes.Code
+}
+
+func (d *fakeDriver) expect(server *driver.MockControllerServer) {
+	server.EXPECT().ListVolumes(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+			start := 0
+			if req.StartingToken != "" {
+				var err error
+				if start, err = strconv.Atoi(req.StartingToken); err != nil {
+					if d.ignoreMaxEntries {
+						return &csi.ListVolumesResponse{}, nil
+					}
+					return nil, status.Error(codes.Aborted, "invalid starting token")
+				}
+			}
+			end := len(d.volumes)
+			if req.MaxEntries > 0 && !d.ignoreMaxEntries {
+				end = min(start+int(req.MaxEntries), end)
+			}
+			rsp := &csi.ListVolumesResponse{Entries: d.volumes[start:end]}
+			if end < len(d.volumes) {
+				rsp.NextToken = strconv.Itoa(end)
+			}
+			return rsp, nil
+		}).AnyTimes()
+	server.EXPECT().ControllerGetVolume(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req *csi.ControllerGetVolumeRequest) (*csi.ControllerGetVolumeResponse, error) {
+			for _, entry := range d.volumes {
+				if entry.Volume.VolumeId != req.VolumeId {
+					continue
+				}
+				condition := entry.GetStatus().GetVolumeCondition()
+				if override, ok := d.getConditions[req.VolumeId]; ok {
+					condition = override
+				}
+				return &csi.ControllerGetVolumeResponse{
+					Volume: entry.Volume,
+					Status: &csi.ControllerGetVolumeResponse_VolumeStatus{VolumeCondition: condition},
+				}, nil
+			}
+			return nil, status.Error(d.notFoundCode, "volume not found")
+		}).AnyTimes()
+}
+
+func listEntry(volumeID string, condition *csi.VolumeCondition) *csi.ListVolumesResponse_Entry {
+	return &csi.ListVolumesResponse_Entry{
+		Volume: &csi.Volume{VolumeId: volumeID},
+		Status: &csi.ListVolumesResponse_VolumeStatus{VolumeCondition: condition},
+	}
+}
+
+func runConformance(t *testing.T, d *fakeDriver, options ConformanceOptions) (*ConformanceReport, map[string]ConformanceCheck) {
+	_, ctx := ktesting.NewTestContext(t)
+	_, _, _, controllerServer, _, csiConn, err := mock.CreateMockServer(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.expect(controllerServer)
+
+	options.Timeout = time.Second
+	report := NewConformanceChecker(csiConn, options).Run(ctx, mock.DriverName)
+	checks := map[string]ConformanceCheck{}
+	for _, check := range report.Checks {
+		checks[check.Name] = check
+	}
+	return report, checks
+}
+
+func TestConformanceChecker_Conforming(t *testing.T) {
+	assert := assert.New(t)
+	d := &fakeDriver{
+		volumes: []*csi.ListVolumesResponse_Entry{
+			listEntry("1", abnormalVolumeCondition),
+			listEntry("2", normalVolumeCondition),
+			listEntry("3", normalVolumeCondition),
+		},
+		// only the message differs, which is not a violation
+		getConditions: map[string]*csi.VolumeCondition{"3": {Abnormal: false, Message: "volume is healthy"}},
+		notFoundCode:  codes.NotFound,
+	}
+
+	report, checks := runConformance(t, d, ConformanceOptions{Capabilities: allCapabilities, PageSize: 2})
+	assert.True(report.Passed())
+	assert.Len(report.Checks, 6)
+	for _, check := range report.Checks {
+		assert.Equal(ConformancePass, check.Result, check.Name)
+	}
+	assert.Equal([]string{`volume 3: ListVolumes reports message "", ControllerGetVolume reports message "volume is healthy"`},
+		checks["ListVolumesControllerGetVolumeAgreement"].Details)
+
+	var table bytes.Buffer
+	assert.Nil(report.WriteTable(&table))
+	assert.Contains(table.String(), "ListVolumesPagination")
+}
+
+func TestConformanceChecker_Violations(t *testing.T) {
+	assert := assert.New(t)
+	missingStatus := &csi.ListVolumesResponse_Entry{Volume: &csi.Volume{VolumeId: "3"}}
+	d := &fakeDriver{
+		volumes: []*csi.ListVolumesResponse_Entry{
+			listEntry("1", &csi.VolumeCondition{Abnormal: true}),
+			listEntry("2", normalVolumeCondition),
+			missingStatus,
+		},
+		ignoreMaxEntries: true,
+		getConditions:    map[string]*csi.VolumeCondition{"2": abnormalVolumeCondition},
+		notFoundCode:     codes.Internal,
+	}
+
+	report, checks := runConformance(t, d, ConformanceOptions{Capabilities: allCapabilities, PageSize: 1})
+	assert.False(report.Passed())
+	assert.Equal(ConformanceFail, checks["ListVolumesPagination"].Result)
+	assert.Contains(checks["ListVolumesPagination"].Details, "page 1 has 3 entries, more than max_entries 1")
+	assert.Contains(checks["ListVolumesPagination"].Details, "ListVolumes with an invalid starting_token returned OK instead of ABORTED")
+
+	assert.Equal(ConformanceFail, checks["ListVolumesStatus"].Result)
+	assert.Equal([]string{"volume 3 has no status"}, checks["ListVolumesStatus"].Details)
+
+	assert.Equal(ConformanceFail, checks["ControllerGetVolumeStatus"].Result)
+	assert.Equal([]string{"volume 3 has no volume_condition"}, checks["ControllerGetVolumeStatus"].Details)
+
+	assert.Equal(ConformanceFail, checks["ListVolumesControllerGetVolumeAgreement"].Result)
+	assert.Len(checks["ListVolumesControllerGetVolumeAgreement"].Details, 1)
+	assert.Contains(checks["ListVolumesControllerGetVolumeAgreement"].Details[0], "volume 2")
+
+	assert.Equal(ConformanceFail, checks["ControllerGetVolumeNotFound"].Result)
+	assert.Contains(checks["ControllerGetVolumeNotFound"].Details[0], "returned Internal instead of NOT_FOUND")
+
+	assert.Equal(ConformanceFail, checks["VolumeConditionMessages"].Result)
+	assert.Equal([]string{
+		"ListVolumes reports volume 1 abnormal without a message",
+		"ControllerGetVolume reports volume 1 abnormal without a message",
+	}, checks["VolumeConditionMessages"].Details)
+}
+
+func TestConformanceChecker_Capabilities(t *testing.T) {
+	assert := assert.New(t)
+	d := &fakeDriver{volumes: []*csi.ListVolumesResponse_Entry{listEntry("1", normalVolumeCondition)}, notFoundCode: codes.NotFound}
+
+	// without ListVolumes, only the given volumes are fetched
+	_, checks := runConformance(t, d, ConformanceOptions{
+		Capabilities: Capabilities{ControllerService: true, GetVolume: true, VolumeCondition: true},
+		VolumeIDs:    []string{"1"},
+	})
+	assert.Equal(ConformanceSkip, checks["ListVolumesPagination"].Result)
+	assert.Equal(ConformanceSkip, checks["ListVolumesStatus"].Result)
+	assert.Equal(ConformancePass, checks["ControllerGetVolumeStatus"].Result)
+	assert.Equal(ConformanceSkip, checks["ListVolumesControllerGetVolumeAgreement"].Result)
+	assert.Equal(ConformancePass, checks["ControllerGetVolumeNotFound"].Result)
+	assert.Equal(ConformancePass, checks["VolumeConditionMessages"].Result)
+
+	// without VOLUME_CONDITION, only the pagination and NotFound semantics are checked
+	_, checks = runConformance(t, d, ConformanceOptions{
+		Capabilities: Capabilities{ControllerService: true, ListVolumes: true, GetVolume: true},
+	})
+	assert.Equal(ConformancePass, checks["ListVolumesPagination"].Result)
+	assert.Equal([]string{"pagination was not exercised, 1 volumes fit into one page of max_entries 1"}, checks["ListVolumesPagination"].Details)
+	assert.Equal(ConformanceSkip, checks["ListVolumesStatus"].Result)
+	assert.Equal(ConformanceSkip, checks["ControllerGetVolumeStatus"].Result)
+	assert.Equal(ConformancePass, checks["ControllerGetVolumeNotFound"].Result)
+	assert.Equal(ConformanceSkip, checks["VolumeConditionMessages"].Result)
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kubernetes-csi/csi-lib-utils/rpc"
+	"google.golang.org/grpc"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+)
+
+const (
+	// DriverUnavailableReason is the reason used when the CSI driver fails its probes
+	DriverUnavailableReason = "DriverUnavailable"
+	// DriverAvailableReason is the reason used when the CSI driver passes its probes again
+	DriverAvailableReason = "DriverAvailable"
+)
+
+var (
+	errConnectionLost = errors.New("connection to the CSI driver was lost")
+	errDriverNotReady = errors.New("CSI driver is not ready")
+)
+
+// DriverHealthMonitor probes the CSI driver periodically and tracks whether it is healthy.
+// Abnormal volume conditions are not reported while the driver is unhealthy, because a broken
+// driver tends to report all its volumes abnormal.
+type DriverHealthMonitor struct {
+	driverName string
+	timeout    time.Duration
+	interval   time.Duration
+	// the driver is unhealthy after failureThreshold consecutive failed probes
+	failureThreshold int
+
+	eventRecorder record.EventRecorder
+	// eventObject is the object DriverUnavailable events are sent to, e.g. the Pod of the monitor, it can be nil
+	eventObject     runtime.Object
+	metricsRecorder *metrics.Recorder
+
+	probe func(ctx context.Context) (bool, error)
+
+	// used for updating the fields below
+	sync.RWMutex
+	consecutiveFailures int
+	healthy             bool
+	lastError           error
+}
+
+// NewDriverHealthMonitor creates a DriverHealthMonitor, the driver is healthy until it fails its probes
+func NewDriverHealthMonitor(
+	driverName string,
+	conn *grpc.ClientConn,
+	timeout time.Duration,
+	interval time.Duration,
+	failureThreshold int,
+	recorder record.EventRecorder,
+	eventObject runtime.Object,
+	metricsRecorder *metrics.Recorder,
+) *DriverHealthMonitor {
+	monitor := &DriverHealthMonitor{
+		driverName:       driverName,
+		timeout:          timeout,
+		interval:         interval,
+		failureThreshold: max(failureThreshold, 1),
+		eventRecorder:    recorder,
+		eventObject:      eventObject,
+		metricsRecorder:  metricsRecorder,
+		probe: func(ctx context.Context) (bool, error) {
+			return rpc.Probe(ctx, conn)
+		},
+		healthy: true,
+	}
+	metricsRecorder.SetDriverHealth(true, 0)
+	return monitor
+}
+
+// Run probes the driver periodically until ctx is done
+func (monitor *DriverHealthMonitor) Run(ctx context.Context) {
+	wait.UntilWithContext(ctx, monitor.probeDriver, monitor.interval)
+}
+
+func (monitor *DriverHealthMonitor) probeDriver(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, monitor.timeout)
+	defer cancel()
+
+	ready, err := monitor.probe(ctx)
+	if err == nil && !ready {
+		err = errDriverNotReady
+	}
+	monitor.recordProbe(klog.FromContext(ctx), err)
+}
+
+// ConnectionLost marks the driver unhealthy at once, it is called when the connection to the driver is lost
+func (monitor *DriverHealthMonitor) ConnectionLost(ctx context.Context) {
+	if monitor == nil {
+		return
+	}
+	monitor.Lock()
+	monitor.consecutiveFailures = max(monitor.consecutiveFailures, monitor.failureThreshold-1)
+	monitor.Unlock()
+	monitor.recordProbe(klog.FromContext(ctx), errConnectionLost)
+}
+
+// recordProbe records the result of a probe and sends an event if the health of the driver changed
+func (monitor *DriverHealthMonitor) recordProbe(logger klog.Logger, err error) {
+	monitor.Lock()
+	wasHealthy := monitor.healthy
+	if err != nil {
+		monitor.consecutiveFailures++
+		monitor.lastError = err
+		if monitor.consecutiveFailures >= monitor.failureThreshold {
+			monitor.healthy = false
+		}
+	} else {
+		monitor.consecutiveFailures = 0
+		monitor.lastError = nil
+		monitor.healthy = true
+	}
+	healthy, failures := monitor.healthy, monitor.consecutiveFailures
+	monitor.Unlock()
+
+	monitor.metricsRecorder.SetDriverHealth(healthy, failures)
+	if err != nil {
+		logger.V(4).Info("CSI driver probe failed", "driver", monitor.driverName, "consecutiveFailures", failures, "err", err)
+	}
+
+	switch {
+	case wasHealthy && !healthy:
+		logger.Error(err, "CSI driver is unavailable, abnormal volume conditions are not reported until it recovers", "driver", monitor.driverName, "consecutiveFailures", failures)
+		monitor.sendEvent(v1.EventTypeWarning, DriverUnavailableReason,
+			fmt.Sprintf("CSI driver %s is unavailable after %d failed probes: %v", monitor.driverName, failures, err))
+	case !wasHealthy && healthy:
+		logger.Info("CSI driver is available again", "driver", monitor.driverName)
+		monitor.sendEvent(v1.EventTypeNormal, DriverAvailableReason, fmt.Sprintf("CSI driver %s is available again", monitor.driverName))
+	}
+}
+
+func (monitor *DriverHealthMonitor) sendEvent(eventType, reason, message string) {
+	if monitor.eventObject == nil || monitor.eventRecorder == nil {
+		return
+	}
+	monitor.eventRecorder.Event(monitor.eventObject, eventType, reason, message)
+}
+
+// IsHealthy returns false if the driver failed its recent probes, a nil monitor is always healthy
+func (monitor *DriverHealthMonitor) IsHealthy() bool {
+	if monitor == nil {
+		return true
+	}
+	monitor.RLock()
+	defer monitor.RUnlock()
+
+	return monitor.healthy
+}
+
+// Check returns an error if the driver is unhealthy, it is used by the /healthz/driver endpoint
+func (monitor *DriverHealthMonitor) Check(_ *http.Request) error {
+	monitor.RLock()
+	defer monitor.RUnlock()
+
+	if !monitor.healthy {
+		return fmt.Errorf("CSI driver %s failed %d consecutive probes: %v", monitor.driverName, monitor.consecutiveFailures, monitor.lastError)
+	}
+	return nil
+}
+
+// ServeHTTP serves the /healthz/driver endpoint, it fails while the driver is unhealthy
+func (monitor *DriverHealthMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := monitor.Check(r); err != nil {
+		http.Error(w, fmt.Sprintf("internal server error: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprint(w, "ok")
+}
@@ -0,0 +1,87 @@
+package csi_handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDriverHealthMonitor(eventStore chan string) *DriverHealthMonitor {
+	pod := &v1.ObjectReference{Kind: "Pod", APIVersion: "v1", Name: "monitor", Namespace: mock.DefaultNS}
+	return NewDriverHealthMonitor(mock.DriverName, nil, time.Second, time.Second, 2, &record.FakeRecorder{Events: eventStore}, pod, nil)
+}
+
+func TestDriverHealthMonitor_Probe(t *testing.T) {
+	assert := assert.New(t)
+	eventStore := make(chan string, 10)
+	monitor := newTestDriverHealthMonitor(eventStore)
+
+	probeErr := errors.New("connection refused")
+	probes := []struct {
+		ready       bool
+		err         error
+		wantHealthy bool
+		wantEvent   string
+	}{
+		{ready: true, wantHealthy: true},
+		// the driver is healthy until it fails failureThreshold probes in a row
+		{err: probeErr, wantHealthy: true},
+		{ready: true, wantHealthy: true},
+		{err: probeErr, wantHealthy: true},
+		{ready: false, wantHealthy: false, wantEvent: "Warning DriverUnavailable CSI driver " + mock.DriverName + " is unavailable after 2 failed probes: CSI driver is not ready"},
+		{err: probeErr, wantHealthy: false},
+		{ready: true, wantHealthy: true, wantEvent: "Normal DriverAvailable CSI driver " + mock.DriverName + " is available again"},
+	}
+	_, ctx := ktesting.NewTestContext(t)
+	for i, p := range probes {
+		monitor.probe = func(_ context.Context) (bool, error) {
+			return p.ready, p.err
+		}
+		monitor.probeDriver(ctx)
+		assert.Equal(p.wantHealthy, monitor.IsHealthy(), "probe %d", i)
+
+		select {
+		case event := <-eventStore:
+			assert.Equal(p.wantEvent, event, "probe %d", i)
+		default:
+			assert.Empty(p.wantEvent, "probe %d: no event sent", i)
+		}
+	}
+}
+
+func TestDriverHealthMonitor_ConnectionLost(t *testing.T) {
+	assert := assert.New(t)
+	eventStore := make(chan string, 10)
+	monitor := newTestDriverHealthMonitor(eventStore)
+
+	_, ctx := ktesting.NewTestContext(t)
+	monitor.ConnectionLost(ctx)
+	assert.False(monitor.IsHealthy())
+	assert.Equal("Warning DriverUnavailable CSI driver "+mock.DriverName+" is unavailable after 2 failed probes: connection to the CSI driver was lost", <-eventStore)
+
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz/driver", nil))
+	assert.Equal(http.StatusInternalServerError, recorder.Code)
+
+	monitor.recordProbe(klog.FromContext(ctx), nil)
+	recorder = httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz/driver", nil))
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Equal("ok", recorder.Body.String())
+
+	// a nil monitor never suppresses events
+	var disabled *DriverHealthMonitor
+	disabled.ConnectionLost(ctx)
+	assert.True(disabled.IsHealthy())
+}
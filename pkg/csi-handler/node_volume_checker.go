@@ -0,0 +1,349 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+)
+
+const (
+	// VolumeNearlyFullReason is the reason used when the bytes or inodes usage of a volume reaches its thresholds
+	VolumeNearlyFullReason = "VolumeNearlyFull"
+
+	// driverPVCacheSize is the maximum number of cached PVCs of the Pods on the node
+	driverPVCacheSize = 1024
+	// driverPVCacheTTL is the time the PVCs of the Pods on the node and their PVs are cached for
+	driverPVCacheTTL = 10 * time.Minute
+)
+
+// nodeVolumeUsage is the last known usage of a volume on the node
+type nodeVolumeUsage struct {
+	level        UsageLevel
+	pvcNamespace string
+	pvcName      string
+	storageClass string
+}
+
+// NodeVolumeHealthChecker checks the health condition of the volumes published on one node
+// by NodeGetVolumeStats and reports abnormal volumes as Pod events
+type NodeVolumeHealthChecker struct {
+	driverName     string
+	nodeName       string
+	kubeletRootDir string
+	// stageUnstageVolume is set when the driver stages volumes, the staging path of
+	// filesystem volumes is passed to NodeGetVolumeStats then
+	stageUnstageVolume bool
+
+	timeout       time.Duration
+	eventRecorder record.EventRecorder
+
+	podLister corelisters.PodLister
+	// client gets the PVCs and PVs of the Pods on the node, they are not watched because every
+	// node would receive all PVCs and PVs of the cluster then
+	client kubernetes.Interface
+	// driverPVs caches the bound PVCs of the Pods on the node and their PVs by namespace + "/" + PVC
+	// name for driverPVCacheTTL, the binding does not change while the PVC exists
+	driverPVs *utilcache.LRUExpireCache
+
+	csiPVHandler CSIHandler
+
+	// healthStore tracks the health state of the volumes of Pods, keyed by Pod UID + "/" + PV name
+	healthStore *VolumeHealthStore
+
+	// usageThresholds are the thresholds of VolumeNearlyFull events, usage is only recorded in metrics if it is nil
+	usageThresholds *UsageThresholds
+	// usages stores the last known usage of volumes by PV name, it is only used by CheckNodeVolumes
+	usages map[string]*nodeVolumeUsage
+
+	metricsRecorder *metrics.Recorder
+
+	// classifier maps driver messages to structured reasons, it can be nil
+	classifier Classifier
+
+	// abnormal volume conditions are not reported while driverHealth reports the driver unhealthy, it can be nil
+	driverHealth *DriverHealthMonitor
+}
+
+// NewNodeVolumeHealthChecker returns an instance of NodeVolumeHealthChecker
+func NewNodeVolumeHealthChecker(
+	driverName string,
+	nodeName string,
+	kubeletRootDir string,
+	stageUnstageVolume bool,
+	conn *grpc.ClientConn,
+	timeout time.Duration,
+	podLister corelisters.PodLister,
+	client kubernetes.Interface,
+	recorder record.EventRecorder,
+	usageThresholds *UsageThresholds,
+	metricsRecorder *metrics.Recorder,
+	classifier Classifier,
+	driverHealth *DriverHealthMonitor,
+) *NodeVolumeHealthChecker {
+	return &NodeVolumeHealthChecker{
+		driverName:         driverName,
+		nodeName:           nodeName,
+		kubeletRootDir:     kubeletRootDir,
+		stageUnstageVolume: stageUnstageVolume,
+		timeout:            timeout,
+		eventRecorder:      recorder,
+		podLister:          podLister,
+		client:             client,
+		driverPVs:          utilcache.NewLRUExpireCache(driverPVCacheSize),
+		csiPVHandler:       NewCSIPVHandler(conn),
+		healthStore:        NewVolumeHealthStore(),
+		usageThresholds:    usageThresholds,
+		usages:             make(map[string]*nodeVolumeUsage),
+		metricsRecorder:    metricsRecorder,
+		classifier:         classifier,
+		driverHealth:       driverHealth,
+	}
+}
+
+// driverPV is the PVC used by Pods of the node and the PV bound to it, which is nil if it is not a volume of the driver
+type driverPV struct {
+	pvc *v1.PersistentVolumeClaim
+	pv  *v1.PersistentVolume
+	err error
+}
+
+// podVolume is a volume in the spec of a Pod
+type podVolume struct {
+	pod        *v1.Pod
+	volumeName string
+}
+
+// CheckNodeVolumes checks the volumes of the driver used by the running Pods on the node
+func (checker *NodeVolumeHealthChecker) CheckNodeVolumes(ctx context.Context) error {
+	pods, err := checker.podLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	logger := klog.FromContext(ctx)
+	checked := make(map[string]bool)
+	// the usage of a volume is the same for all Pods using it, it is evaluated once per volume
+	usages := make(map[string][]*csi.VolumeUsage)
+	podVolumes := make(map[string][]podVolume)
+	pvcs := make(map[string]*v1.PersistentVolumeClaim)
+	pvs := make(map[string]*v1.PersistentVolume)
+	// the PVCs and PVs are got once per check, keyed by namespace + "/" + PVC name
+	driverPVs := make(map[string]driverPV)
+	for _, pod := range pods {
+		// volumes are only published while the Pod is running
+		if pod.Spec.NodeName != checker.nodeName || pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		for i := range pod.Spec.Volumes {
+			volume := &pod.Spec.Volumes[i]
+			pvcName := util.GetPodVolumePVCName(pod, volume)
+			if pvcName == "" {
+				continue
+			}
+			pvcKey := pod.Namespace + "/" + pvcName
+			lookup, ok := driverPVs[pvcKey]
+			if !ok {
+				lookup.pvc, lookup.pv, lookup.err = checker.getDriverPV(ctx, pod.Namespace, pvcName)
+				driverPVs[pvcKey] = lookup
+			}
+			pvc, pv, err := lookup.pvc, lookup.pv, lookup.err
+			if err != nil {
+				logger.V(4).Info("Skipping volume of Pod", "pod", klog.KObj(pod), "volume", volume.Name, "err", err)
+				continue
+			}
+			if pv == nil {
+				continue
+			}
+
+			key := string(pod.UID) + "/" + pv.Name
+			checked[key] = true
+			podVolumes[pv.Name] = append(podVolumes[pv.Name], podVolume{pod: pod, volumeName: volume.Name})
+			pvcs[pv.Name] = pvc
+			pvs[pv.Name] = pv
+			volumeCondition, err := checker.checkPodVolume(ctx, logger, pod, volume.Name, pvcName, pv, key)
+			if err != nil {
+				logger.Error(err, "Failed to check volume of Pod", "pod", klog.KObj(pod), "volume", volume.Name, "pv", pv.Name)
+				continue
+			}
+			if len(volumeCondition.GetUsage()) > 0 {
+				usages[pv.Name] = volumeCondition.GetUsage()
+			}
+		}
+	}
+
+	for pvName, usage := range usages {
+		checker.checkVolumeUsage(logger, pvs[pvName], pvcs[pvName], podVolumes[pvName], usage)
+	}
+
+	// forget the volumes of Pods which stopped running or left the node
+	for _, record := range checker.healthStore.List() {
+		if !checked[record.VolumeHandle] {
+			checker.healthStore.Delete(record.VolumeHandle)
+		}
+	}
+	for pvName, usage := range checker.usages {
+		if pvs[pvName] == nil {
+			checker.forgetVolumeUsage(pvName, usage)
+		}
+	}
+
+	return nil
+}
+
+// getDriverPV returns the PVC and the PV bound to it, or a nil PV if it is not a volume of the driver.
+// Bound PVCs are cached, so they are only got from the API server every driverPVCacheTTL.
+func (checker *NodeVolumeHealthChecker) getDriverPV(ctx context.Context, namespace, pvcName string) (*v1.PersistentVolumeClaim, *v1.PersistentVolume, error) {
+	key := namespace + "/" + pvcName
+	if cached, ok := checker.driverPVs.Get(key); ok {
+		lookup := cached.(driverPV)
+		return lookup.pvc, lookup.pv, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checker.timeout)
+	defer cancel()
+	pvc, err := checker.client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if pvc.Status.Phase != v1.ClaimBound || pvc.Spec.VolumeName == "" {
+		// unbound PVCs are not cached, they are expected to be bound soon
+		return pvc, nil, nil
+	}
+	pv, err := checker.client.CoreV1().PersistentVolumes().Get(ctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != checker.driverName {
+		pv = nil
+	}
+	checker.driverPVs.Add(key, driverPV{pvc: pvc, pv: pv}, driverPVCacheTTL)
+	return pvc, pv, nil
+}
+
+// checkPodVolume calls NodeGetVolumeStats for the volume path of the Pod and sends Pod events
+// on state transitions
+func (checker *NodeVolumeHealthChecker) checkPodVolume(ctx context.Context, logger klog.Logger, pod *v1.Pod, volumeName, pvcName string, pv *v1.PersistentVolume, key string) (*VolumeConditionResult, error) {
+	isBlock := pv.Spec.VolumeMode != nil && *pv.Spec.VolumeMode == v1.PersistentVolumeBlock
+	volumePath := util.GetVolumePath(checker.kubeletRootDir, pv.Name, string(pod.UID), isBlock)
+	stagingPath := ""
+	if checker.stageUnstageVolume && !isBlock {
+		var err error
+		stagingPath, err = util.MakeDeviceMountPath(checker.kubeletRootDir, pv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checker.timeout)
+	defer cancel()
+	volumeCondition, err := checker.csiPVHandler.NodeGetVolumeCondition(ctx, pv.Spec.CSI.VolumeHandle, volumePath, stagingPath)
+	if err != nil {
+		return nil, err
+	}
+
+	classifyVolumeCondition(checker.classifier, volumeCondition)
+	if volumeCondition.GetAbnormal() && !checker.driverHealth.IsHealthy() {
+		logger.V(4).Info("CSI driver is unavailable, ignoring abnormal volume condition", "pod", klog.KObj(pod), "pv", pv.Name, "message", volumeCondition.GetMessage())
+		return volumeCondition, nil
+	}
+	transition := checker.healthStore.Record(key, pv.Name, pod.Namespace, pvcName, volumeCondition)
+	if transition.Changed() {
+		logger.V(4).Info("Volume health state on node changed", "pod", klog.KObj(pod), "pv", pv.Name, "from", transition.Previous, "to", transition.Current)
+	}
+
+	switch transition.Current {
+	case VolumeHealthAbnormal:
+		if transition.Changed() {
+			checker.eventRecorder.Event(pod, v1.EventTypeWarning, abnormalReason(volumeCondition), fmt.Sprintf("Volume %s: %s", volumeName, volumeCondition.GetMessage()))
+		} else if transition.MessageChanged {
+			checker.eventRecorder.Event(pod, v1.EventTypeWarning, VolumeConditionChangedReason, fmt.Sprintf("Volume %s: %s", volumeName, volumeCondition.GetMessage()))
+		}
+	case VolumeHealthRecovered:
+		checker.eventRecorder.Event(pod, v1.EventTypeNormal, VolumeConditionNormalReason, fmt.Sprintf("Volume %s: %s", volumeName, util.DefaultRecoveryEventMessage))
+	}
+
+	return volumeCondition, nil
+}
+
+// checkVolumeUsage records the usage of the volume in metrics and sends VolumeNearlyFull events
+// to its PVC and Pods when the usage reaches a higher threshold
+func (checker *NodeVolumeHealthChecker) checkVolumeUsage(logger klog.Logger, pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim, podVolumes []podVolume, usage []*csi.VolumeUsage) {
+	var threshold UsageThreshold
+	if checker.usageThresholds != nil {
+		threshold = checker.usageThresholds.ForStorageClass(pv.Spec.StorageClassName)
+	}
+
+	level := UsageLevelNormal
+	message := ""
+	for _, u := range usage {
+		if u.GetTotal() <= 0 || u.GetUnit() == csi.VolumeUsage_UNKNOWN {
+			continue
+		}
+		unit := strings.ToLower(u.GetUnit().String())
+		ratio := float64(u.GetUsed()) / float64(u.GetTotal())
+		checker.metricsRecorder.SetVolumeUsage(pvc.Namespace, pvc.Name, pv.Name, pv.Spec.StorageClassName, unit, ratio)
+
+		unitLevel, reached := threshold.Level(ratio * 100)
+		if unitLevel.severity() > level.severity() {
+			level = unitLevel
+			message = fmt.Sprintf("Volume %s is %.0f%% full (%s), above the %s threshold of %v%%", pv.Name, ratio*100, unit, unitLevel, reached)
+		}
+	}
+
+	previous, ok := checker.usages[pv.Name]
+	if !ok {
+		previous = &nodeVolumeUsage{}
+		checker.usages[pv.Name] = previous
+	}
+	previousLevel := previous.level
+	*previous = nodeVolumeUsage{level: level, pvcNamespace: pvc.Namespace, pvcName: pvc.Name, storageClass: pv.Spec.StorageClassName}
+	if level.severity() <= previousLevel.severity() {
+		return
+	}
+
+	logger.Info("Volume is nearly full", "pv", pv.Name, "pvc", klog.KObj(pvc), "level", level)
+	checker.eventRecorder.Event(pvc, v1.EventTypeWarning, VolumeNearlyFullReason, message)
+	for _, podVolume := range podVolumes {
+		checker.eventRecorder.Event(podVolume.pod, v1.EventTypeWarning, VolumeNearlyFullReason, fmt.Sprintf("Volume %s: %s", podVolume.volumeName, message))
+	}
+}
+
+// forgetVolumeUsage drops the usage of a volume which is not used on the node anymore
+func (checker *NodeVolumeHealthChecker) forgetVolumeUsage(pvName string, usage *nodeVolumeUsage) {
+	for _, unit := range []csi.VolumeUsage_Unit{csi.VolumeUsage_BYTES, csi.VolumeUsage_INODES} {
+		checker.metricsRecorder.DeleteVolumeUsage(usage.pvcNamespace, usage.pvcName, pvName, usage.storageClass, strings.ToLower(unit.String()))
+	}
+	delete(checker.usages, pvName)
+}
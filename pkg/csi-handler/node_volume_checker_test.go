@@ -0,0 +1,157 @@
+package csi_handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/ktesting"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/mock/gomock"
+	"github.com/kubernetes-csi/csi-test/v5/driver"
+	"github.com/kubernetes-csi/csi-test/v5/utils"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// newNodeVolumeTestChecker creates a checker of node1 with a running Pod using the filesystem volume "volume1",
+// it returns the NodeGetVolumeStats request expected for it
+func newNodeVolumeTestChecker(t *testing.T, usageThresholds *UsageThresholds) (*NodeVolumeHealthChecker, *driver.MockNodeServer, *v1.Pod, chan string, *csi.NodeGetVolumeStatsRequest) {
+	assert := assert.New(t)
+	client, informer := mock.FakeK8s()
+	_, _, _, _, nodeServer, csiConn, err := mock.CreateMockServer(t)
+	assert.Nil(err)
+
+	filesystem := v1.PersistentVolumeFilesystem
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "volume1", "pvcuid", &filesystem, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+	pod := mock.CreatePod("pod", mock.DefaultNS, "data", "pvc", "node1", "poduid", false)
+	pod.Status.Phase = v1.PodRunning
+	// Pods of other nodes are not checked
+	otherPod := mock.CreatePod("other", mock.DefaultNS, "data", "pvc", "node2", "otheruid", false)
+	otherPod.Status.Phase = v1.PodRunning
+	_, err = client.CoreV1().PersistentVolumes().Create(context.Background(), pv, metav1.CreateOptions{})
+	assert.Nil(err)
+	_, err = client.CoreV1().PersistentVolumeClaims(mock.DefaultNS).Create(context.Background(), pvc, metav1.CreateOptions{})
+	assert.Nil(err)
+	assert.Nil(informer.Core().V1().Pods().Informer().GetStore().Add(pod))
+	assert.Nil(informer.Core().V1().Pods().Informer().GetStore().Add(otherPod))
+
+	eventStore := make(chan string, 10)
+	checker := NewNodeVolumeHealthChecker(mock.DriverName, "node1", "/var/lib/kubelet", true, csiConn, 15*time.Second,
+		informer.Core().V1().Pods().Lister(),
+		client,
+		&record.FakeRecorder{Events: eventStore}, usageThresholds, nil, nil, nil)
+
+	stagingPath, err := util.MakeDeviceMountPath("/var/lib/kubelet", pv)
+	assert.Nil(err)
+	in := &csi.NodeGetVolumeStatsRequest{
+		VolumeId:          "volume1",
+		VolumePath:        util.GetVolumePath("/var/lib/kubelet", "pv", "poduid", false),
+		StagingTargetPath: stagingPath,
+	}
+	return checker, nodeServer, pod, eventStore, in
+}
+
+func TestNodeVolumeHealthChecker_CheckNodeVolumes(t *testing.T) {
+	assert := assert.New(t)
+	checker, nodeServer, pod, eventStore, in := newNodeVolumeTestChecker(t, nil)
+
+	abnormal := &csi.NodeGetVolumeStatsResponse{VolumeCondition: &csi.VolumeCondition{Abnormal: true, Message: "mount point is gone"}}
+	normal := &csi.NodeGetVolumeStatsResponse{VolumeCondition: &csi.VolumeCondition{Abnormal: false, Message: "ok"}}
+	gomock.InOrder(
+		nodeServer.EXPECT().NodeGetVolumeStats(gomock.Any(), utils.Protobuf(in)).Return(abnormal, nil).Times(2),
+		nodeServer.EXPECT().NodeGetVolumeStats(gomock.Any(), utils.Protobuf(in)).Return(normal, nil).Times(1),
+	)
+
+	_, ctx := ktesting.NewTestContext(t)
+	wantEvents := [][]string{
+		{"Warning VolumeConditionAbnormal Volume data: mount point is gone"},
+		nil,
+		{"Normal VolumeConditionNormal Volume data: " + util.DefaultRecoveryEventMessage},
+	}
+	for i, want := range wantEvents {
+		assert.Nil(checker.CheckNodeVolumes(ctx))
+		var events []string
+		for len(eventStore) > 0 {
+			events = append(events, <-eventStore)
+		}
+		assert.Equal(want, events, "check %d", i)
+	}
+
+	// the PVC and PV are only got by the first check, later checks read them from the cache
+	gets := 0
+	for _, action := range checker.client.(*fake.Clientset).Actions() {
+		if action.GetVerb() == "get" {
+			gets++
+		}
+	}
+	assert.Equal(2, gets)
+
+	// the state of Pods which stopped running is dropped
+	pod.Status.Phase = v1.PodSucceeded
+	assert.Nil(checker.CheckNodeVolumes(ctx))
+	assert.Empty(checker.healthStore.List())
+}
+
+func TestNodeVolumeHealthChecker_CheckVolumeUsage(t *testing.T) {
+	assert := assert.New(t)
+	checker, nodeServer, pod, eventStore, in := newNodeVolumeTestChecker(t, &UsageThresholds{
+		Default: UsageThreshold{Warning: 85, Critical: 95},
+	})
+
+	usage := func(usedBytes, usedInodes int64) *csi.NodeGetVolumeStatsResponse {
+		return &csi.NodeGetVolumeStatsResponse{
+			Usage: []*csi.VolumeUsage{
+				{Unit: csi.VolumeUsage_BYTES, Total: 100, Used: usedBytes, Available: 100 - usedBytes},
+				{Unit: csi.VolumeUsage_INODES, Total: 100, Used: usedInodes, Available: 100 - usedInodes},
+			},
+			VolumeCondition: &csi.VolumeCondition{},
+		}
+	}
+	gomock.InOrder(
+		nodeServer.EXPECT().NodeGetVolumeStats(gomock.Any(), utils.Protobuf(in)).Return(usage(50, 90), nil),
+		nodeServer.EXPECT().NodeGetVolumeStats(gomock.Any(), utils.Protobuf(in)).Return(usage(90, 90), nil),
+		nodeServer.EXPECT().NodeGetVolumeStats(gomock.Any(), utils.Protobuf(in)).Return(usage(96, 90), nil),
+		nodeServer.EXPECT().NodeGetVolumeStats(gomock.Any(), utils.Protobuf(in)).Return(usage(50, 50), nil),
+		nodeServer.EXPECT().NodeGetVolumeStats(gomock.Any(), utils.Protobuf(in)).Return(usage(86, 50), nil),
+	)
+
+	_, ctx := ktesting.NewTestContext(t)
+	wantEvents := [][]string{
+		{
+			"Warning VolumeNearlyFull Volume pv is 90% full (inodes), above the warning threshold of 85%",
+			"Warning VolumeNearlyFull Volume data: Volume pv is 90% full (inodes), above the warning threshold of 85%",
+		},
+		// still at the warning level
+		nil,
+		{
+			"Warning VolumeNearlyFull Volume pv is 96% full (bytes), above the critical threshold of 95%",
+			"Warning VolumeNearlyFull Volume data: Volume pv is 96% full (bytes), above the critical threshold of 95%",
+		},
+		nil,
+		// the volume filled up again after it was cleaned up
+		{
+			"Warning VolumeNearlyFull Volume pv is 86% full (bytes), above the warning threshold of 85%",
+			"Warning VolumeNearlyFull Volume data: Volume pv is 86% full (bytes), above the warning threshold of 85%",
+		},
+	}
+	for i, want := range wantEvents {
+		assert.Nil(checker.CheckNodeVolumes(ctx))
+		var events []string
+		for len(eventStore) > 0 {
+			events = append(events, <-eventStore)
+		}
+		assert.Equal(want, events, "check %d", i)
+	}
+
+	pod.Status.Phase = v1.PodFailed
+	assert.Nil(checker.CheckNodeVolumes(ctx))
+	assert.Empty(checker.usages)
+}
@@ -19,19 +19,39 @@ package csi_handler
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	storagelisters "k8s.io/client-go/listers/storage/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 
+	healthv1alpha1 "github.com/kubernetes-csi/external-health-monitor/pkg/apis/volumehealth/v1alpha1"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/metrics"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/volumehealth"
+)
+
+const (
+	// VolumeConditionAbnormalReason is the reason used when the volume condition is abnormal
+	VolumeConditionAbnormalReason = "VolumeConditionAbnormal"
+	// VolumeConditionNormalReason is the reason used when the volume condition is normal
+	VolumeConditionNormalReason = "VolumeConditionNormal"
+	// VolumeConditionChangedReason is the reason used when an abnormal volume reports a different message
+	VolumeConditionChangedReason = "VolumeConditionChanged"
+	// VolumeNotFoundOnBackendReason is the reason used when a bound volume does not exist in the storage backend
+	VolumeNotFoundOnBackendReason = "VolumeNotFoundOnBackend"
 )
 
 // PVHealthConditionChecker is for checking pv health condition
@@ -49,6 +69,63 @@ type PVHealthConditionChecker struct {
 	eventInformer coreinformers.EventInformer
 
 	csiPVHandler CSIHandler
+
+	// healthStore tracks the health state of volumes so that events are only sent on transitions
+	healthStore *VolumeHealthStore
+
+	metricsRecorder *metrics.Recorder
+
+	// a bound volume is reported as not found on the backend after it was missing
+	// notFoundThreshold consecutive times and the PV is older than notFoundGracePeriod
+	notFoundGracePeriod time.Duration
+	notFoundThreshold   int
+	// used for updating notFoundMisses map
+	notFoundLock sync.Mutex
+	// notFoundMisses stores the number of consecutive checks a volume handle was missing
+	notFoundMisses map[string]int
+
+	// vaIndexer and csiNodeLister are used to detect attachment drift, it is disabled if they are nil
+	vaIndexer     cache.Indexer
+	csiNodeLister storagelisters.CSINodeLister
+
+	// classifier maps driver messages to structured reasons, it can be nil
+	classifier Classifier
+
+	// abnormal volume conditions are not reported while driverHealth reports the driver unhealthy, it can be nil
+	driverHealth *DriverHealthMonitor
+
+	// capabilities decide whether the driver reports published nodes, all of them are assumed if it is nil
+	capabilities *CapabilitiesMonitor
+
+	// volumeHealth records the volume conditions in VolumeHealth objects, it can be nil
+	volumeHealth *volumehealth.Updater
+
+	// readOnly only records volume conditions in healthStore, without events or any updates
+	readOnly bool
+}
+
+// PVHealthConditionCheckerOptions configures the optional features of PVHealthConditionChecker
+type PVHealthConditionCheckerOptions struct {
+	// MetricsRecorder records volume health metrics, it can be nil
+	MetricsRecorder *metrics.Recorder
+
+	// A bound volume missing on the storage backend NotFoundThreshold consecutive times is reported
+	// abnormal once its PV is older than NotFoundGracePeriod, 0 disables it
+	NotFoundGracePeriod time.Duration
+	NotFoundThreshold   int
+
+	// VAIndexer and CSINodeLister are used to detect attachment drift, it is disabled if they are nil
+	VAIndexer     cache.Indexer
+	CSINodeLister storagelisters.CSINodeLister
+
+	// Classifier maps driver messages of abnormal volumes to structured reasons, it can be nil
+	Classifier Classifier
+	// DriverHealth suppresses abnormal volume conditions while the driver is unhealthy, it can be nil
+	DriverHealth *DriverHealthMonitor
+	// Capabilities decide whether the driver reports published nodes, all of them are assumed if it is nil
+	Capabilities *CapabilitiesMonitor
+	// VolumeHealth records the volume conditions in VolumeHealth objects, it can be nil
+	VolumeHealth *volumehealth.Updater
 }
 
 // NewPVHealthConditionChecker returns an instance of PVHealthConditionChecker
@@ -61,26 +138,55 @@ func NewPVHealthConditionChecker(
 	pvLister corelisters.PersistentVolumeLister,
 	eventInformer coreinformers.EventInformer,
 	recorder record.EventRecorder,
+	options *PVHealthConditionCheckerOptions,
 ) *PVHealthConditionChecker {
+	if options == nil {
+		options = &PVHealthConditionCheckerOptions{}
+	}
 	return &PVHealthConditionChecker{
-		driverName:    name,
-		csiConn:       conn,
-		k8sClient:     kClient,
-		eventRecorder: recorder,
-		pvcLister:     pvcLister,
-		pvLister:      pvLister,
-		timeout:       timeout,
-		eventInformer: eventInformer,
-		csiPVHandler:  NewCSIPVHandler(conn),
+		driverName:      name,
+		csiConn:         conn,
+		k8sClient:       kClient,
+		eventRecorder:   recorder,
+		pvcLister:       pvcLister,
+		pvLister:        pvLister,
+		timeout:         timeout,
+		eventInformer:   eventInformer,
+		csiPVHandler:    NewCSIPVHandler(conn),
+		healthStore:     NewVolumeHealthStore(),
+		metricsRecorder: options.MetricsRecorder,
+
+		notFoundGracePeriod: options.NotFoundGracePeriod,
+		notFoundThreshold:   options.NotFoundThreshold,
+		notFoundMisses:      make(map[string]int),
+
+		vaIndexer:     options.VAIndexer,
+		csiNodeLister: options.CSINodeLister,
+
+		classifier:   options.Classifier,
+		driverHealth: options.DriverHealth,
+		capabilities: options.Capabilities,
+		volumeHealth: options.VolumeHealth,
 	}
 }
 
+// SetReadOnly makes the checker only record the health of volumes, which is returned by
+// VolumeHealthRecords, without sending events or updating PVCs, VolumeHealth objects and metrics.
+// It is used by one-shot audits which must not interfere with the running monitor.
+func (checker *PVHealthConditionChecker) SetReadOnly(readOnly bool) {
+	checker.readOnly = readOnly
+}
+
 // CheckControllerListVolumeStatuses checks volumes health condition by ListVolumes
 func (checker *PVHealthConditionChecker) CheckControllerListVolumeStatuses(ctx context.Context) error {
-	ctx, cancel := context.WithTimeout(ctx, checker.timeout)
-	defer cancel()
-
-	result, err := checker.csiPVHandler.ControllerListVolumeConditions(ctx)
+	start := time.Now()
+	defer func() {
+		checker.metricsRecorder.ObserveCheckDuration(metrics.MethodListVolumes, time.Since(start))
+	}()
+
+	listCtx, cancel := context.WithTimeout(ctx, checker.timeout)
+	result, err := checker.csiPVHandler.ControllerListVolumeConditions(listCtx)
+	cancel()
 	if err != nil {
 		return err
 	}
@@ -91,6 +197,7 @@ func (checker *PVHealthConditionChecker) CheckControllerListVolumeStatuses(ctx c
 	}
 
 	logger := klog.FromContext(ctx)
+	checked := 0
 	for _, pv := range pvs {
 		if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != checker.driverName {
 			logger.Info("CSI source is nil or the volume is not managed by this checker/monitor")
@@ -108,9 +215,16 @@ func (checker *PVHealthConditionChecker) CheckControllerListVolumeStatuses(ctx c
 			continue
 		}
 
-		volumeCondition := result[volumeHandle]
-		if volumeCondition == nil {
-			continue
+		volumeCondition, found := result[volumeHandle]
+		if !found {
+			// ListVolumes returned all volumes of the backend, so the volume is missing there
+			volumeCondition = checker.volumeNotFound(pv, volumeHandle)
+			if volumeCondition == nil {
+				logger.V(4).Info("Volume is not returned by ListVolumes", "pv", pv.Name, "volumeHandle", volumeHandle)
+				continue
+			}
+		} else {
+			checker.volumeFound(volumeHandle)
 		}
 
 		pvc, err := checker.pvcLister.PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(pv.Spec.ClaimRef.Name)
@@ -119,14 +233,19 @@ func (checker *PVHealthConditionChecker) CheckControllerListVolumeStatuses(ctx c
 			continue
 		}
 
-		if volumeCondition.GetAbnormal() {
-			// Since pv status is bound, we believe PV controller, do not check pv.Spec.ClaimRef here.
-			checker.eventRecorder.Event(pvc, v1.EventTypeWarning, "VolumeConditionAbnormal", volumeCondition.GetMessage())
-		} else {
-			// Send recovery event if the abnormal event was sent and unexpired
-			checker.sendRecoveryEventToPVC(logger, pvc)
+		checked++
+		// the timeout of ListVolumes does not limit the updates of all volumes
+		volumeCtx, cancel := context.WithTimeout(ctx, checker.timeout)
+		err = checker.handleVolumeCondition(volumeCtx, logger, pv, pvc, volumeHandle, volumeCondition)
+		cancel()
+		if err != nil {
+			logger.Error(err, "Update PVC health condition error", "pvc", klog.KObj(pvc))
+		}
+		if found && checker.supportsAttachmentDriftCheck(true) {
+			checker.checkAttachmentDrift(logger, pv, pvc, volumeHandle, volumeCondition)
 		}
 	}
+	checker.metricsRecorder.SetVolumesChecked(metrics.MethodListVolumes, checked)
 
 	return nil
 }
@@ -140,6 +259,37 @@ func (checker *PVHealthConditionChecker) GetVolumeHandle(pv *v1.PersistentVolume
 	return pv.Spec.CSI.VolumeHandle, nil
 }
 
+// IsVolumeAbnormal returns true if the volume of the PV was abnormal in its last check
+func (checker *PVHealthConditionChecker) IsVolumeAbnormal(pv *v1.PersistentVolume) bool {
+	volumeHandle, err := checker.GetVolumeHandle(pv)
+	if err != nil {
+		return false
+	}
+
+	record, ok := checker.healthStore.Get(volumeHandle)
+	return ok && record.State == VolumeHealthAbnormal
+}
+
+// VolumeHealthRecords returns the last known health of all checked volumes sorted by volume handle
+func (checker *PVHealthConditionChecker) VolumeHealthRecords() []VolumeHealthRecord {
+	return checker.healthStore.List()
+}
+
+// ForgetVolume drops the health state, not found count and metrics of the volume of a PV
+// which is not monitored anymore
+func (checker *PVHealthConditionChecker) ForgetVolume(pv *v1.PersistentVolume) {
+	volumeHandle, err := checker.GetVolumeHandle(pv)
+	if err != nil {
+		return
+	}
+
+	if record, ok := checker.healthStore.Get(volumeHandle); ok {
+		checker.metricsRecorder.DeleteVolumeHealth(record.PVCNamespace, record.PVCName, pv.Name, pv.Spec.StorageClassName)
+	}
+	checker.healthStore.Delete(volumeHandle)
+	checker.volumeFound(volumeHandle)
+}
+
 // CheckControllerVolumeStatus checks volume status in controller side
 func (checker *PVHealthConditionChecker) CheckControllerVolumeStatus(ctx context.Context, pv *v1.PersistentVolume) error {
 	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != checker.driverName {
@@ -164,9 +314,20 @@ func (checker *PVHealthConditionChecker) CheckControllerVolumeStatus(ctx context
 		return fmt.Errorf("volume handle in csi source is empty")
 	}
 
+	start := time.Now()
 	volumeCondition, err := checker.csiPVHandler.ControllerGetVolumeCondition(ctx, volumeHandle)
+	checker.metricsRecorder.ObserveCheckDuration(metrics.MethodControllerGetVolume, time.Since(start))
 	if err != nil {
-		return err
+		if status.Code(err) != codes.NotFound || checker.notFoundThreshold <= 0 {
+			return err
+		}
+		volumeCondition = checker.volumeNotFound(pv, volumeHandle)
+		if volumeCondition == nil {
+			logger.V(4).Info("Volume is not found by ControllerGetVolume", "pv", pv.Name, "volumeHandle", volumeHandle)
+			return nil
+		}
+	} else {
+		checker.volumeFound(volumeHandle)
 	}
 
 	pvc, err := checker.pvcLister.PersistentVolumeClaims(pv.Spec.ClaimRef.Namespace).Get(pv.Spec.ClaimRef.Name)
@@ -174,30 +335,190 @@ func (checker *PVHealthConditionChecker) CheckControllerVolumeStatus(ctx context
 		return err
 	}
 
-	// At the first stage, we just send PVC events
-	if volumeCondition.GetAbnormal() {
+	if err := checker.handleVolumeCondition(ctx, logger, pv, pvc, volumeHandle, volumeCondition); err != nil {
+		return err
+	}
+	if volumeCondition.GetReason() != VolumeNotFoundOnBackendReason && checker.supportsAttachmentDriftCheck(false) {
+		checker.checkAttachmentDrift(logger, pv, pvc, volumeHandle, volumeCondition)
+	}
+	return nil
+}
+
+// supportsAttachmentDriftCheck returns true if the driver currently reports the nodes volumes are
+// published to by ListVolumes or ControllerGetVolume
+func (checker *PVHealthConditionChecker) supportsAttachmentDriftCheck(listVolumes bool) bool {
+	return checker.capabilities == nil || checker.capabilities.Get().SupportsAttachmentDriftCheck(listVolumes)
+}
+
+// volumeNotFound records that the volume is missing on the backend. It returns an abnormal
+// condition once the volume was missing often enough and the PV is older than the grace period,
+// which avoids races with volumes that are being provisioned.
+func (checker *PVHealthConditionChecker) volumeNotFound(pv *v1.PersistentVolume, volumeHandle string) *VolumeConditionResult {
+	if checker.notFoundThreshold <= 0 {
+		return nil
+	}
+
+	checker.notFoundLock.Lock()
+	checker.notFoundMisses[volumeHandle]++
+	misses := checker.notFoundMisses[volumeHandle]
+	checker.notFoundLock.Unlock()
+
+	if misses < checker.notFoundThreshold || time.Since(pv.CreationTimestamp.Time) < checker.notFoundGracePeriod {
+		return nil
+	}
+
+	return &VolumeConditionResult{
+		abnormal: true,
+		message:  fmt.Sprintf("Volume %s is not found on the storage backend", volumeHandle),
+		reason:   VolumeNotFoundOnBackendReason,
+		severity: SeverityCritical,
+	}
+}
+
+// volumeFound resets the number of consecutive checks the volume was missing
+func (checker *PVHealthConditionChecker) volumeFound(volumeHandle string) {
+	checker.notFoundLock.Lock()
+	defer checker.notFoundLock.Unlock()
+
+	delete(checker.notFoundMisses, volumeHandle)
+}
+
+// abnormalReason returns the event and condition reason of an abnormal volume condition
+func abnormalReason(volumeCondition *VolumeConditionResult) string {
+	if volumeCondition.GetReason() != "" {
+		return volumeCondition.GetReason()
+	}
+	return VolumeConditionAbnormalReason
+}
+
+// handleVolumeCondition records the volume condition in the health store, sends PVC events
+// on state transitions and records the condition in the PVC status
+func (checker *PVHealthConditionChecker) handleVolumeCondition(ctx context.Context, logger klog.Logger, pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim, volumeHandle string, volumeCondition *VolumeConditionResult) error {
+	classifyVolumeCondition(checker.classifier, volumeCondition)
+	if volumeCondition.GetAbnormal() && !checker.driverHealth.IsHealthy() {
+		logger.V(4).Info("CSI driver is unavailable, ignoring abnormal volume condition", "pv", pv.Name, "message", volumeCondition.GetMessage())
+		return nil
+	}
+	transition := checker.healthStore.Record(volumeHandle, pv.Name, pvc.Namespace, pvc.Name, volumeCondition)
+	if transition.Changed() {
+		logger.V(4).Info("Volume health state changed", "pv", pv.Name, "from", transition.Previous, "to", transition.Current)
+	}
+	if checker.readOnly {
+		return nil
+	}
+	checker.metricsRecorder.SetVolumeHealth(pvc.Namespace, pvc.Name, pv.Name, pv.Spec.StorageClassName, volumeCondition.GetAbnormal())
+
+	switch transition.Current {
+	case VolumeHealthAbnormal:
 		// Since pv status is bound, we believe PV controller, do not check pv.Spec.ClaimRef here.
-		checker.eventRecorder.Event(pvc, v1.EventTypeWarning, "VolumeConditionAbnormal", volumeCondition.GetMessage())
+		if transition.Changed() {
+			checker.metricsRecorder.RecordAbnormalTransition(pv.Spec.StorageClassName, abnormalReason(volumeCondition), string(volumeCondition.GetSeverity()))
+			checker.eventRecorder.Event(pvc, v1.EventTypeWarning, abnormalReason(volumeCondition), volumeCondition.GetMessage())
+		} else if transition.MessageChanged {
+			checker.eventRecorder.Event(pvc, v1.EventTypeWarning, VolumeConditionChangedReason, volumeCondition.GetMessage())
+		}
+	case VolumeHealthRecovered:
+		checker.metricsRecorder.RecordRecoveredTransition(pv.Spec.StorageClassName)
+		checker.eventRecorder.Event(pvc, v1.EventTypeNormal, VolumeConditionNormalReason, util.DefaultRecoveryEventMessage)
+	case VolumeHealthHealthy:
+		if transition.Previous == VolumeHealthUnknown {
+			// The volume may have been abnormal before the monitor (re)started
+			checker.sendRecoveryEventToPVC(logger, pvc)
+		}
+	}
+
+	checker.recordVolumeHealth(ctx, logger, pvc, volumeCondition)
+	return checker.updatePVCHealthCondition(ctx, pvc, volumeCondition)
+}
+
+// recordVolumeHealth records the volume condition in the VolumeHealth of the PVC. Like events,
+// failed updates are only logged, the next check records the condition again.
+func (checker *PVHealthConditionChecker) recordVolumeHealth(ctx context.Context, logger klog.Logger, pvc *v1.PersistentVolumeClaim, volumeCondition *VolumeConditionResult) {
+	observation := volumehealth.Observation{
+		Source:  healthv1alpha1.VolumeHealthSourceControllerCheck,
+		State:   healthv1alpha1.VolumeHealthHealthy,
+		Reason:  VolumeConditionNormalReason,
+		Message: volumeCondition.GetMessage(),
+	}
+	if volumeCondition.GetAbnormal() {
+		observation.State = healthv1alpha1.VolumeHealthAbnormal
+		observation.Reason = abnormalReason(volumeCondition)
+	}
+	if err := checker.volumeHealth.Record(ctx, pvc, observation); err != nil {
+		logger.Error(err, "Failed to record volume health", "pvc", klog.KObj(pvc))
+	}
+}
+
+// updatePVCHealthCondition maintains the VolumeHealthy condition in the PVC status.
+// LastTransitionTime only changes when the condition status flips, and no patch is
+// issued if the condition is already up to date.
+func (checker *PVHealthConditionChecker) updatePVCHealthCondition(ctx context.Context, pvc *v1.PersistentVolumeClaim, volumeCondition *VolumeConditionResult) error {
+	condition := v1.PersistentVolumeClaimCondition{
+		Type:    util.VolumeHealthyCondition,
+		Status:  v1.ConditionTrue,
+		Reason:  VolumeConditionNormalReason,
+		Message: volumeCondition.GetMessage(),
+	}
+	if volumeCondition.GetAbnormal() {
+		condition.Status = v1.ConditionFalse
+		condition.Reason = abnormalReason(volumeCondition)
+	}
+
+	oldCondition := util.GetPVCCondition(pvc, util.VolumeHealthyCondition)
+	if oldCondition != nil && oldCondition.Status == condition.Status {
+		if oldCondition.Reason == condition.Reason && oldCondition.Message == condition.Message {
+			return nil
+		}
+		condition.LastTransitionTime = oldCondition.LastTransitionTime
+	} else {
+		condition.LastTransitionTime = metav1.Now()
+	}
+
+	newPVC := pvc.DeepCopy()
+	if existing := util.GetPVCCondition(newPVC, util.VolumeHealthyCondition); existing != nil {
+		*existing = condition
 	} else {
-		// Send recovery event if the abnormal event was sent and unexpired
-		checker.sendRecoveryEventToPVC(logger, pvc)
+		newPVC.Status.Conditions = append(newPVC.Status.Conditions, condition)
 	}
 
+	_, err := util.PatchPVCStatus(ctx, checker.k8sClient, pvc, newPVC)
+	if err != nil {
+		return fmt.Errorf("failed to update condition %s of PVC %s/%s: %v", util.VolumeHealthyCondition, pvc.Namespace, pvc.Name, err)
+	}
 	return nil
 }
 
 // sendRecoveryEventToPVC sends the recovery event to the pvc
-// If the volume condition is normal and abnormal event wasn't expired,
-// PVHealthConditionChecker should send recovery event.
+// It is used for volumes without in-memory health state, e.g. after a restart:
+// if the PVC condition still records the volume as unhealthy or the abnormal event
+// wasn't expired, PVHealthConditionChecker should send recovery event.
 func (checker *PVHealthConditionChecker) sendRecoveryEventToPVC(logger klog.Logger, pvc *v1.PersistentVolumeClaim) {
+	if condition := util.GetPVCCondition(pvc, util.VolumeHealthyCondition); condition != nil && condition.Status == v1.ConditionFalse {
+		checker.eventRecorder.Event(pvc, v1.EventTypeNormal, VolumeConditionNormalReason, util.DefaultRecoveryEventMessage)
+		return
+	}
+
 	pvcUID := string(pvc.ObjectMeta.GetUID())
-	key := fmt.Sprintf("%s:%s:%s", pvcUID, v1.EventTypeWarning, "VolumeConditionAbnormal")
-	events, err := checker.eventInformer.Informer().GetIndexer().ByIndex(util.DefaultEventIndexerName, key)
-	if err != nil {
-		logger.Info("Get abnormal event from indexer failed", "err", err)
+	for _, reason := range checker.abnormalEventReasons() {
+		key := fmt.Sprintf("%s:%s:%s", pvcUID, v1.EventTypeWarning, reason)
+		events, err := checker.eventInformer.Informer().GetIndexer().ByIndex(util.DefaultEventIndexerName, key)
+		if err != nil {
+			logger.Info("Get abnormal event from indexer failed", "err", err)
+			continue
+		}
+
+		if len(events) > 0 {
+			checker.eventRecorder.Event(pvc, v1.EventTypeNormal, VolumeConditionNormalReason, util.DefaultRecoveryEventMessage)
+			return
+		}
 	}
+}
 
-	if len(events) > 0 {
-		checker.eventRecorder.Event(pvc, v1.EventTypeNormal, "VolumeConditionNormal", util.DefaultRecoveryEventMessage)
+// abnormalEventReasons returns all reasons of the events sent for abnormal volumes
+func (checker *PVHealthConditionChecker) abnormalEventReasons() []string {
+	reasons := []string{VolumeConditionAbnormalReason, VolumeNotFoundOnBackendReason, VolumeConditionChangedReason}
+	if checker.classifier != nil {
+		reasons = append(reasons, checker.classifier.Reasons()...)
 	}
+	return reasons
 }
@@ -1,12 +1,18 @@
 package csi_handler
 
 import (
+	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	informerV1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
 	"k8s.io/klog/v2/ktesting"
 	_ "k8s.io/klog/v2/ktesting/init"
 
@@ -15,11 +21,15 @@ import (
 	"github.com/kubernetes-csi/csi-test/v5/driver"
 	"github.com/kubernetes-csi/csi-test/v5/utils"
 	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/util"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type MockPVHealthConditionChecker struct {
 	pvHealthConditionChecker *PVHealthConditionChecker
+	k8sClient                kubernetes.Interface
 	pvcInformer              informerV1.PersistentVolumeClaimInformer
 	pvInformer               informerV1.PersistentVolumeInformer
 	eventStore               chan string
@@ -27,6 +37,29 @@ type MockPVHealthConditionChecker struct {
 	csiNodeServer            *driver.MockNodeServer
 }
 
+// addPVAndPVC adds the objects to both the informer caches and the fake API server,
+// so that PVC status patches issued by the checker can succeed
+func (checker *MockPVHealthConditionChecker) addPVAndPVC(t *testing.T, pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim) {
+	if err := checker.pvInformer.Informer().GetStore().Add(pv); err != nil {
+		t.Fatalf("failed to add PV to informer: %v", err)
+	}
+	if err := checker.pvcInformer.Informer().GetStore().Add(pvc); err != nil {
+		t.Fatalf("failed to add PVC to informer: %v", err)
+	}
+	if _, err := checker.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(context.Background(), pvc, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create PVC: %v", err)
+	}
+}
+
+// getVolumeHealthyCondition returns the VolumeHealthy condition of the PVC stored in the fake API server
+func (checker *MockPVHealthConditionChecker) getVolumeHealthyCondition(t *testing.T, pvc *v1.PersistentVolumeClaim) *v1.PersistentVolumeClaimCondition {
+	got, err := checker.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(context.Background(), pvc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get PVC: %v", err)
+	}
+	return util.GetPVCCondition(got, util.VolumeHealthyCondition)
+}
+
 func createMockPVHealthConditionChecker(t *testing.T) *MockPVHealthConditionChecker {
 	k8sClient, informer := mock.FakeK8s()
 	_, _, _, controllerServer, nodeServer, csiConn, err := mock.CreateMockServer(t)
@@ -45,11 +78,14 @@ func createMockPVHealthConditionChecker(t *testing.T) *MockPVHealthConditionChec
 			eventRecorder: &record.FakeRecorder{
 				Events: eventStore,
 			},
-			eventInformer: informer.Core().V1().Events(),
-			pvcLister:     informer.Core().V1().PersistentVolumeClaims().Lister(),
-			pvLister:      informer.Core().V1().PersistentVolumes().Lister(),
-			csiPVHandler:  handler,
+			eventInformer:  informer.Core().V1().Events(),
+			pvcLister:      informer.Core().V1().PersistentVolumeClaims().Lister(),
+			pvLister:       informer.Core().V1().PersistentVolumes().Lister(),
+			csiPVHandler:   handler,
+			healthStore:    NewVolumeHealthStore(),
+			notFoundMisses: make(map[string]int),
 		},
+		k8sClient:           k8sClient,
 		pvcInformer:         informer.Core().V1().PersistentVolumeClaims(),
 		pvInformer:          informer.Core().V1().PersistentVolumes(),
 		csiControllerServer: controllerServer,
@@ -67,12 +103,14 @@ func TestPVHealthConditionChecker_CheckControllerListVolumeStatuses(t *testing.T
 		volumeId          string
 		wantErr           bool
 		wantAbnormalEvent bool
+		wantCondition     v1.ConditionStatus
 	}{
 		{
 			name:              "VolumeConditionAbnormal Case",
 			pvc:               mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound),
 			pv:                mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound),
 			wantAbnormalEvent: true,
+			wantCondition:     v1.ConditionFalse,
 			volumeId:          "1",
 		},
 		{
@@ -80,6 +118,7 @@ func TestPVHealthConditionChecker_CheckControllerListVolumeStatuses(t *testing.T
 			pvc:               mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound),
 			pv:                mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "2", "uid", &mock.FSVolumeMode, v1.VolumeBound),
 			wantAbnormalEvent: false,
+			wantCondition:     v1.ConditionTrue,
 			volumeId:          "2",
 		},
 		{
@@ -98,13 +137,7 @@ func TestPVHealthConditionChecker_CheckControllerListVolumeStatuses(t *testing.T
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			checker := createMockPVHealthConditionChecker(t)
-			if err := checker.pvInformer.Informer().GetStore().Add(tt.pv); err != nil {
-				t.Errorf("PVHealthConditionChecker.CheckControllerListVolumeStatuses() error = %v", err)
-			}
-
-			if err := checker.pvcInformer.Informer().GetStore().Add(tt.pvc); err != nil {
-				t.Errorf("PVHealthConditionChecker.CheckControllerListVolumeStatuses() error = %v", err)
-			}
+			checker.addPVAndPVC(t, tt.pv, tt.pvc)
 
 			in = &csi.ListVolumesRequest{
 				StartingToken: "",
@@ -134,6 +167,13 @@ func TestPVHealthConditionChecker_CheckControllerListVolumeStatuses(t *testing.T
 			} else {
 				assert.EqualValues(mock.ErrorWatchTimeout.Error(), err.Error())
 			}
+
+			condition := checker.getVolumeHealthyCondition(t, tt.pvc)
+			if tt.wantCondition == "" {
+				assert.Nil(condition)
+			} else if assert.NotNil(condition) {
+				assert.Equal(tt.wantCondition, condition.Status)
+			}
 		})
 	}
 }
@@ -181,6 +221,7 @@ func TestPVHealthConditionChecker_CheckControllerVolumeStatus(t *testing.T) {
 		volumeId          string
 		wantErr           bool
 		wantAbnormalEvent bool
+		wantCondition     v1.ConditionStatus
 	}{
 		{
 			name:              "VolumeConditionAbnormal Case",
@@ -188,12 +229,14 @@ func TestPVHealthConditionChecker_CheckControllerVolumeStatus(t *testing.T) {
 			pv:                mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound),
 			volumeId:          "1",
 			wantAbnormalEvent: true,
+			wantCondition:     v1.ConditionFalse,
 		},
 		{
 			name:              "VolumeConditionNormal Case",
 			pvc:               mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound),
 			pv:                mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "2", "uid", &mock.FSVolumeMode, v1.VolumeBound),
 			wantAbnormalEvent: false,
+			wantCondition:     v1.ConditionTrue,
 			volumeId:          "2",
 		},
 		{
@@ -221,13 +264,7 @@ func TestPVHealthConditionChecker_CheckControllerVolumeStatus(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			checker := createMockPVHealthConditionChecker(t)
-			if err := checker.pvInformer.Informer().GetStore().Add(tt.pv); err != nil {
-				t.Errorf("PVHealthConditionChecker.CheckControllerVolumeStatus() error = %v", err)
-			}
-
-			if err := checker.pvcInformer.Informer().GetStore().Add(tt.pvc); err != nil {
-				t.Errorf("PVHealthConditionChecker.CheckControllerVolumeStatus() error = %v", err)
-			}
+			checker.addPVAndPVC(t, tt.pv, tt.pvc)
 
 			in := &csi.ControllerGetVolumeRequest{
 				VolumeId: tt.volumeId,
@@ -253,6 +290,338 @@ func TestPVHealthConditionChecker_CheckControllerVolumeStatus(t *testing.T) {
 			} else {
 				assert.EqualValues(mock.ErrorWatchTimeout.Error(), err.Error())
 			}
+
+			condition := checker.getVolumeHealthyCondition(t, tt.pvc)
+			if tt.wantCondition == "" {
+				assert.Nil(condition)
+			} else if assert.NotNil(condition) {
+				assert.Equal(tt.wantCondition, condition.Status)
+			}
+		})
+	}
+}
+
+func TestPVHealthConditionChecker_UpdatePVCHealthCondition(t *testing.T) {
+	assert := assert.New(t)
+	checker := createMockPVHealthConditionChecker(t)
+	pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+	checker.addPVAndPVC(t, mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound), pvc)
+
+	update := func(abnormal bool, message string) *v1.PersistentVolumeClaimCondition {
+		current, err := checker.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(context.Background(), pvc.Name, metav1.GetOptions{})
+		assert.Nil(err)
+		err = checker.pvHealthConditionChecker.updatePVCHealthCondition(context.Background(), current, &VolumeConditionResult{abnormal: abnormal, message: message})
+		assert.Nil(err)
+		return checker.getVolumeHealthyCondition(t, pvc)
+	}
+
+	abnormal := update(true, "disk degraded")
+	assert.Equal(v1.ConditionFalse, abnormal.Status)
+	assert.Equal(VolumeConditionAbnormalReason, abnormal.Reason)
+	assert.Equal("disk degraded", abnormal.Message)
+	assert.False(abnormal.LastTransitionTime.IsZero())
+
+	// Same status with a new message keeps the transition time
+	abnormal.LastTransitionTime = metav1.NewTime(abnormal.LastTransitionTime.Add(-time.Hour))
+	current, err := checker.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(context.Background(), pvc.Name, metav1.GetOptions{})
+	assert.Nil(err)
+	current.Status.Conditions = []v1.PersistentVolumeClaimCondition{*abnormal}
+	_, err = checker.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).UpdateStatus(context.Background(), current, metav1.UpdateOptions{})
+	assert.Nil(err)
+	changed := update(true, "replica lost")
+	assert.Equal("replica lost", changed.Message)
+	assert.True(changed.LastTransitionTime.Equal(&abnormal.LastTransitionTime))
+
+	// Status change bumps the transition time
+	normal := update(false, "")
+	assert.Equal(v1.ConditionTrue, normal.Status)
+	assert.Equal(VolumeConditionNormalReason, normal.Reason)
+	assert.True(normal.LastTransitionTime.After(abnormal.LastTransitionTime.Time))
+}
+
+func TestPVHealthConditionChecker_EventsOnTransitions(t *testing.T) {
+	assert := assert.New(t)
+	checker := createMockPVHealthConditionChecker(t)
+	eventStore := make(chan string, 10)
+	checker.pvHealthConditionChecker.eventRecorder = &record.FakeRecorder{Events: eventStore}
+
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+	checker.addPVAndPVC(t, pv, pvc)
+
+	checks := []struct {
+		abnormal  bool
+		message   string
+		wantEvent string
+	}{
+		{abnormal: true, message: "Volume not found", wantEvent: mock.AbnormalEvent},
+		{abnormal: true, message: "Volume not found"},
+		{abnormal: true, message: "Volume degraded", wantEvent: "Warning VolumeConditionChanged Volume degraded"},
+		{abnormal: false, wantEvent: mock.NormalEvent},
+		{abnormal: false},
+	}
+	_, ctx := ktesting.NewTestContext(t)
+	logger := klog.FromContext(ctx)
+	for i, c := range checks {
+		current, err := checker.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
+		assert.Nil(err)
+		err = checker.pvHealthConditionChecker.handleVolumeCondition(ctx, logger, pv, current, "1", &VolumeConditionResult{abnormal: c.abnormal, message: c.message})
+		assert.Nil(err)
+
+		select {
+		case event := <-eventStore:
+			assert.Equal(c.wantEvent, event, "check %d", i)
+		default:
+			assert.Empty(c.wantEvent, "check %d: no event sent", i)
+		}
+	}
+}
+
+func TestPVHealthConditionChecker_ClassifiedReason(t *testing.T) {
+	assert := assert.New(t)
+	checker := createMockPVHealthConditionChecker(t)
+	eventStore := make(chan string, 10)
+	checker.pvHealthConditionChecker.eventRecorder = &record.FakeRecorder{Events: eventStore}
+	classifier, err := NewRuleClassifier([]ClassifierRule{{Prefix: "replica lost", Reason: "ReplicaLost", Severity: SeverityCritical}})
+	assert.Nil(err)
+	checker.pvHealthConditionChecker.classifier = classifier
+
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+	checker.addPVAndPVC(t, pv, pvc)
+
+	_, ctx := ktesting.NewTestContext(t)
+	checks := []struct {
+		message    string
+		wantEvent  string
+		wantReason string
+	}{
+		{message: "replica lost on node-1", wantEvent: "Warning ReplicaLost replica lost on node-1", wantReason: "ReplicaLost"},
+		// a message which is not classified uses the default reason
+		{message: "disk degraded", wantEvent: "Warning VolumeConditionChanged disk degraded", wantReason: VolumeConditionAbnormalReason},
+	}
+	for i, c := range checks {
+		current, err := checker.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
+		assert.Nil(err)
+		err = checker.pvHealthConditionChecker.handleVolumeCondition(ctx, klog.FromContext(ctx), pv, current, "1", &VolumeConditionResult{abnormal: true, message: c.message})
+		assert.Nil(err)
+
+		assert.Equal(c.wantEvent, <-eventStore, "check %d", i)
+		assert.Equal(c.wantReason, checker.getVolumeHealthyCondition(t, pvc).Reason, "check %d", i)
+	}
+
+	record, ok := checker.pvHealthConditionChecker.healthStore.Get("1")
+	assert.True(ok)
+	assert.Equal(VolumeConditionAbnormalReason, record.Reason)
+	assert.Equal(DefaultSeverity, record.Severity)
+}
+
+func TestPVHealthConditionChecker_DriverUnavailable(t *testing.T) {
+	assert := assert.New(t)
+	checker := createMockPVHealthConditionChecker(t)
+	eventStore := make(chan string, 10)
+	checker.pvHealthConditionChecker.eventRecorder = &record.FakeRecorder{Events: eventStore}
+	monitor := newTestDriverHealthMonitor(make(chan string, 10))
+	checker.pvHealthConditionChecker.driverHealth = monitor
+
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+	checker.addPVAndPVC(t, pv, pvc)
+
+	_, ctx := ktesting.NewTestContext(t)
+	logger := klog.FromContext(ctx)
+	monitor.ConnectionLost(ctx)
+	current, err := checker.k8sClient.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, pvc.Name, metav1.GetOptions{})
+	assert.Nil(err)
+	assert.Nil(checker.pvHealthConditionChecker.handleVolumeCondition(ctx, logger, pv, current, "1", &VolumeConditionResult{abnormal: true, message: "backend unreachable"}))
+	assert.Empty(eventStore)
+	assert.False(checker.pvHealthConditionChecker.IsVolumeAbnormal(pv))
+	assert.Nil(checker.getVolumeHealthyCondition(t, pvc))
+
+	// abnormal volumes are reported again once the driver recovered
+	monitor.recordProbe(logger, nil)
+	assert.Nil(checker.pvHealthConditionChecker.handleVolumeCondition(ctx, logger, pv, current, "1", &VolumeConditionResult{abnormal: true, message: "backend unreachable"}))
+	assert.Equal("Warning VolumeConditionAbnormal backend unreachable", <-eventStore)
+}
+
+func TestPVHealthConditionChecker_ReadOnly(t *testing.T) {
+	assert := assert.New(t)
+	checker := createMockPVHealthConditionChecker(t)
+	checker.pvHealthConditionChecker.SetReadOnly(true)
+
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+	checker.addPVAndPVC(t, pv, pvc)
+
+	_, ctx := ktesting.NewTestContext(t)
+	assert.Nil(checker.pvHealthConditionChecker.handleVolumeCondition(ctx, klog.FromContext(ctx), pv, pvc, "1", &VolumeConditionResult{abnormal: true, message: "Volume not found"}))
+	assert.Empty(checker.eventStore)
+	assert.Nil(checker.getVolumeHealthyCondition(t, pvc))
+
+	// the condition is only recorded in the health store
+	assert.True(checker.pvHealthConditionChecker.IsVolumeAbnormal(pv))
+	records := checker.pvHealthConditionChecker.VolumeHealthRecords()
+	assert.Len(records, 1)
+	assert.Equal("Volume not found", records[0].Message)
+}
+
+func TestPVHealthConditionChecker_RecoveryFromPVCCondition(t *testing.T) {
+	assert := assert.New(t)
+	checker := createMockPVHealthConditionChecker(t)
+
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "2", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+	// The abnormal condition was recorded before the monitor restarted
+	pvc.Status.Conditions = []v1.PersistentVolumeClaimCondition{
+		{
+			Type:   util.VolumeHealthyCondition,
+			Status: v1.ConditionFalse,
+			Reason: VolumeConditionAbnormalReason,
+		},
+	}
+	checker.addPVAndPVC(t, pv, pvc)
+
+	_, ctx := ktesting.NewTestContext(t)
+	err := checker.pvHealthConditionChecker.handleVolumeCondition(ctx, klog.FromContext(ctx), pv, pvc, "2", &VolumeConditionResult{})
+	assert.Nil(err)
+
+	event, err := mock.WatchEvent(true, checker.eventStore)
+	assert.Nil(err)
+	assert.Equal(mock.NormalEvent, event)
+	assert.Equal(v1.ConditionTrue, checker.getVolumeHealthyCondition(t, pvc).Status)
+}
+
+func TestPVHealthConditionChecker_RecoveryFromAbnormalEvent(t *testing.T) {
+	for _, reason := range []string{VolumeConditionAbnormalReason, VolumeNotFoundOnBackendReason, "ReplicaLost"} {
+		t.Run(reason, func(t *testing.T) {
+			assert := assert.New(t)
+			checker := createMockPVHealthConditionChecker(t)
+			classifier, err := NewRuleClassifier([]ClassifierRule{{Prefix: "replica lost", Reason: "ReplicaLost"}})
+			assert.Nil(err)
+			checker.pvHealthConditionChecker.classifier = classifier
+
+			eventInformer := checker.pvHealthConditionChecker.eventInformer.Informer()
+			assert.Nil(eventInformer.AddIndexers(cache.Indexers{
+				util.DefaultEventIndexerName: func(obj interface{}) ([]string, error) {
+					event := obj.(*v1.Event)
+					return []string{fmt.Sprintf("%s:%s:%s", event.InvolvedObject.UID, event.Type, event.Reason)}, nil
+				},
+			}))
+
+			pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "2", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+			pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+			checker.addPVAndPVC(t, pv, pvc)
+			// The abnormal event was sent before the monitor restarted
+			assert.Nil(eventInformer.GetStore().Add(&v1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: "event", Namespace: mock.DefaultNS},
+				InvolvedObject: v1.ObjectReference{UID: pvc.UID},
+				Type:           v1.EventTypeWarning,
+				Reason:         reason,
+			}))
+
+			_, ctx := ktesting.NewTestContext(t)
+			assert.Nil(checker.pvHealthConditionChecker.handleVolumeCondition(ctx, klog.FromContext(ctx), pv, pvc, "2", &VolumeConditionResult{}))
+
+			event, err := mock.WatchEvent(true, checker.eventStore)
+			assert.Nil(err)
+			assert.Equal(mock.NormalEvent, event)
+		})
+	}
+}
+
+func TestPVHealthConditionChecker_VolumeNotFoundByListVolumes(t *testing.T) {
+	tests := []struct {
+		name        string
+		pvAge       time.Duration
+		threshold   int
+		checks      int
+		wantEventAt int
+	}{
+		{
+			name:        "reported after consecutive misses",
+			pvAge:       time.Hour,
+			threshold:   2,
+			checks:      3,
+			wantEventAt: 2,
+		},
+		{
+			name:      "not reported within grace period",
+			pvAge:     time.Minute,
+			threshold: 1,
+			checks:    2,
+		},
+		{
+			name:   "detection disabled",
+			pvAge:  time.Hour,
+			checks: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			checker := createMockPVHealthConditionChecker(t)
+			eventStore := make(chan string, 10)
+			checker.pvHealthConditionChecker.eventRecorder = &record.FakeRecorder{Events: eventStore}
+			checker.pvHealthConditionChecker.notFoundGracePeriod = 5 * time.Minute
+			checker.pvHealthConditionChecker.notFoundThreshold = tt.threshold
+
+			pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+			pv.CreationTimestamp = metav1.NewTime(time.Now().Add(-tt.pvAge))
+			pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+			checker.addPVAndPVC(t, pv, pvc)
+
+			in := &csi.ListVolumesRequest{}
+			out := &csi.ListVolumesResponse{
+				Entries: []*csi.ListVolumesResponse_Entry{
+					{
+						Volume: volume2,
+						Status: &csi.ListVolumesResponse_VolumeStatus{
+							VolumeCondition: normalVolumeCondition,
+						},
+					},
+				},
+			}
+			checker.csiControllerServer.EXPECT().ListVolumes(gomock.Any(), utils.Protobuf(in)).Return(out, nil).Times(tt.checks)
+
+			_, ctx := ktesting.NewTestContext(t)
+			for i := 1; i <= tt.checks; i++ {
+				assert.Nil(checker.pvHealthConditionChecker.CheckControllerListVolumeStatuses(ctx))
+				select {
+				case event := <-eventStore:
+					assert.Equal(tt.wantEventAt, i, "unexpected event %q", event)
+					assert.Equal("Warning VolumeNotFoundOnBackend Volume 1 is not found on the storage backend", event)
+				default:
+					assert.NotEqual(tt.wantEventAt, i, "check %d: no event sent", i)
+				}
+			}
+
+			condition := checker.getVolumeHealthyCondition(t, pvc)
+			if tt.wantEventAt > 0 && assert.NotNil(condition) {
+				assert.Equal(v1.ConditionFalse, condition.Status)
+				assert.Equal(VolumeNotFoundOnBackendReason, condition.Reason)
+			} else {
+				assert.Nil(condition)
+			}
 		})
 	}
 }
+
+func TestPVHealthConditionChecker_VolumeNotFoundByControllerGetVolume(t *testing.T) {
+	assert := assert.New(t)
+	checker := createMockPVHealthConditionChecker(t)
+	checker.pvHealthConditionChecker.notFoundThreshold = 1
+
+	pv := mock.CreatePV(2, "pvc", "pv", mock.DefaultNS, "1", "uid", &mock.FSVolumeMode, v1.VolumeBound)
+	pvc := mock.CreatePVC(1, 2, "pvc", "uid", mock.DefaultNS, "pv", v1.ClaimBound)
+	checker.addPVAndPVC(t, pv, pvc)
+
+	in := &csi.ControllerGetVolumeRequest{VolumeId: "1"}
+	checker.csiControllerServer.EXPECT().ControllerGetVolume(gomock.Any(), utils.Protobuf(in)).Return(nil, status.Error(codes.NotFound, "not found")).Times(1)
+
+	_, ctx := ktesting.NewTestContext(t)
+	assert.Nil(checker.pvHealthConditionChecker.CheckControllerVolumeStatus(ctx, pv))
+
+	event, err := mock.WatchEvent(true, checker.eventStore)
+	assert.Nil(err)
+	assert.Equal("Warning VolumeNotFoundOnBackend Volume 1 is not found on the storage backend", event)
+}
@@ -42,6 +42,15 @@ func NewCSIPVHandler(conn *grpc.ClientConn) CSIHandler {
 type VolumeConditionResult struct {
 	abnormal bool
 	message  string
+	// reason overrides the default abnormal reason, it is empty for conditions reported by the driver
+	// until they are classified
+	reason string
+	// severity is the severity of an abnormal condition, it is empty for normal conditions
+	severity Severity
+	// publishedNodeIDs are the nodes the volume is published to according to the storage backend
+	publishedNodeIDs []string
+	// usage is the bytes and inodes usage of the volume, it is only reported by NodeGetVolumeStats
+	usage []*csi.VolumeUsage
 }
 
 func (vcr *VolumeConditionResult) GetAbnormal() bool {
@@ -52,22 +61,37 @@ func (vcr *VolumeConditionResult) GetMessage() string {
 	return vcr.message
 }
 
+func (vcr *VolumeConditionResult) GetReason() string {
+	return vcr.reason
+}
+
+func (vcr *VolumeConditionResult) GetSeverity() Severity {
+	return vcr.severity
+}
+
+func (vcr *VolumeConditionResult) GetPublishedNodeIDs() []string {
+	return vcr.publishedNodeIDs
+}
+
+func (vcr *VolumeConditionResult) GetUsage() []*csi.VolumeUsage {
+	return vcr.usage
+}
+
 func (handler *csiPVHandler) ControllerListVolumeConditions(ctx context.Context) (map[string]*VolumeConditionResult, error) {
 	p := map[string]*VolumeConditionResult{}
 
 	token := ""
 	for {
-		rsp, err := handler.controllerClient.ListVolumes(ctx, &csi.ListVolumesRequest{
-			StartingToken: token,
-		})
+		rsp, err := handler.listVolumesPage(ctx, 0, token)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list volumes: %v", err)
 		}
 
 		for _, e := range rsp.Entries {
 			p[e.GetVolume().VolumeId] = &VolumeConditionResult{
-				abnormal: e.GetStatus().GetVolumeCondition().GetAbnormal(),
-				message:  e.GetStatus().GetVolumeCondition().GetMessage(),
+				abnormal:         e.GetStatus().GetVolumeCondition().GetAbnormal(),
+				message:          e.GetStatus().GetVolumeCondition().GetMessage(),
+				publishedNodeIDs: e.GetStatus().GetPublishedNodeIds(),
 			}
 		}
 		token = rsp.NextToken
@@ -79,6 +103,15 @@ func (handler *csiPVHandler) ControllerListVolumeConditions(ctx context.Context)
 	return p, nil
 }
 
+// listVolumesPage returns the page of volumes starting at token, with at most maxEntries entries
+// if maxEntries is greater than zero
+func (handler *csiPVHandler) listVolumesPage(ctx context.Context, maxEntries int32, token string) (*csi.ListVolumesResponse, error) {
+	return handler.controllerClient.ListVolumes(ctx, &csi.ListVolumesRequest{
+		MaxEntries:    maxEntries,
+		StartingToken: token,
+	})
+}
+
 func (handler *csiPVHandler) ControllerGetVolumeCondition(ctx context.Context, volumeID string) (*VolumeConditionResult, error) {
 	req := csi.ControllerGetVolumeRequest{
 		VolumeId: volumeID,
@@ -94,7 +127,11 @@ func (handler *csiPVHandler) ControllerGetVolumeCondition(ctx context.Context, v
 	// We reach here only when VOLUME_CONDITION controller capability is supported
 	// so the Status in ControllerGetVolumeResponse must not be nil
 
-	return &VolumeConditionResult{abnormal: res.GetStatus().GetVolumeCondition().GetAbnormal(), message: res.GetStatus().GetVolumeCondition().GetMessage()}, nil
+	return &VolumeConditionResult{
+		abnormal:         res.GetStatus().GetVolumeCondition().GetAbnormal(),
+		message:          res.GetStatus().GetVolumeCondition().GetMessage(),
+		publishedNodeIDs: res.GetStatus().GetPublishedNodeIds(),
+	}, nil
 }
 
 func (handler *csiPVHandler) NodeGetVolumeCondition(ctx context.Context, volumeID string, volumePath string, volumeStagingPath string) (*VolumeConditionResult, error) {
@@ -111,5 +148,9 @@ func (handler *csiPVHandler) NodeGetVolumeCondition(ctx context.Context, volumeI
 		return nil, err
 	}
 
-	return &VolumeConditionResult{abnormal: res.GetVolumeCondition().GetAbnormal(), message: res.GetVolumeCondition().GetMessage()}, nil
+	return &VolumeConditionResult{
+		abnormal: res.GetVolumeCondition().GetAbnormal(),
+		message:  res.GetVolumeCondition().GetMessage(),
+		usage:    res.GetUsage(),
+	}, nil
 }
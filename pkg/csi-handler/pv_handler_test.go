@@ -65,7 +65,8 @@ func Test_csiPVHandler_ControllerListVolumeConditions(t *testing.T) {
 			{
 				Volume: volume1,
 				Status: &csi.ListVolumesResponse_VolumeStatus{
-					VolumeCondition: abnormalVolumeCondition,
+					PublishedNodeIds: []string{"node-id-1"},
+					VolumeCondition:  abnormalVolumeCondition,
 				},
 			},
 			{
@@ -88,8 +89,9 @@ func Test_csiPVHandler_ControllerListVolumeConditions(t *testing.T) {
 			name: "case1",
 			want: map[string]*VolumeConditionResult{
 				"1": {
-					abnormal: true,
-					message:  "Volume not found",
+					abnormal:         true,
+					message:          "Volume not found",
+					publishedNodeIDs: []string{"node-id-1"},
 				},
 				"2": {
 					abnormal: false,
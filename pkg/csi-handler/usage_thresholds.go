@@ -0,0 +1,112 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// UsageLevel is how full a volume is compared to its usage thresholds
+type UsageLevel string
+
+const (
+	// UsageLevelNormal means the volume is below its warning threshold
+	UsageLevelNormal UsageLevel = ""
+	// UsageLevelWarning means the volume reached its warning threshold
+	UsageLevelWarning UsageLevel = "warning"
+	// UsageLevelCritical means the volume reached its critical threshold
+	UsageLevelCritical UsageLevel = "critical"
+)
+
+// severity orders usage levels, a higher level is more severe
+func (level UsageLevel) severity() int {
+	switch level {
+	case UsageLevelWarning:
+		return 1
+	case UsageLevelCritical:
+		return 2
+	}
+	return 0
+}
+
+// UsageThreshold holds the used percentages of bytes or inodes at which a volume is nearly full,
+// 0 disables a level
+type UsageThreshold struct {
+	Warning  float64 `json:"warning"`
+	Critical float64 `json:"critical"`
+}
+
+// Level returns the usage level of the used percentage and the threshold it reached
+func (threshold UsageThreshold) Level(percent float64) (UsageLevel, float64) {
+	switch {
+	case threshold.Critical > 0 && percent >= threshold.Critical:
+		return UsageLevelCritical, threshold.Critical
+	case threshold.Warning > 0 && percent >= threshold.Warning:
+		return UsageLevelWarning, threshold.Warning
+	}
+	return UsageLevelNormal, 0
+}
+
+func (threshold UsageThreshold) validate() error {
+	if threshold.Warning < 0 || threshold.Warning > 100 || threshold.Critical < 0 || threshold.Critical > 100 {
+		return fmt.Errorf("thresholds must be percentages between 0 and 100, got warning %v and critical %v", threshold.Warning, threshold.Critical)
+	}
+	if threshold.Warning > 0 && threshold.Critical > 0 && threshold.Warning > threshold.Critical {
+		return fmt.Errorf("warning threshold %v is above critical threshold %v", threshold.Warning, threshold.Critical)
+	}
+	return nil
+}
+
+// UsageThresholds holds the usage thresholds of volumes by StorageClass
+type UsageThresholds struct {
+	// Default applies to volumes whose StorageClass has no thresholds of its own
+	Default UsageThreshold `json:"default"`
+	// StorageClasses holds thresholds by StorageClass name
+	StorageClasses map[string]UsageThreshold `json:"storageClasses"`
+}
+
+// LoadUsageThresholds reads usage thresholds from a YAML or JSON file
+func LoadUsageThresholds(path string) (*UsageThresholds, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	thresholds := &UsageThresholds{}
+	if err := yaml.UnmarshalStrict(data, thresholds); err != nil {
+		return nil, fmt.Errorf("failed to parse usage thresholds %s: %v", path, err)
+	}
+	if err := thresholds.Default.validate(); err != nil {
+		return nil, fmt.Errorf("invalid default usage thresholds: %v", err)
+	}
+	for storageClass, threshold := range thresholds.StorageClasses {
+		if err := threshold.validate(); err != nil {
+			return nil, fmt.Errorf("invalid usage thresholds of StorageClass %s: %v", storageClass, err)
+		}
+	}
+	return thresholds, nil
+}
+
+// ForStorageClass returns the usage threshold of the StorageClass
+func (thresholds *UsageThresholds) ForStorageClass(storageClass string) UsageThreshold {
+	if threshold, ok := thresholds.StorageClasses[storageClass]; ok {
+		return threshold
+	}
+	return thresholds.Default
+}
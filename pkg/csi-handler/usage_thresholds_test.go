@@ -0,0 +1,87 @@
+package csi_handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadUsageThresholds(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    *UsageThresholds
+		wantErr bool
+	}{
+		{
+			name: "default and storage class",
+			config: `
+default:
+  warning: 85
+  critical: 95
+storageClasses:
+  fast:
+    warning: 70
+`,
+			want: &UsageThresholds{
+				Default:        UsageThreshold{Warning: 85, Critical: 95},
+				StorageClasses: map[string]UsageThreshold{"fast": {Warning: 70}},
+			},
+		},
+		{
+			name:    "warning above critical",
+			config:  "default: {warning: 95, critical: 85}",
+			wantErr: true,
+		},
+		{
+			name:    "not a percentage",
+			config:  "storageClasses: {fast: {critical: 120}}",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			config:  "default: {warn: 80}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "thresholds.yaml")
+			assert.Nil(t, os.WriteFile(path, []byte(tt.config), 0644))
+
+			got, err := LoadUsageThresholds(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUsageThreshold_Level(t *testing.T) {
+	thresholds := &UsageThresholds{
+		Default:        UsageThreshold{Warning: 85, Critical: 95},
+		StorageClasses: map[string]UsageThreshold{"fast": {Critical: 90}},
+	}
+	tests := []struct {
+		storageClass string
+		percent      float64
+		wantLevel    UsageLevel
+		wantReached  float64
+	}{
+		{"", 50, UsageLevelNormal, 0},
+		{"", 85, UsageLevelWarning, 85},
+		{"", 99, UsageLevelCritical, 95},
+		{"fast", 89, UsageLevelNormal, 0},
+		{"fast", 90, UsageLevelCritical, 90},
+	}
+	for _, tt := range tests {
+		level, reached := thresholds.ForStorageClass(tt.storageClass).Level(tt.percent)
+		assert.Equal(t, tt.wantLevel, level, "storage class %q at %v%%", tt.storageClass, tt.percent)
+		assert.Equal(t, tt.wantReached, reached, "storage class %q at %v%%", tt.storageClass, tt.percent)
+	}
+}
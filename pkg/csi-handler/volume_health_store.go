@@ -0,0 +1,192 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// VolumeHealthState is the health state of a volume as tracked by the checker
+type VolumeHealthState string
+
+const (
+	// VolumeHealthUnknown means the volume has not been checked since the monitor started
+	VolumeHealthUnknown VolumeHealthState = "Unknown"
+	// VolumeHealthHealthy means the volume was reported normal by the last check
+	VolumeHealthHealthy VolumeHealthState = "Healthy"
+	// VolumeHealthAbnormal means the volume was reported abnormal by the last check
+	VolumeHealthAbnormal VolumeHealthState = "Abnormal"
+	// VolumeHealthRecovered means the volume was reported normal right after being abnormal
+	VolumeHealthRecovered VolumeHealthState = "Recovered"
+)
+
+// VolumeHealthRecord is the last known health of a volume
+type VolumeHealthRecord struct {
+	VolumeHandle string
+	PVName       string
+	PVCNamespace string
+	PVCName      string
+
+	State   VolumeHealthState
+	Message string
+	// Reason and Severity describe the abnormal condition, they are empty while the volume is normal
+	Reason   string
+	Severity Severity
+
+	LastTransitionTime time.Time
+	LastCheckTime      time.Time
+
+	// AttachmentDrift describes the last detected attachment drift, empty if there is none
+	AttachmentDrift string
+}
+
+// VolumeHealthTransition describes how a check result changed the state of a volume
+type VolumeHealthTransition struct {
+	Previous VolumeHealthState
+	Current  VolumeHealthState
+	// MessageChanged is set when the volume stays abnormal but the driver reports a different message or reason
+	MessageChanged bool
+}
+
+// Changed returns true if the state of the volume changed
+func (t VolumeHealthTransition) Changed() bool {
+	return t.Previous != t.Current
+}
+
+// VolumeHealthStore stores the health state of volumes, keyed by volume handle
+type VolumeHealthStore struct {
+	sync.RWMutex
+
+	records map[string]*VolumeHealthRecord
+}
+
+// NewVolumeHealthStore creates a new VolumeHealthStore
+func NewVolumeHealthStore() *VolumeHealthStore {
+	return &VolumeHealthStore{
+		records: make(map[string]*VolumeHealthRecord),
+	}
+}
+
+// Record updates the state of the volume with the result of a check and returns the transition.
+//
+// The state machine is:
+//
+//	Unknown/Healthy/Recovered --abnormal--> Abnormal
+//	Abnormal --normal--> Recovered --normal--> Healthy
+//	Unknown --normal--> Healthy
+func (store *VolumeHealthStore) Record(volumeHandle, pvName, pvcNamespace, pvcName string, volumeCondition *VolumeConditionResult) VolumeHealthTransition {
+	store.Lock()
+	defer store.Unlock()
+
+	now := time.Now()
+	record, ok := store.records[volumeHandle]
+	if !ok {
+		record = &VolumeHealthRecord{
+			VolumeHandle: volumeHandle,
+			State:        VolumeHealthUnknown,
+		}
+		store.records[volumeHandle] = record
+	}
+
+	message := volumeCondition.GetMessage()
+	reason := ""
+	if volumeCondition.GetAbnormal() {
+		reason = abnormalReason(volumeCondition)
+	}
+
+	transition := VolumeHealthTransition{Previous: record.State}
+	switch {
+	case volumeCondition.GetAbnormal():
+		transition.Current = VolumeHealthAbnormal
+		transition.MessageChanged = record.State == VolumeHealthAbnormal && (record.Message != message || record.Reason != reason)
+	case record.State == VolumeHealthAbnormal:
+		transition.Current = VolumeHealthRecovered
+	default:
+		transition.Current = VolumeHealthHealthy
+	}
+
+	record.PVName = pvName
+	record.PVCNamespace = pvcNamespace
+	record.PVCName = pvcName
+	record.State = transition.Current
+	record.Message = message
+	record.Reason = reason
+	record.Severity = volumeCondition.GetSeverity()
+	record.LastCheckTime = now
+	if transition.Changed() || transition.MessageChanged {
+		record.LastTransitionTime = now
+	}
+
+	return transition
+}
+
+// RecordAttachmentDrift updates the attachment drift of the volume and returns the previous
+// drift and whether it changed
+func (store *VolumeHealthStore) RecordAttachmentDrift(volumeHandle, drift string) (string, bool) {
+	store.Lock()
+	defer store.Unlock()
+
+	record, ok := store.records[volumeHandle]
+	if !ok {
+		record = &VolumeHealthRecord{
+			VolumeHandle: volumeHandle,
+			State:        VolumeHealthUnknown,
+		}
+		store.records[volumeHandle] = record
+	}
+
+	previous := record.AttachmentDrift
+	record.AttachmentDrift = drift
+	return previous, previous != drift
+}
+
+// Get returns a copy of the record of the volume
+func (store *VolumeHealthStore) Get(volumeHandle string) (VolumeHealthRecord, bool) {
+	store.RLock()
+	defer store.RUnlock()
+
+	record, ok := store.records[volumeHandle]
+	if !ok {
+		return VolumeHealthRecord{}, false
+	}
+	return *record, true
+}
+
+// Delete forgets the volume, its next check starts from Unknown again
+func (store *VolumeHealthStore) Delete(volumeHandle string) {
+	store.Lock()
+	defer store.Unlock()
+
+	delete(store.records, volumeHandle)
+}
+
+// List returns copies of all records sorted by volume handle
+func (store *VolumeHealthStore) List() []VolumeHealthRecord {
+	store.RLock()
+	defer store.RUnlock()
+
+	records := make([]VolumeHealthRecord, 0, len(store.records))
+	for _, record := range store.records {
+		records = append(records, *record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].VolumeHandle < records[j].VolumeHandle
+	})
+	return records
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csi_handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeHealthStore_Record(t *testing.T) {
+	type check struct {
+		abnormal           bool
+		message            string
+		reason             string
+		wantPrevious       VolumeHealthState
+		wantCurrent        VolumeHealthState
+		wantMessageChanged bool
+	}
+	tests := []struct {
+		name   string
+		checks []check
+	}{
+		{
+			name: "healthy volume",
+			checks: []check{
+				{wantPrevious: VolumeHealthUnknown, wantCurrent: VolumeHealthHealthy},
+				{wantPrevious: VolumeHealthHealthy, wantCurrent: VolumeHealthHealthy},
+			},
+		},
+		{
+			name: "abnormal and recovered volume",
+			checks: []check{
+				{wantPrevious: VolumeHealthUnknown, wantCurrent: VolumeHealthHealthy},
+				{abnormal: true, message: "degraded", wantPrevious: VolumeHealthHealthy, wantCurrent: VolumeHealthAbnormal},
+				{abnormal: true, message: "degraded", wantPrevious: VolumeHealthAbnormal, wantCurrent: VolumeHealthAbnormal},
+				{abnormal: true, message: "replica lost", wantPrevious: VolumeHealthAbnormal, wantCurrent: VolumeHealthAbnormal, wantMessageChanged: true},
+				{wantPrevious: VolumeHealthAbnormal, wantCurrent: VolumeHealthRecovered},
+				{wantPrevious: VolumeHealthRecovered, wantCurrent: VolumeHealthHealthy},
+			},
+		},
+		{
+			name: "abnormal reason changed",
+			checks: []check{
+				{abnormal: true, message: "degraded", wantPrevious: VolumeHealthUnknown, wantCurrent: VolumeHealthAbnormal},
+				{abnormal: true, message: "degraded", reason: "DiskDegraded", wantPrevious: VolumeHealthAbnormal, wantCurrent: VolumeHealthAbnormal, wantMessageChanged: true},
+			},
+		},
+		{
+			name: "volume abnormal again after recovery",
+			checks: []check{
+				{abnormal: true, message: "degraded", wantPrevious: VolumeHealthUnknown, wantCurrent: VolumeHealthAbnormal},
+				{wantPrevious: VolumeHealthAbnormal, wantCurrent: VolumeHealthRecovered},
+				{abnormal: true, message: "degraded", wantPrevious: VolumeHealthRecovered, wantCurrent: VolumeHealthAbnormal},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			store := NewVolumeHealthStore()
+			for i, c := range tt.checks {
+				transition := store.Record("handle", "pv", "ns", "pvc", &VolumeConditionResult{abnormal: c.abnormal, message: c.message, reason: c.reason})
+				assert.Equal(c.wantPrevious, transition.Previous, "check %d", i)
+				assert.Equal(c.wantCurrent, transition.Current, "check %d", i)
+				assert.Equal(c.wantMessageChanged, transition.MessageChanged, "check %d", i)
+			}
+		})
+	}
+}
+
+func TestVolumeHealthStore_GetDeleteList(t *testing.T) {
+	assert := assert.New(t)
+	store := NewVolumeHealthStore()
+
+	_, ok := store.Get("b")
+	assert.False(ok)
+
+	store.Record("b", "pv-b", "ns", "pvc-b", &VolumeConditionResult{abnormal: true, message: "degraded", reason: "DiskDegraded", severity: SeverityWarning})
+	store.Record("a", "pv-a", "ns", "pvc-a", &VolumeConditionResult{})
+
+	record, ok := store.Get("b")
+	assert.True(ok)
+	assert.Equal(VolumeHealthAbnormal, record.State)
+	assert.Equal("pv-b", record.PVName)
+	assert.Equal("degraded", record.Message)
+	assert.Equal("DiskDegraded", record.Reason)
+	assert.Equal(SeverityWarning, record.Severity)
+	assert.False(record.LastCheckTime.IsZero())
+
+	records := store.List()
+	assert.Len(records, 2)
+	assert.Equal("a", records[0].VolumeHandle)
+	assert.Equal("b", records[1].VolumeHandle)
+
+	store.Delete("b")
+	_, ok = store.Get("b")
+	assert.False(ok)
+	transition := store.Record("b", "pv-b", "ns", "pvc-b", &VolumeConditionResult{abnormal: true, message: "degraded", reason: "DiskDegraded", severity: SeverityWarning})
+	assert.Equal(VolumeHealthUnknown, transition.Previous)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilcache "k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	authorizationclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// authorizationCacheSize is the maximum number of cached SubjectAccessReview results
+const authorizationCacheSize = 1024
+
+// subjectAccessReviewAuthorizer delegates the authorization of requests to the API server
+type subjectAccessReviewAuthorizer struct {
+	client  authorizationclient.SubjectAccessReviewInterface
+	timeout time.Duration
+
+	// cache stores the decisions by the JSON of the SubjectAccessReview spec for cacheTTL,
+	// so that e.g. every scrape of the metrics does not create a SubjectAccessReview
+	cache    *utilcache.LRUExpireCache
+	cacheTTL time.Duration
+}
+
+// authorizationDecision is a cached result of a SubjectAccessReview
+type authorizationDecision struct {
+	decision authorizer.Decision
+	reason   string
+}
+
+var _ authorizer.Authorizer = &subjectAccessReviewAuthorizer{}
+
+func newSubjectAccessReviewAuthorizer(client authorizationclient.SubjectAccessReviewInterface, timeout, cacheTTL time.Duration) *subjectAccessReviewAuthorizer {
+	return &subjectAccessReviewAuthorizer{
+		client:   client,
+		timeout:  timeout,
+		cache:    utilcache.NewLRUExpireCache(authorizationCacheSize),
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Authorize creates a SubjectAccessReview for the user and the path or resource of the request,
+// unless the decision for them is cached
+func (a *subjectAccessReviewAuthorizer) Authorize(ctx context.Context, attributes authorizer.Attributes) (authorizer.Decision, string, error) {
+	sar := &authorizationv1.SubjectAccessReview{}
+	if user := attributes.GetUser(); user != nil {
+		sar.Spec.User = user.GetName()
+		sar.Spec.UID = user.GetUID()
+		sar.Spec.Groups = user.GetGroups()
+		if extra := user.GetExtra(); len(extra) > 0 {
+			sar.Spec.Extra = make(map[string]authorizationv1.ExtraValue, len(extra))
+			for key, values := range extra {
+				sar.Spec.Extra[key] = values
+			}
+		}
+	}
+	if attributes.IsResourceRequest() {
+		sar.Spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+			Namespace:   attributes.GetNamespace(),
+			Verb:        attributes.GetVerb(),
+			Group:       attributes.GetAPIGroup(),
+			Version:     attributes.GetAPIVersion(),
+			Resource:    attributes.GetResource(),
+			Subresource: attributes.GetSubresource(),
+			Name:        attributes.GetName(),
+		}
+	} else {
+		sar.Spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{
+			Path: attributes.GetPath(),
+			Verb: attributes.GetVerb(),
+		}
+	}
+
+	key, err := json.Marshal(sar.Spec)
+	if err != nil {
+		return authorizer.DecisionNoOpinion, "", err
+	}
+	if cached, ok := a.cache.Get(string(key)); ok {
+		decision := cached.(authorizationDecision)
+		return decision.decision, decision.reason, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+	result, err := a.client.Create(ctx, sar, metav1.CreateOptions{})
+	if err != nil {
+		// errors are not cached, the next request creates a SubjectAccessReview again
+		return authorizer.DecisionNoOpinion, "", err
+	}
+
+	decision := authorizationDecision{decision: authorizer.DecisionNoOpinion, reason: result.Status.Reason}
+	switch {
+	case result.Status.Allowed:
+		decision.decision = authorizer.DecisionAllow
+	case result.Status.Denied:
+		decision.decision = authorizer.DecisionDeny
+	}
+	a.cache.Add(string(key), decision, a.cacheTTL)
+	return decision.decision, decision.reason, nil
+}
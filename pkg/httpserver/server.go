@@ -0,0 +1,188 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/authenticatorfactory"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/filters"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	// authCacheTTL is the time the result of a TokenReview or SubjectAccessReview is cached
+	authCacheTTL = 10 * time.Second
+	// authTimeout is the timeout of a TokenReview or SubjectAccessReview
+	authTimeout = 10 * time.Second
+	// shutdownTimeout is the time open connections get to finish once the server is stopped
+	shutdownTimeout = 5 * time.Second
+)
+
+// authRetryBackoff is the backoff of retrying failed TokenReviews, the same as in kube-apiserver
+var authRetryBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   1.5,
+	Jitter:   0.2,
+	Steps:    5,
+}
+
+// Options configure how the HTTP endpoint is served
+type Options struct {
+	// CertFile and KeyFile enable TLS. The files are watched and the certificate is reloaded when they change.
+	CertFile string
+	KeyFile  string
+
+	// EnableAuth requires all requests except to /healthz to carry a bearer token of a user who is
+	// allowed to get the path. The token is verified with a TokenReview, the permission with a
+	// SubjectAccessReview.
+	EnableAuth bool
+	// Client is used for the TokenReviews and SubjectAccessReviews
+	Client kubernetes.Interface
+}
+
+// Server serves the HTTP endpoint of the health monitor, optionally over TLS and with delegated
+// authentication and authorization
+type Server struct {
+	server      *http.Server
+	servingCert *dynamiccertificates.DynamicCertKeyPairContent
+	certs       *dynamiccertificates.DynamicServingCertificateController
+}
+
+// New creates a Server which serves handler at addr. The certificate is loaded immediately, so
+// that a wrong configuration is reported before the server is started.
+func New(addr string, handler http.Handler, options Options) (*Server, error) {
+	if (options.CertFile == "") != (options.KeyFile == "") {
+		return nil, errors.New("both the certificate and the private key file must be set for TLS")
+	}
+
+	if options.EnableAuth {
+		if options.Client == nil {
+			return nil, errors.New("a client is required for authentication and authorization")
+		}
+		authn, err := newDelegatingAuthenticator(options.Client)
+		if err != nil {
+			return nil, err
+		}
+		handler = withAuth(handler, authn, newSubjectAccessReviewAuthorizer(options.Client.AuthorizationV1().SubjectAccessReviews(), authTimeout, authCacheTTL))
+	}
+
+	s := &Server{server: &http.Server{Addr: addr, Handler: handler}}
+	if options.CertFile == "" {
+		return s, nil
+	}
+
+	servingCert, err := dynamiccertificates.NewDynamicServingContentFromFiles("serving-cert", options.CertFile, options.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the serving certificate: %v", err)
+	}
+	certs := dynamiccertificates.NewDynamicServingCertificateController(&tls.Config{MinVersion: tls.VersionTLS12}, nil, servingCert, nil, nil)
+	servingCert.AddListener(certs)
+	if err := certs.RunOnce(); err != nil {
+		return nil, fmt.Errorf("failed to load the serving certificate: %v", err)
+	}
+	s.servingCert = servingCert
+	s.certs = certs
+	s.server.TLSConfig = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: certs.GetConfigForClient,
+	}
+	return s, nil
+}
+
+// ListenAndServe listens at the address of the server and serves requests until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves requests on listener until ctx is cancelled
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		_ = s.server.Shutdown(shutdownCtx)
+	}()
+
+	var err error
+	if s.certs != nil {
+		go s.servingCert.Run(ctx, 1)
+		go s.certs.Run(1, ctx.Done())
+		err = s.server.ServeTLS(listener, "", "")
+	} else {
+		err = s.server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// newDelegatingAuthenticator returns an authenticator which verifies bearer tokens with TokenReviews
+func newDelegatingAuthenticator(client kubernetes.Interface) (authenticator.Request, error) {
+	authenticator, _, err := authenticatorfactory.DelegatingAuthenticatorConfig{
+		TokenAccessReviewClient:  client.AuthenticationV1(),
+		TokenAccessReviewTimeout: authTimeout,
+		WebhookRetryBackoff:      &authRetryBackoff,
+		CacheTTL:                 authCacheTTL,
+	}.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the authenticator: %v", err)
+	}
+	return authenticator, nil
+}
+
+// withAuth wraps handler with the authentication and authorization of all paths except /healthz
+func withAuth(handler http.Handler, authn authenticator.Request, authz authorizer.Authorizer) http.Handler {
+	protected := filters.WithAuthorization(handler, authz, scheme.Codecs)
+	protected = filters.WithAuthentication(protected, authn, filters.Unauthorized(scheme.Codecs), nil, nil)
+	protected = filters.WithRequestInfo(protected, &request.RequestInfoFactory{
+		APIPrefixes:          sets.NewString("api", "apis"),
+		GrouplessAPIPrefixes: sets.NewString("api"),
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isHealthz(r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
+// isHealthz returns true for the health checks, which are called by the kubelet without credentials
+func isHealthz(path string) bool {
+	return path == "/healthz" || strings.HasPrefix(path, "/healthz/")
+}
@@ -0,0 +1,164 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/request/bearertoken"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/client-go/kubernetes/fake"
+	core "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/cert"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenAuthenticator accepts the tokens "reader" and "intruder" as the users of the same name
+var tokenAuthenticator = bearertoken.New(authenticator.TokenFunc(func(_ context.Context, token string) (*authenticator.Response, bool, error) {
+	if token != "reader" && token != "intruder" {
+		return nil, false, nil
+	}
+	return &authenticator.Response{User: &user.DefaultInfo{Name: token}}, true, nil
+}))
+
+func newAuthClient() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "subjectaccessreviews", func(action core.Action) (bool, runtime.Object, error) {
+		sar := action.(core.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		sar.Status.Allowed = sar.Spec.User == "reader" &&
+			sar.Spec.NonResourceAttributes != nil &&
+			sar.Spec.NonResourceAttributes.Path == "/metrics" &&
+			sar.Spec.NonResourceAttributes.Verb == "get"
+		return true, sar, nil
+	})
+	return client
+}
+
+func TestServer_Auth(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {})
+	mux.HandleFunc("/healthz/driver", func(w http.ResponseWriter, _ *http.Request) {})
+
+	client := newAuthClient()
+	handler := withAuth(mux, tokenAuthenticator, newSubjectAccessReviewAuthorizer(client.AuthorizationV1().SubjectAccessReviews(), time.Second, time.Minute))
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		code  int
+	}{
+		{name: "healthz without token", path: "/healthz/driver", code: http.StatusOK},
+		{name: "metrics without token", path: "/metrics", code: http.StatusUnauthorized},
+		{name: "metrics with invalid token", path: "/metrics", token: "invalid", code: http.StatusUnauthorized},
+		{name: "metrics without permission", path: "/metrics", token: "intruder", code: http.StatusForbidden},
+		{name: "metrics with permission", path: "/metrics", token: "reader", code: http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.code, recorder.Code)
+		})
+	}
+
+	_, err := New(":0", mux, Options{EnableAuth: true})
+	assert.ErrorContains(t, err, "client is required")
+}
+
+func TestSubjectAccessReviewAuthorizer_Cache(t *testing.T) {
+	assert := assert.New(t)
+	client := newAuthClient()
+	authz := newSubjectAccessReviewAuthorizer(client.AuthorizationV1().SubjectAccessReviews(), time.Second, time.Minute)
+	reviews := func() int {
+		count := 0
+		for _, action := range client.Actions() {
+			if action.Matches("create", "subjectaccessreviews") {
+				count++
+			}
+		}
+		return count
+	}
+	attributes := func(name string) authorizer.Attributes {
+		return authorizer.AttributesRecord{User: &user.DefaultInfo{Name: name}, Verb: "get", Path: "/metrics"}
+	}
+
+	// allow and deny decisions are both cached by user and path
+	for i := 0; i < 2; i++ {
+		decision, _, err := authz.Authorize(context.Background(), attributes("reader"))
+		assert.Nil(err)
+		assert.Equal(authorizer.DecisionAllow, decision)
+		decision, _, err = authz.Authorize(context.Background(), attributes("intruder"))
+		assert.Nil(err)
+		assert.Equal(authorizer.DecisionNoOpinion, decision)
+	}
+	assert.Equal(2, reviews())
+
+	// errors are not cached
+	client.PrependReactor("create", "subjectaccessreviews", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("API server unavailable")
+	})
+	for i := 0; i < 2; i++ {
+		_, _, err := authz.Authorize(context.Background(), attributes("other"))
+		assert.Error(err)
+	}
+	assert.Equal(4, reviews())
+}
+
+func TestServer_TLS(t *testing.T) {
+	assert := assert.New(t)
+	certPEM, keyPEM, err := cert.GenerateSelfSignedCertKey("localhost", []net.IP{net.ParseIP("127.0.0.1")}, nil)
+	assert.Nil(err)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	assert.Nil(os.WriteFile(certFile, certPEM, 0600))
+	assert.Nil(os.WriteFile(keyFile, keyPEM, 0600))
+
+	_, err = New(":0", http.NewServeMux(), Options{CertFile: certFile})
+	assert.ErrorContains(err, "both the certificate and the private key file")
+	_, err = New(":0", http.NewServeMux(), Options{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")})
+	assert.NotNil(err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {})
+	s, err := New("127.0.0.1:0", mux, Options{CertFile: certFile, KeyFile: keyFile})
+	assert.Nil(err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(ctx, listener)
+	}()
+
+	pool := x509.NewCertPool()
+	assert.True(pool.AppendCertsFromPEM(certPEM))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: "localhost"}}}
+	rsp, err := client.Get("https://" + listener.Addr().String() + "/metrics")
+	assert.Nil(err)
+	if rsp != nil {
+		rsp.Body.Close()
+		assert.Equal(http.StatusOK, rsp.StatusCode)
+	}
+
+	cancel()
+	assert.Nil(<-done)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"time"
+
+	"k8s.io/component-base/metrics"
+)
+
+const (
+	metricsNamespace          = "csi"
+	volumeHealthSubsystem     = "volume_health"
+	nodeWatcherSubsystem      = "node_watcher"
+	driverHealthSubsystem     = "driver_health"
+	driverLabel               = "driver"
+	namespaceLabel            = "namespace"
+	pvcLabel                  = "pvc"
+	pvLabel                   = "pv"
+	storageClassLabel         = "storageclass"
+	methodLabel               = "method"
+	unitLabel                 = "unit"
+	reasonLabel               = "reason"
+	severityLabel             = "severity"
+	MethodListVolumes         = "ListVolumes"
+	MethodControllerGetVolume = "ControllerGetVolume"
+)
+
+var (
+	checkDurationBuckets = []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 15, 30, 60}
+)
+
+// Recorder records volume health and node watcher metrics.
+// All methods are safe to call on a nil Recorder, in which case nothing is recorded.
+type Recorder struct {
+	driverName string
+
+	volumeAbnormal       *metrics.GaugeVec
+	abnormalTransitions  *metrics.CounterVec
+	recoveredTransitions *metrics.CounterVec
+	checkDuration        *metrics.HistogramVec
+	volumesChecked       *metrics.GaugeVec
+	volumeUsage          *metrics.GaugeVec
+
+	brokenNodes   *metrics.GaugeVec
+	notReadyNodes *metrics.GaugeVec
+
+	driverUp            *metrics.GaugeVec
+	driverProbeFailures *metrics.GaugeVec
+}
+
+// NewRecorder creates the metrics of the given CSI driver, they must be registered before use
+func NewRecorder(driverName string) *Recorder {
+	return &Recorder{
+		driverName: driverName,
+		volumeAbnormal: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      volumeHealthSubsystem,
+				Name:           "abnormal",
+				Help:           "Whether the volume is reported abnormal (1) or normal (0) by the last health check.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel, namespaceLabel, pvcLabel, pvLabel, storageClassLabel},
+		),
+		abnormalTransitions: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      volumeHealthSubsystem,
+				Name:           "abnormal_transitions_total",
+				Help:           "Number of times a volume became abnormal, by abnormal reason and severity.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel, storageClassLabel, reasonLabel, severityLabel},
+		),
+		recoveredTransitions: metrics.NewCounterVec(
+			&metrics.CounterOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      volumeHealthSubsystem,
+				Name:           "recovered_transitions_total",
+				Help:           "Number of times an abnormal volume recovered.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel, storageClassLabel},
+		),
+		checkDuration: metrics.NewHistogramVec(
+			&metrics.HistogramOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      volumeHealthSubsystem,
+				Name:           "check_duration_seconds",
+				Help:           "Latency of a ListVolumes check round or of a single ControllerGetVolume check.",
+				Buckets:        checkDurationBuckets,
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel, methodLabel},
+		),
+		volumesChecked: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      volumeHealthSubsystem,
+				Name:           "volumes_checked",
+				Help:           "Number of volumes checked in the last check round.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel, methodLabel},
+		),
+		volumeUsage: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      volumeHealthSubsystem,
+				Name:           "usage_ratio",
+				Help:           "Used fraction of the bytes or inodes of the volume, as reported by NodeGetVolumeStats.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel, namespaceLabel, pvcLabel, pvLabel, storageClassLabel, unitLabel},
+		),
+		brokenNodes: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      nodeWatcherSubsystem,
+				Name:           "broken_nodes",
+				Help:           "Number of nodes marked broken by the node watcher.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel},
+		),
+		notReadyNodes: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      nodeWatcherSubsystem,
+				Name:           "not_ready_nodes",
+				Help:           "Number of nodes which are not ready but not yet marked broken by the node watcher.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel},
+		),
+		driverUp: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      driverHealthSubsystem,
+				Name:           "up",
+				Help:           "Whether the CSI driver passes its probes (1) or is considered unavailable (0).",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel},
+		),
+		driverProbeFailures: metrics.NewGaugeVec(
+			&metrics.GaugeOpts{
+				Namespace:      metricsNamespace,
+				Subsystem:      driverHealthSubsystem,
+				Name:           "consecutive_probe_failures",
+				Help:           "Number of consecutive failed probes of the CSI driver.",
+				StabilityLevel: metrics.ALPHA,
+			},
+			[]string{driverLabel},
+		),
+	}
+}
+
+// Register registers all metrics to the given registry
+func (r *Recorder) Register(registry metrics.KubeRegistry) {
+	registry.MustRegister(
+		r.volumeAbnormal,
+		r.abnormalTransitions,
+		r.recoveredTransitions,
+		r.checkDuration,
+		r.volumesChecked,
+		r.volumeUsage,
+		r.brokenNodes,
+		r.notReadyNodes,
+		r.driverUp,
+		r.driverProbeFailures,
+	)
+}
+
+// SetVolumeHealth records the result of the last health check of a volume
+func (r *Recorder) SetVolumeHealth(namespace, pvc, pv, storageClass string, abnormal bool) {
+	if r == nil {
+		return
+	}
+	value := 0.0
+	if abnormal {
+		value = 1.0
+	}
+	r.volumeAbnormal.WithLabelValues(r.driverName, namespace, pvc, pv, storageClass).Set(value)
+}
+
+// DeleteVolumeHealth removes the health of a volume which is not monitored anymore
+func (r *Recorder) DeleteVolumeHealth(namespace, pvc, pv, storageClass string) {
+	if r == nil {
+		return
+	}
+	r.volumeAbnormal.DeleteLabelValues(r.driverName, namespace, pvc, pv, storageClass)
+}
+
+// RecordAbnormalTransition counts a volume becoming abnormal with the given reason and severity
+func (r *Recorder) RecordAbnormalTransition(storageClass, reason, severity string) {
+	if r == nil {
+		return
+	}
+	r.abnormalTransitions.WithLabelValues(r.driverName, storageClass, reason, severity).Inc()
+}
+
+// RecordRecoveredTransition counts an abnormal volume recovering
+func (r *Recorder) RecordRecoveredTransition(storageClass string) {
+	if r == nil {
+		return
+	}
+	r.recoveredTransitions.WithLabelValues(r.driverName, storageClass).Inc()
+}
+
+// ObserveCheckDuration records the latency of a check with the given method
+func (r *Recorder) ObserveCheckDuration(method string, duration time.Duration) {
+	if r == nil {
+		return
+	}
+	r.checkDuration.WithLabelValues(r.driverName, method).Observe(duration.Seconds())
+}
+
+// SetVolumesChecked records the number of volumes checked in the last round
+func (r *Recorder) SetVolumesChecked(method string, count int) {
+	if r == nil {
+		return
+	}
+	r.volumesChecked.WithLabelValues(r.driverName, method).Set(float64(count))
+}
+
+// SetVolumeUsage records the used fraction of the given unit, bytes or inodes, of a volume
+func (r *Recorder) SetVolumeUsage(namespace, pvc, pv, storageClass, unit string, ratio float64) {
+	if r == nil {
+		return
+	}
+	r.volumeUsage.WithLabelValues(r.driverName, namespace, pvc, pv, storageClass, unit).Set(ratio)
+}
+
+// DeleteVolumeUsage removes the usage of a volume which is not monitored anymore
+func (r *Recorder) DeleteVolumeUsage(namespace, pvc, pv, storageClass, unit string) {
+	if r == nil {
+		return
+	}
+	r.volumeUsage.DeleteLabelValues(r.driverName, namespace, pvc, pv, storageClass, unit)
+}
+
+// SetNodes records the number of broken and not ready nodes seen by the node watcher
+func (r *Recorder) SetNodes(broken, notReady int) {
+	if r == nil {
+		return
+	}
+	r.brokenNodes.WithLabelValues(r.driverName).Set(float64(broken))
+	r.notReadyNodes.WithLabelValues(r.driverName).Set(float64(notReady))
+}
+
+// SetDriverHealth records whether the CSI driver is healthy and its number of consecutive failed probes
+func (r *Recorder) SetDriverHealth(healthy bool, consecutiveFailures int) {
+	if r == nil {
+		return
+	}
+	value := 0.0
+	if healthy {
+		value = 1.0
+	}
+	r.driverUp.WithLabelValues(r.driverName).Set(value)
+	r.driverProbeFailures.WithLabelValues(r.driverName).Set(float64(consecutiveFailures))
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestRecorder(t *testing.T) {
+	registry := metrics.NewKubeRegistry()
+	recorder := NewRecorder("fake.csi.driver.io")
+	recorder.Register(registry)
+
+	recorder.SetVolumeHealth("ns", "pvc1", "pv1", "fast", true)
+	recorder.SetVolumeHealth("ns", "pvc2", "pv2", "fast", false)
+	recorder.SetVolumeHealth("ns", "pvc3", "pv3", "fast", true)
+	recorder.DeleteVolumeHealth("ns", "pvc3", "pv3", "fast")
+	recorder.RecordAbnormalTransition("fast", "VolumeConditionAbnormal", "warning")
+	recorder.RecordAbnormalTransition("fast", "VolumeConditionAbnormal", "warning")
+	recorder.RecordAbnormalTransition("fast", "ReplicaLost", "critical")
+	recorder.RecordRecoveredTransition("fast")
+	recorder.SetVolumesChecked(MethodListVolumes, 2)
+	recorder.SetVolumeUsage("ns", "pvc1", "pv1", "fast", "bytes", 0.5)
+	recorder.SetVolumeUsage("ns", "pvc1", "pv1", "fast", "inodes", 0.25)
+	recorder.DeleteVolumeUsage("ns", "pvc1", "pv1", "fast", "inodes")
+	recorder.SetNodes(1, 3)
+	recorder.SetDriverHealth(false, 4)
+
+	want := `
+# HELP csi_volume_health_abnormal [ALPHA] Whether the volume is reported abnormal (1) or normal (0) by the last health check.
+# TYPE csi_volume_health_abnormal gauge
+csi_volume_health_abnormal{driver="fake.csi.driver.io",namespace="ns",pv="pv1",pvc="pvc1",storageclass="fast"} 1
+csi_volume_health_abnormal{driver="fake.csi.driver.io",namespace="ns",pv="pv2",pvc="pvc2",storageclass="fast"} 0
+# HELP csi_volume_health_abnormal_transitions_total [ALPHA] Number of times a volume became abnormal, by abnormal reason and severity.
+# TYPE csi_volume_health_abnormal_transitions_total counter
+csi_volume_health_abnormal_transitions_total{driver="fake.csi.driver.io",reason="ReplicaLost",severity="critical",storageclass="fast"} 1
+csi_volume_health_abnormal_transitions_total{driver="fake.csi.driver.io",reason="VolumeConditionAbnormal",severity="warning",storageclass="fast"} 2
+# HELP csi_volume_health_recovered_transitions_total [ALPHA] Number of times an abnormal volume recovered.
+# TYPE csi_volume_health_recovered_transitions_total counter
+csi_volume_health_recovered_transitions_total{driver="fake.csi.driver.io",storageclass="fast"} 1
+# HELP csi_volume_health_volumes_checked [ALPHA] Number of volumes checked in the last check round.
+# TYPE csi_volume_health_volumes_checked gauge
+csi_volume_health_volumes_checked{driver="fake.csi.driver.io",method="ListVolumes"} 2
+# HELP csi_volume_health_usage_ratio [ALPHA] Used fraction of the bytes or inodes of the volume, as reported by NodeGetVolumeStats.
+# TYPE csi_volume_health_usage_ratio gauge
+csi_volume_health_usage_ratio{driver="fake.csi.driver.io",namespace="ns",pv="pv1",pvc="pvc1",storageclass="fast",unit="bytes"} 0.5
+# HELP csi_node_watcher_broken_nodes [ALPHA] Number of nodes marked broken by the node watcher.
+# TYPE csi_node_watcher_broken_nodes gauge
+csi_node_watcher_broken_nodes{driver="fake.csi.driver.io"} 1
+# HELP csi_node_watcher_not_ready_nodes [ALPHA] Number of nodes which are not ready but not yet marked broken by the node watcher.
+# TYPE csi_node_watcher_not_ready_nodes gauge
+csi_node_watcher_not_ready_nodes{driver="fake.csi.driver.io"} 3
+# HELP csi_driver_health_up [ALPHA] Whether the CSI driver passes its probes (1) or is considered unavailable (0).
+# TYPE csi_driver_health_up gauge
+csi_driver_health_up{driver="fake.csi.driver.io"} 0
+# HELP csi_driver_health_consecutive_probe_failures [ALPHA] Number of consecutive failed probes of the CSI driver.
+# TYPE csi_driver_health_consecutive_probe_failures gauge
+csi_driver_health_consecutive_probe_failures{driver="fake.csi.driver.io"} 4
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"csi_volume_health_abnormal",
+		"csi_volume_health_abnormal_transitions_total",
+		"csi_volume_health_recovered_transitions_total",
+		"csi_volume_health_volumes_checked",
+		"csi_volume_health_usage_ratio",
+		"csi_node_watcher_broken_nodes",
+		"csi_node_watcher_not_ready_nodes",
+		"csi_driver_health_up",
+		"csi_driver_health_consecutive_probe_failures",
+	); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNilRecorder(t *testing.T) {
+	var recorder *Recorder
+	recorder.SetVolumeHealth("ns", "pvc", "pv", "", true)
+	recorder.DeleteVolumeHealth("ns", "pvc", "pv", "")
+	recorder.RecordAbnormalTransition("", "", "")
+	recorder.RecordRecoveredTransition("")
+	recorder.ObserveCheckDuration(MethodControllerGetVolume, 0)
+	recorder.SetVolumesChecked(MethodControllerGetVolume, 0)
+	recorder.SetVolumeUsage("ns", "pvc", "pv", "", "bytes", 0)
+	recorder.DeleteVolumeUsage("ns", "pvc", "pv", "", "bytes")
+	recorder.SetNodes(0, 0)
+	recorder.SetDriverHealth(true, 0)
+}
@@ -1,5 +1,7 @@
 package util
 
 var (
-	EnvNodeName = "NODE_NAME"
+	EnvNodeName     = "NODE_NAME"
+	EnvPodName      = "POD_NAME"
+	EnvPodNamespace = "POD_NAMESPACE"
 )
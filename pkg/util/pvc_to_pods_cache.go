@@ -17,66 +17,166 @@ limitations under the License.
 package util
 
 import (
-	"sync"
+	"fmt"
+	"sort"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	podPVCIndexerName        = "pod-pvc"
+	podNodeIndexerName       = "pod-node"
+	podInlineNodeIndexerName = "pod-inline-node"
 )
 
 // PodSet is a pod map, whose key is podname + "/" + podname
 type PodSet map[string]*v1.Pod
 
+// InlineVolume is a CSI inline volume of a pod
+type InlineVolume struct {
+	Pod *v1.Pod
+	// VolumeName is the name of the volume in the pod spec
+	VolumeName string
+	Driver     string
+}
+
 // PVCToPodsCache stores PVCs/Pods mapping info
-// we can get all pods using one specific PVC more efficiently by this
+// we can get all pods using one specific PVC more efficiently by this.
+// It indexes the store of the shared pod informer, so that pods are not cached twice
 type PVCToPodsCache struct {
-	sync.Mutex
+	pods cache.Indexer
+}
 
-	// caches pvc/pods mapping info, key is pvc namespace + pvc name
-	pvcToPodsMap map[string]PodSet
+// NewPVCToPodsCache adds the indexes of the cache to the shared pod informer, which must not have been started
+func NewPVCToPodsCache(podInformer cache.SharedIndexInformer) (*PVCToPodsCache, error) {
+	err := podInformer.AddIndexers(cache.Indexers{
+		podPVCIndexerName:        podPVCIndexFunc,
+		podNodeIndexerName:       podNodeIndexFunc,
+		podInlineNodeIndexerName: podInlineNodeIndexFunc,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add pod indexers: %v", err)
+	}
+	return &PVCToPodsCache{pods: podInformer.GetIndexer()}, nil
 }
 
-// NewPVCToPodsCache creates a new PVCToPodsCache
-func NewPVCToPodsCache() *PVCToPodsCache {
-	return &PVCToPodsCache{
-		pvcToPodsMap: make(map[string]PodSet),
+// podPVCIndexFunc indexes pods by the namespace + name of the PVCs they use, terminated pods are not indexed
+// by any index because they do not use their volumes anymore
+func podPVCIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || IsPodTerminated(pod) {
+		return nil, nil
+	}
+	var keys []string
+	for _, pvcName := range GetPodPVCNames(pod) {
+		keys = append(keys, pod.Namespace+"/"+pvcName)
 	}
+	return keys, nil
 }
 
-// TODO: support inline csi volumes
-func (cache *PVCToPodsCache) AddPod(pod *v1.Pod) {
-	cache.Lock()
-	defer cache.Unlock()
+// podNodeIndexFunc indexes pods using PVCs by node name
+func podNodeIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || IsPodTerminated(pod) || pod.Spec.NodeName == "" || len(GetPodPVCNames(pod)) == 0 {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
 
+// podInlineNodeIndexFunc indexes pods using CSI inline volumes by driver name + node name
+func podInlineNodeIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || IsPodTerminated(pod) || pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+	var keys []string
 	for _, volume := range pod.Spec.Volumes {
-		if volume.PersistentVolumeClaim != nil {
-			if cache.pvcToPodsMap[pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName] == nil {
-				cache.pvcToPodsMap[pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName] = make(PodSet)
-			}
-			cache.pvcToPodsMap[pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName][pod.Namespace+"/"+pod.Name] = pod
+		if volume.CSI != nil {
+			keys = append(keys, volume.CSI.Driver+"/"+pod.Spec.NodeName)
 		}
 	}
+	return keys, nil
 }
 
-// TODO: support inline csi volumes
-func (cache *PVCToPodsCache) DeletePod(pod *v1.Pod) {
-	cache.Lock()
-	defer cache.Unlock()
+// GetPodVolumePVCName returns the name of the PVC used by the pod volume, including the PVC of
+// a generic ephemeral volume, which is named <pod name>-<volume name>. It returns "" if the volume does not use a PVC
+func GetPodVolumePVCName(pod *v1.Pod, volume *v1.Volume) string {
+	switch {
+	case volume.PersistentVolumeClaim != nil:
+		return volume.PersistentVolumeClaim.ClaimName
+	case volume.Ephemeral != nil:
+		return pod.Name + "-" + volume.Name
+	}
+	return ""
+}
 
-	for _, volume := range pod.Spec.Volumes {
-		if volume.PersistentVolumeClaim != nil {
-			if cache.pvcToPodsMap[pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName] == nil {
-				return
-			}
-			delete(cache.pvcToPodsMap[pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName], pod.Namespace+"/"+pod.Name)
-			if len(cache.pvcToPodsMap[pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName]) == 0 {
-				delete(cache.pvcToPodsMap, pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName)
-			}
+// GetPodPVCNames returns the names of the PVCs used by the pod
+func GetPodPVCNames(pod *v1.Pod) []string {
+	var pvcNames []string
+	for i := range pod.Spec.Volumes {
+		if pvcName := GetPodVolumePVCName(pod, &pod.Spec.Volumes[i]); pvcName != "" {
+			pvcNames = append(pvcNames, pvcName)
 		}
 	}
+	return pvcNames
+}
+
+// IsPodTerminated returns true if all containers of the pod terminated and will not be restarted,
+// its volumes are not used anymore
+func IsPodTerminated(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+// byIndex returns the pods of the index key, or nil if there are none
+func (cache *PVCToPodsCache) byIndex(indexName, key string) []*v1.Pod {
+	objs, err := cache.pods.ByIndex(indexName, key)
+	if err != nil {
+		return nil
+	}
+	pods := make([]*v1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		pods = append(pods, obj.(*v1.Pod))
+	}
+	return pods
+}
+
+func toPodSet(pods []*v1.Pod) PodSet {
+	if len(pods) == 0 {
+		return nil
+	}
+	podSet := make(PodSet, len(pods))
+	for _, pod := range pods {
+		podSet[pod.Namespace+"/"+pod.Name] = pod
+	}
+	return podSet
 }
 
 func (cache *PVCToPodsCache) GetPodsByPVC(pvcNamespace, pvcName string) PodSet {
-	cache.Lock()
-	defer cache.Unlock()
+	return toPodSet(cache.byIndex(podPVCIndexerName, pvcNamespace+"/"+pvcName))
+}
+
+// GetPodsByNode returns the pods using PVCs on the node
+func (cache *PVCToPodsCache) GetPodsByNode(nodeName string) PodSet {
+	return toPodSet(cache.byIndex(podNodeIndexerName, nodeName))
+}
 
-	return cache.pvcToPodsMap[pvcNamespace+"/"+pvcName]
+// GetInlineVolumesByNode returns the CSI inline volumes of the driver used by pods on the node,
+// sorted by pod and volume name
+func (cache *PVCToPodsCache) GetInlineVolumesByNode(driverName, nodeName string) []InlineVolume {
+	var inlineVolumes []InlineVolume
+	for _, pod := range cache.byIndex(podInlineNodeIndexerName, driverName+"/"+nodeName) {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.CSI != nil && volume.CSI.Driver == driverName {
+				inlineVolumes = append(inlineVolumes, InlineVolume{Pod: pod, VolumeName: volume.Name, Driver: driverName})
+			}
+		}
+	}
+	sort.Slice(inlineVolumes, func(i, j int) bool {
+		if inlineVolumes[i].Pod.Name != inlineVolumes[j].Pod.Name {
+			return inlineVolumes[i].Pod.Name < inlineVolumes[j].Pod.Name
+		}
+		return inlineVolumes[i].VolumeName < inlineVolumes[j].VolumeName
+	})
+	return inlineVolumes
 }
@@ -6,11 +6,24 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 )
 
+// newTestPVCToPodsCache returns a PVCToPodsCache on a pod informer which is not started, the
+// tests add pods to its store like the informer would
+func newTestPVCToPodsCache(t *testing.T) (*PVCToPodsCache, cache.Store) {
+	podInformer := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0).Core().V1().Pods().Informer()
+	podsCache, err := NewPVCToPodsCache(podInformer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return podsCache, podInformer.GetStore()
+}
+
 var (
-	pvcToPodsCache = NewPVCToPodsCache()
-	pod1           = &v1.Pod{
+	pod1 = &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: "test",
 			Name:      "pod1",
@@ -30,6 +43,7 @@ var (
 )
 
 func TestPVCToPodsCache_AddPod(t *testing.T) {
+	pvcToPodsCache, store := newTestPVCToPodsCache(t)
 	type args struct {
 		pod *v1.Pod
 	}
@@ -52,7 +66,9 @@ func TestPVCToPodsCache_AddPod(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			pvcToPodsCache.AddPod(tt.args.pod)
+			if err := store.Add(tt.args.pod); err != nil {
+				t.Fatal(err)
+			}
 			got := pvcToPodsCache.GetPodsByPVC(pod1.Namespace, tt.pvcName)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("PVCToPodCache.AddPod() = %v, want %v", got, tt.want)
@@ -62,6 +78,10 @@ func TestPVCToPodsCache_AddPod(t *testing.T) {
 }
 
 func TestPVCToPodsCache_DeletePod(t *testing.T) {
+	pvcToPodsCache, store := newTestPVCToPodsCache(t)
+	if err := store.Add(pod1); err != nil {
+		t.Fatal(err)
+	}
 	type args struct {
 		pod *v1.Pod
 	}
@@ -84,7 +104,9 @@ func TestPVCToPodsCache_DeletePod(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			pvcToPodsCache.DeletePod(tt.args.pod)
+			if err := store.Delete(tt.args.pod); err != nil {
+				t.Fatal(err)
+			}
 			got := pvcToPodsCache.GetPodsByPVC(pod1.Namespace, tt.pvcName)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("PVCToPodCache.DeletePod() = %v, want %v", got, tt.want)
@@ -92,3 +114,122 @@ func TestPVCToPodsCache_DeletePod(t *testing.T) {
 		})
 	}
 }
+
+func TestPVCToPodsCache_GetPodsByNode(t *testing.T) {
+	podsCache, store := newTestPVCToPodsCache(t)
+	scheduled := pod1.DeepCopy()
+	scheduled.Spec.NodeName = "node1"
+	if err := store.Add(scheduled); err != nil {
+		t.Errorf("failed to add pod: %v", err)
+	}
+
+	want := PodSet{scheduled.Namespace + "/" + scheduled.Name: scheduled}
+	if got := podsCache.GetPodsByNode("node1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("PVCToPodCache.GetPodsByNode() = %v, want %v", got, want)
+	}
+
+	if err := store.Delete(scheduled); err != nil {
+		t.Errorf("failed to delete pod: %v", err)
+	}
+	if got := podsCache.GetPodsByNode("node1"); got != nil {
+		t.Errorf("PVCToPodCache.GetPodsByNode() after deleting the pod = %v, want nil", got)
+	}
+}
+
+func TestPVCToPodsCache_EphemeralAndInlineVolumes(t *testing.T) {
+	podsCache, store := newTestPVCToPodsCache(t)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "test",
+			Name:      "pod2",
+		},
+		Spec: v1.PodSpec{
+			NodeName: "node1",
+			Volumes: []v1.Volume{
+				{
+					Name: "scratch",
+					VolumeSource: v1.VolumeSource{
+						Ephemeral: &v1.EphemeralVolumeSource{},
+					},
+				},
+				{
+					Name: "inline",
+					VolumeSource: v1.VolumeSource{
+						CSI: &v1.CSIVolumeSource{Driver: "fake.csi.driver.io"},
+					},
+				},
+				{
+					Name: "other",
+					VolumeSource: v1.VolumeSource{
+						CSI: &v1.CSIVolumeSource{Driver: "other.csi.driver.io"},
+					},
+				},
+			},
+		},
+	}
+	if err := store.Add(pod); err != nil {
+		t.Errorf("failed to add pod: %v", err)
+	}
+
+	wantPods := PodSet{pod.Namespace + "/" + pod.Name: pod}
+	if got := podsCache.GetPodsByPVC(pod.Namespace, "pod2-scratch"); !reflect.DeepEqual(got, wantPods) {
+		t.Errorf("PVCToPodCache.GetPodsByPVC() = %v, want %v", got, wantPods)
+	}
+	wantInlineVolumes := []InlineVolume{{Pod: pod, VolumeName: "inline", Driver: "fake.csi.driver.io"}}
+	if got := podsCache.GetInlineVolumesByNode("fake.csi.driver.io", "node1"); !reflect.DeepEqual(got, wantInlineVolumes) {
+		t.Errorf("PVCToPodCache.GetInlineVolumesByNode() = %v, want %v", got, wantInlineVolumes)
+	}
+
+	if err := store.Delete(pod); err != nil {
+		t.Errorf("failed to delete pod: %v", err)
+	}
+	if got := podsCache.GetPodsByPVC(pod.Namespace, "pod2-scratch"); got != nil {
+		t.Errorf("PVCToPodCache.GetPodsByPVC() after deleting the pod = %v, want nil", got)
+	}
+	if got := podsCache.GetInlineVolumesByNode("fake.csi.driver.io", "node1"); got != nil {
+		t.Errorf("PVCToPodCache.GetInlineVolumesByNode() after deleting the pod = %v, want nil", got)
+	}
+}
+
+func TestPVCToPodsCache_UpdatePod(t *testing.T) {
+	podsCache, store := newTestPVCToPodsCache(t)
+	pending := pod1.DeepCopy()
+	if err := store.Add(pending); err != nil {
+		t.Errorf("failed to add pod: %v", err)
+	}
+	if got := podsCache.GetPodsByNode("node1"); got != nil {
+		t.Errorf("PVCToPodCache.GetPodsByNode() of pending pod = %v, want nil", got)
+	}
+
+	// the pod is bound to a node and uses another PVC
+	scheduled := pending.DeepCopy()
+	scheduled.Spec.NodeName = "node1"
+	scheduled.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = "pvc2"
+	if err := store.Update(scheduled); err != nil {
+		t.Errorf("failed to update pod: %v", err)
+	}
+
+	want := PodSet{scheduled.Namespace + "/" + scheduled.Name: scheduled}
+	if got := podsCache.GetPodsByNode("node1"); !reflect.DeepEqual(got, want) {
+		t.Errorf("PVCToPodCache.GetPodsByNode() = %v, want %v", got, want)
+	}
+	if got := podsCache.GetPodsByPVC(scheduled.Namespace, "pvc2"); !reflect.DeepEqual(got, want) {
+		t.Errorf("PVCToPodCache.GetPodsByPVC() = %v, want %v", got, want)
+	}
+	if got := podsCache.GetPodsByPVC(scheduled.Namespace, "pvc1"); got != nil {
+		t.Errorf("PVCToPodCache.GetPodsByPVC() of previous PVC = %v, want nil", got)
+	}
+
+	// terminated pods do not use their volumes anymore
+	terminated := scheduled.DeepCopy()
+	terminated.Status.Phase = v1.PodSucceeded
+	if err := store.Update(terminated); err != nil {
+		t.Errorf("failed to update pod: %v", err)
+	}
+	if got := podsCache.GetPodsByNode("node1"); got != nil {
+		t.Errorf("PVCToPodCache.GetPodsByNode() of terminated pod = %v, want nil", got)
+	}
+	if got := podsCache.GetPodsByPVC(terminated.Namespace, "pvc2"); got != nil {
+		t.Errorf("PVCToPodCache.GetPodsByPVC() of terminated pod = %v, want nil", got)
+	}
+}
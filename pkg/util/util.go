@@ -17,12 +17,19 @@ limitations under the License.
 package util
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"path"
 	"path/filepath"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes"
 )
 
 const (
@@ -35,7 +42,12 @@ const (
 	DefaultKubeletVolumesDirName      = "volumes"
 	DefaultKubeletBlockVolumesDirName = "volumeDevices"
 	DefaultEventIndexerName           = "event-uid"
+	VolumeAttachmentPVIndexerName     = "volumeattachment-pv"
+	VolumeAttachmentNodeIndexerName   = "volumeattachment-node"
 	DefaultRecoveryEventMessage       = "The Volume returns to the healthy state"
+
+	// VolumeHealthyCondition is the PVC status condition maintained by the health monitor
+	VolumeHealthyCondition v1.PersistentVolumeClaimConditionType = "VolumeHealthy"
 )
 
 // MakeDeviceMountPath generates device mount path
@@ -71,3 +83,49 @@ func GetVolumePath(kubeletRootDir, pvName, podUID string, isBlock bool) string {
 func EscapeQualifiedName(in string) string {
 	return strings.Replace(in, "/", "~", -1)
 }
+
+// PatchPVCStatus patches the status of oldPVC to match newPVC by a strategic merge patch
+func PatchPVCStatus(ctx context.Context, client kubernetes.Interface, oldPVC, newPVC *v1.PersistentVolumeClaim) (*v1.PersistentVolumeClaim, error) {
+	oldData, err := json.Marshal(oldPVC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal old PVC %s/%s: %v", oldPVC.Namespace, oldPVC.Name, err)
+	}
+	newData, err := json.Marshal(newPVC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal new PVC %s/%s: %v", newPVC.Namespace, newPVC.Name, err)
+	}
+	patchBytes, err := strategicpatch.CreateTwoWayMergePatch(oldData, newData, oldPVC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create patch for PVC %s/%s: %v", oldPVC.Namespace, oldPVC.Name, err)
+	}
+
+	return client.CoreV1().PersistentVolumeClaims(oldPVC.Namespace).Patch(ctx, oldPVC.Name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{}, "status")
+}
+
+// GetPVCCondition returns the condition of the given type from the PVC status, or nil if it is not set
+func GetPVCCondition(pvc *v1.PersistentVolumeClaim, conditionType v1.PersistentVolumeClaimConditionType) *v1.PersistentVolumeClaimCondition {
+	for i := range pvc.Status.Conditions {
+		if pvc.Status.Conditions[i].Type == conditionType {
+			return &pvc.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// VolumeAttachmentPVIndexFunc indexes VolumeAttachments by the name of their PV
+func VolumeAttachmentPVIndexFunc(obj interface{}) ([]string, error) {
+	va, ok := obj.(*storagev1.VolumeAttachment)
+	if !ok || va.Spec.Source.PersistentVolumeName == nil {
+		return nil, nil
+	}
+	return []string{*va.Spec.Source.PersistentVolumeName}, nil
+}
+
+// VolumeAttachmentNodeIndexFunc indexes VolumeAttachments by the name of their node
+func VolumeAttachmentNodeIndexFunc(obj interface{}) ([]string, error) {
+	va, ok := obj.(*storagev1.VolumeAttachment)
+	if !ok {
+		return nil, nil
+	}
+	return []string{va.Spec.NodeName}, nil
+}
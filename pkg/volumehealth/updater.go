@@ -0,0 +1,276 @@
+/*
+Copyright 2026 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumehealth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+
+	healthv1alpha1 "github.com/kubernetes-csi/external-health-monitor/pkg/apis/volumehealth/v1alpha1"
+)
+
+const (
+	// maxConflictRetries is the number of attempts of updating a VolumeHealth which was modified concurrently
+	maxConflictRetries = 3
+	// writeTimeout limits the reads and writes of one observation
+	writeTimeout = 10 * time.Second
+	// checkTimeRefreshInterval is the interval LastCheckTime and ConsecutiveFailures are written at
+	// while observations do not change the rest of the status
+	checkTimeRefreshInterval = 5 * time.Minute
+)
+
+// Observation is the health of a volume observed by one component of the health monitor
+type Observation struct {
+	Source  healthv1alpha1.VolumeHealthSource
+	State   healthv1alpha1.VolumeHealthState
+	Reason  string
+	Message string
+}
+
+// Updater maintains one VolumeHealth object per monitored PVC, it is owned by the PVC
+type Updater struct {
+	client dynamic.Interface
+	// lister serves the VolumeHealth objects, they are only read from the API server after a conflict
+	lister       cache.GenericLister
+	listerSynced cache.InformerSynced
+	// historyLimit is the maximum number of transitions kept in the status
+	historyLimit int
+	now          func() metav1.Time
+
+	// failures stores the consecutive abnormal observations of abnormal volumes by PVC UID, they
+	// are not written on every observation
+	failuresLock sync.Mutex
+	failures     map[types.UID]int32
+}
+
+// NewUpdater creates an Updater which keeps up to historyLimit transitions per volume. It reads
+// VolumeHealth objects through an informer of factory, which must be started by the caller.
+func NewUpdater(client dynamic.Interface, factory dynamicinformer.DynamicSharedInformerFactory, historyLimit int) *Updater {
+	informer := factory.ForResource(healthv1alpha1.Resource)
+	return &Updater{
+		client:       client,
+		lister:       informer.Lister(),
+		listerSynced: informer.Informer().HasSynced,
+		historyLimit: max(historyLimit, 0),
+		now:          metav1.Now,
+		failures:     make(map[types.UID]int32),
+	}
+}
+
+// HasSynced returns true once the VolumeHealth informer has synced. A nil Updater is always synced.
+func (updater *Updater) HasSynced() bool {
+	return updater == nil || updater.listerSynced()
+}
+
+// Record records the observation in the VolumeHealth of the PVC and creates it if necessary.
+// If the observation does not change the status, only the check time and the consecutive failures
+// are written, at most every checkTimeRefreshInterval. A nil Updater ignores it.
+func (updater *Updater) Record(ctx context.Context, pvc *v1.PersistentVolumeClaim, observation Observation) error {
+	if updater == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	var failures int32
+	var err error
+	for i := 0; i < maxConflictRetries; i++ {
+		// the cached object may be outdated after a conflict
+		failures, err = updater.record(ctx, pvc, observation, i == 0)
+		if !apierrs.IsConflict(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update VolumeHealth %s/%s: %v", pvc.Namespace, pvc.Name, err)
+	}
+	updater.setFailures(pvc.UID, failures)
+	return nil
+}
+
+// record applies the observation to the VolumeHealth of the PVC and returns the consecutive failures after it
+func (updater *Updater) record(ctx context.Context, pvc *v1.PersistentVolumeClaim, observation Observation, cached bool) (int32, error) {
+	client := updater.client.Resource(healthv1alpha1.Resource).Namespace(pvc.Namespace)
+
+	obj, err := updater.get(ctx, client, pvc.Namespace, pvc.Name, cached)
+	if apierrs.IsNotFound(err) {
+		obj, err = client.Create(ctx, newVolumeHealth(pvc), metav1.CreateOptions{})
+		if apierrs.IsAlreadyExists(err) {
+			obj, err = client.Get(ctx, pvc.Name, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	health := &healthv1alpha1.VolumeHealth{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), health); err != nil {
+		return 0, err
+	}
+	status := &health.Status
+	now := updater.now()
+	lastCheckTime := status.LastCheckTime
+	changed := applyObservation(status, observation, now, updater.historyLimit)
+
+	failures := int32(0)
+	if status.State == healthv1alpha1.VolumeHealthAbnormal {
+		failures = updater.getFailures(pvc.UID, status.ConsecutiveFailures) + 1
+	}
+	if !changed && lastCheckTime != nil && now.Sub(lastCheckTime.Time) < checkTimeRefreshInterval {
+		return failures, nil
+	}
+	status.LastCheckTime = &now
+	status.ConsecutiveFailures = failures
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(health)
+	if err != nil {
+		return 0, err
+	}
+	_, err = client.UpdateStatus(ctx, &unstructured.Unstructured{Object: content}, metav1.UpdateOptions{})
+	return failures, err
+}
+
+// getFailures returns the consecutive failures of the PVC before the current observation. They are
+// taken from the status if they are not known, e.g. after a restart.
+func (updater *Updater) getFailures(uid types.UID, written int32) int32 {
+	updater.failuresLock.Lock()
+	defer updater.failuresLock.Unlock()
+
+	if failures, ok := updater.failures[uid]; ok {
+		return failures
+	}
+	return written
+}
+
+// setFailures stores the consecutive failures of the PVC, only abnormal volumes are stored
+func (updater *Updater) setFailures(uid types.UID, failures int32) {
+	updater.failuresLock.Lock()
+	defer updater.failuresLock.Unlock()
+
+	if failures == 0 {
+		delete(updater.failures, uid)
+		return
+	}
+	updater.failures[uid] = failures
+}
+
+// get returns the VolumeHealth from the informer cache if cached is set, from the API server otherwise
+func (updater *Updater) get(ctx context.Context, client dynamic.ResourceInterface, namespace, name string, cached bool) (*unstructured.Unstructured, error) {
+	if !cached {
+		return client.Get(ctx, name, metav1.GetOptions{})
+	}
+
+	obj, err := updater.lister.ByNamespace(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	health, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object %T in the VolumeHealth cache", obj)
+	}
+	return health, nil
+}
+
+// newVolumeHealth returns an empty VolumeHealth of the PVC, which is deleted together with it
+func newVolumeHealth(pvc *v1.PersistentVolumeClaim) *unstructured.Unstructured {
+	health := &unstructured.Unstructured{}
+	health.SetAPIVersion(healthv1alpha1.SchemeGroupVersion.String())
+	health.SetKind("VolumeHealth")
+	health.SetNamespace(pvc.Namespace)
+	health.SetName(pvc.Name)
+	health.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: "v1",
+		Kind:       "PersistentVolumeClaim",
+		Name:       pvc.Name,
+		UID:        pvc.UID,
+		Controller: ptr.To(true),
+	}})
+	return health
+}
+
+// applyObservation updates the status with the observation and returns false if nothing changed.
+// The volume is abnormal as long as any source reports it abnormal, so that e.g. a healthy
+// controller check does not clear a node failure. A transition is added to the history when the
+// state or reason changes, the oldest transitions are dropped beyond historyLimit. LastCheckTime
+// and ConsecutiveFailures are left to the caller.
+func applyObservation(status *healthv1alpha1.VolumeHealthStatus, observation Observation, now metav1.Time, historyLimit int) bool {
+	source := findSource(status, observation.Source)
+	if source != nil && source.State == observation.State && source.Reason == observation.Reason && source.Message == observation.Message {
+		return false
+	}
+	if source == nil {
+		status.Sources = append(status.Sources, healthv1alpha1.VolumeHealthSourceStatus{Source: observation.Source})
+		source = &status.Sources[len(status.Sources)-1]
+	}
+	source.State = observation.State
+	source.Reason = observation.Reason
+	source.Message = observation.Message
+	source.LastTransitionTime = now
+
+	current := *source
+	if current.State != healthv1alpha1.VolumeHealthAbnormal {
+		for _, other := range status.Sources {
+			if other.State == healthv1alpha1.VolumeHealthAbnormal {
+				current = other
+				break
+			}
+		}
+	}
+
+	if status.State != current.State || status.Reason != current.Reason {
+		status.History = append(status.History, healthv1alpha1.VolumeHealthTransition{
+			Time:    now,
+			State:   current.State,
+			Reason:  current.Reason,
+			Message: current.Message,
+			Source:  current.Source,
+		})
+		if len(status.History) > historyLimit {
+			status.History = status.History[len(status.History)-historyLimit:]
+		}
+	}
+
+	status.State = current.State
+	status.Reason = current.Reason
+	status.Message = current.Message
+	status.Source = current.Source
+	return true
+}
+
+// findSource returns the last observation of the source in the status, or nil
+func findSource(status *healthv1alpha1.VolumeHealthStatus, source healthv1alpha1.VolumeHealthSource) *healthv1alpha1.VolumeHealthSourceStatus {
+	for i := range status.Sources {
+		if status.Sources[i].Source == source {
+			return &status.Sources[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package volumehealth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+
+	healthv1alpha1 "github.com/kubernetes-csi/external-health-monitor/pkg/apis/volumehealth/v1alpha1"
+	"github.com/kubernetes-csi/external-health-monitor/pkg/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func getVolumeHealth(t *testing.T, client *fake.FakeDynamicClient, namespace, name string) *healthv1alpha1.VolumeHealth {
+	obj, err := client.Resource(healthv1alpha1.Resource).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	health := &healthv1alpha1.VolumeHealth{}
+	assert.Nil(t, runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), health))
+	return health
+}
+
+// newTestUpdater returns an Updater with a started informer and a clock which advances by a minute per observation
+func newTestUpdater(t *testing.T, historyLimit int) (*Updater, *fake.FakeDynamicClient, *time.Time) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, healthv1alpha1.AddToScheme(scheme))
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(scheme, map[schema.GroupVersionResource]string{
+		healthv1alpha1.Resource: "VolumeHealthList",
+	})
+
+	factory := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	updater := NewUpdater(client, factory, historyLimit)
+	ctx, cancel := context.WithCancel(context.Background())
+	factory.Start(ctx.Done())
+	t.Cleanup(func() {
+		cancel()
+		factory.Shutdown()
+	})
+	assert.True(t, cache.WaitForCacheSync(ctx.Done(), updater.HasSynced))
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	updater.now = func() metav1.Time {
+		now = now.Add(time.Minute)
+		return metav1.NewTime(now)
+	}
+	return updater, client, &now
+}
+
+// record records the observation and waits until the informer has seen the result, so that the
+// next observation is compared with it
+func record(t *testing.T, updater *Updater, client *fake.FakeDynamicClient, pvc *v1.PersistentVolumeClaim, observation Observation) {
+	assert.Nil(t, updater.Record(context.Background(), pvc, observation))
+	obj, err := client.Resource(healthv1alpha1.Resource).Namespace(pvc.Namespace).Get(context.Background(), pvc.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		cached, err := updater.lister.ByNamespace(pvc.Namespace).Get(pvc.Name)
+		return err == nil && equality.Semantic.DeepEqual(cached.(*unstructured.Unstructured).UnstructuredContent(), obj.UnstructuredContent())
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func countUpdates(client *fake.FakeDynamicClient) int {
+	updates := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" && action.GetSubresource() == "status" {
+			updates++
+		}
+	}
+	return updates
+}
+
+func TestUpdater_Record(t *testing.T) {
+	assert := assert.New(t)
+	updater, client, now := newTestUpdater(t, 2)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+
+	healthy := Observation{Source: healthv1alpha1.VolumeHealthSourceControllerCheck, State: healthv1alpha1.VolumeHealthHealthy, Reason: "VolumeConditionNormal"}
+	abnormal := Observation{Source: healthv1alpha1.VolumeHealthSourceControllerCheck, State: healthv1alpha1.VolumeHealthAbnormal, Reason: "VolumeConditionAbnormal", Message: "Volume not found"}
+	otherMessage := Observation{Source: healthv1alpha1.VolumeHealthSourceControllerCheck, State: healthv1alpha1.VolumeHealthAbnormal, Reason: "VolumeConditionAbnormal", Message: "Volume is read-only"}
+
+	// the VolumeHealth is created for the PVC and owned by it
+	record(t, updater, client, pvc, healthy)
+	health := getVolumeHealth(t, client, mock.DefaultNS, "pvc")
+	assert.Len(health.OwnerReferences, 1)
+	assert.Equal(pvc.UID, health.OwnerReferences[0].UID)
+	assert.Equal(healthv1alpha1.VolumeHealthHealthy, health.Status.State)
+	assert.Len(health.Status.History, 1)
+
+	// repeated observations are only counted
+	record(t, updater, client, pvc, abnormal)
+	changed := *now
+	updates := countUpdates(client)
+	record(t, updater, client, pvc, abnormal)
+	assert.Equal(updates, countUpdates(client))
+	health = getVolumeHealth(t, client, mock.DefaultNS, "pvc")
+	assert.Equal(healthv1alpha1.VolumeHealthAbnormal, health.Status.State)
+	assert.Equal("Volume not found", health.Status.Message)
+	assert.Equal(int32(1), health.Status.ConsecutiveFailures)
+	assert.Equal(changed, health.Status.LastCheckTime.UTC())
+	assert.Len(health.Status.History, 2)
+
+	// a new message is written without a transition, together with the failures counted so far
+	record(t, updater, client, pvc, otherMessage)
+	changed = *now
+	health = getVolumeHealth(t, client, mock.DefaultNS, "pvc")
+	assert.Equal("Volume is read-only", health.Status.Message)
+	assert.Equal(int32(3), health.Status.ConsecutiveFailures)
+	assert.Equal(changed, health.Status.LastCheckTime.UTC())
+	assert.Len(health.Status.History, 2)
+
+	// the check time and the failures of repeated observations are written every checkTimeRefreshInterval
+	updates = countUpdates(client)
+	for i := 0; i < 5; i++ {
+		record(t, updater, client, pvc, otherMessage)
+	}
+	assert.Equal(updates+1, countUpdates(client))
+	health = getVolumeHealth(t, client, mock.DefaultNS, "pvc")
+	assert.Equal(int32(8), health.Status.ConsecutiveFailures)
+	assert.Equal(changed.Add(checkTimeRefreshInterval), health.Status.LastCheckTime.UTC())
+
+	// the failures are continued from the status after a restart
+	updater.failures = make(map[types.UID]int32)
+	record(t, updater, client, pvc, abnormal)
+	health = getVolumeHealth(t, client, mock.DefaultNS, "pvc")
+	assert.Equal(int32(9), health.Status.ConsecutiveFailures)
+
+	record(t, updater, client, pvc, healthy)
+	health = getVolumeHealth(t, client, mock.DefaultNS, "pvc")
+	assert.Equal(int32(0), health.Status.ConsecutiveFailures)
+	assert.Len(health.Status.History, 2)
+	assert.Equal(healthv1alpha1.VolumeHealthHealthy, health.Status.History[1].State)
+	assert.Empty(updater.failures)
+
+	var nilUpdater *Updater
+	assert.Nil(nilUpdater.Record(context.Background(), pvc, healthy))
+	assert.True(nilUpdater.HasSynced())
+}
+
+func TestUpdater_RecordSources(t *testing.T) {
+	assert := assert.New(t)
+	updater, client, _ := newTestUpdater(t, 10)
+	pvc := mock.CreatePVC(1, 2, "pvc", "pvcuid", mock.DefaultNS, "pv", v1.ClaimBound)
+
+	checkHealthy := Observation{Source: healthv1alpha1.VolumeHealthSourceControllerCheck, State: healthv1alpha1.VolumeHealthHealthy, Reason: "VolumeConditionNormal"}
+	nodeFailed := Observation{Source: healthv1alpha1.VolumeHealthSourceNodeWatcher, State: healthv1alpha1.VolumeHealthAbnormal, Reason: "NodeFailed", Message: "node1 failed"}
+	nodeRecovered := Observation{Source: healthv1alpha1.VolumeHealthSourceNodeWatcher, State: healthv1alpha1.VolumeHealthHealthy, Reason: "NodeRecovered", Message: "node1 recovered"}
+
+	record(t, updater, client, pvc, checkHealthy)
+	record(t, updater, client, pvc, nodeFailed)
+
+	// a healthy check does not clear the node failure, nor is the node failure written again
+	updates := countUpdates(client)
+	record(t, updater, client, pvc, checkHealthy)
+	record(t, updater, client, pvc, nodeFailed)
+	assert.Equal(updates, countUpdates(client))
+	health := getVolumeHealth(t, client, mock.DefaultNS, "pvc")
+	assert.Equal(healthv1alpha1.VolumeHealthAbnormal, health.Status.State)
+	assert.Equal("NodeFailed", health.Status.Reason)
+	assert.Equal(healthv1alpha1.VolumeHealthSourceNodeWatcher, health.Status.Source)
+	assert.Len(health.Status.Sources, 2)
+	assert.Len(health.Status.History, 2)
+
+	// the volume is healthy once all sources report it healthy
+	record(t, updater, client, pvc, nodeRecovered)
+	health = getVolumeHealth(t, client, mock.DefaultNS, "pvc")
+	assert.Equal(healthv1alpha1.VolumeHealthHealthy, health.Status.State)
+	assert.Equal("NodeRecovered", health.Status.Reason)
+	assert.Len(health.Status.History, 3)
+}